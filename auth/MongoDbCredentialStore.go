@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	cauth "github.com/pip-services3-gox/pip-services3-components-gox/auth"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type credentialDocument struct {
+	Key    string            `bson:"_id"`
+	Params map[string]string `bson:"params"`
+}
+
+// MongoDbCredentialStore is a credential store that keeps named credentials in MongoDB collection.
+// Secret fields can be encrypted with AES-GCM using a locally configured key
+// before they are written into the collection.
+//
+// The store uses its own connection to MongoDB. That connection must not resolve its
+// credentials from this store, otherwise opening it falls into a loop.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB collection name (default: credentials)
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- encryption_key:            (optional) base64 encoded AES key (16, 24 or 32 bytes) to encrypt secrets
+//			- encrypted_fields:          (optional) comma-separated list of encrypted fields (default: password,access_key)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//
+//	see ICredentialStore
+//	see CredentialParams
+//
+// Example:
+//	credentialStore := auth.NewMongoDbCredentialStore()
+//	credentialStore.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//		"options.encryption_key", "MDEyMzQ1Njc4OWFiY2RlZg==",
+//	))
+//	_ = credentialStore.Open(context.Background(), "123")
+//
+//	_ = credentialStore.Store(context.Background(), "123", "key1",
+//		cauth.NewCredentialParamsFromTuples("username", "jdoe", "password", "pass123"))
+//	credential, err := credentialStore.Lookup(context.Background(), "123", "key1")
+type MongoDbCredentialStore struct {
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	cipher          *conn.SecretCipher
+	cipherErr       error
+	encryptedFields []string
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The logger.
+	Logger *clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The MongoDB collection name.
+	CollectionName string
+	// The MongoDb collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewMongoDbCredentialStore creates a new instance of the credential store.
+//
+//	Returns: *MongoDbCredentialStore
+func NewMongoDbCredentialStore() *MongoDbCredentialStore {
+	c := &MongoDbCredentialStore{
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "credentials",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+			"options.encrypted_fields", "password,access_key",
+		),
+		config:          cconf.NewEmptyConfigParams(),
+		encryptedFields: []string{"password", "access_key"},
+		Logger:          clog.NewCompositeLogger(),
+		CollectionName:  "credentials",
+	}
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbCredentialStore) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.DependencyResolver.Configure(ctx, config)
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+
+	c.encryptedFields = splitFields(config.GetAsString("options.encrypted_fields"))
+	c.cipher, c.cipherErr = nil, nil
+	if key := config.GetAsString("options.encryption_key"); key != "" {
+		c.cipher, c.cipherErr = conn.NewSecretCipherFromString(key)
+	}
+}
+
+func splitFields(value string) []string {
+	fields := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbCredentialStore) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(ctx, references)
+
+	// try to get a connection
+	c.DependencyResolver.SetReferences(ctx, references)
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbCredentialStore) UnsetReferences() {
+	c.Connection = nil
+}
+
+func (c *MongoDbCredentialStore) createConnection(ctx context.Context) *conn.MongoDbConnection {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbCredentialStore) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCredentialStore) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.cipherErr != nil {
+		return c.cipherErr
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	c.Collection = c.Connection.GetDatabase().Collection(c.CollectionName)
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Opened credential store on mongodb collection %s", c.CollectionName)
+	return nil
+}
+
+// Close closes component and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCredentialStore) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+// Store stores credential parameters into the store.
+// Passing nil credential removes the stored one.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string transaction id to trace execution through call chain.
+//		- key string a key to uniquely identify the credential parameters.
+//		- credential *cauth.CredentialParams a credential parameters to be stored.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCredentialStore) Store(ctx context.Context, correlationId string, key string,
+	credential *cauth.CredentialParams) error {
+
+	if !c.opened {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Credential store is not opened")
+	}
+
+	if credential == nil {
+		if _, err := c.Collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+			return err
+		}
+		c.Logger.Trace(ctx, correlationId, "Removed credential %s from %s", key, c.CollectionName)
+		return nil
+	}
+
+	params := credential.Value()
+	if c.cipher != nil {
+		var err error
+		if params, err = c.cipher.EncryptFields(params, c.encryptedFields); err != nil {
+			return cerr.NewInternalError(correlationId, "ENCRYPT_FAILED", "Failed to encrypt credential "+key).
+				WithCause(err)
+		}
+	}
+
+	doc := credentialDocument{Key: key, Params: params}
+	_, err := c.Collection.ReplaceOne(ctx, bson.M{"_id": key}, doc, mongoopt.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	c.Logger.Trace(ctx, correlationId, "Stored credential %s in %s", key, c.CollectionName)
+	return nil
+}
+
+// Lookup lookups credential parameters by its key.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string transaction id to trace execution through call chain.
+//		- key string a key to uniquely identify the credential parameters.
+//	Returns: *cauth.CredentialParams, error found credential parameters or error.
+func (c *MongoDbCredentialStore) Lookup(ctx context.Context, correlationId string,
+	key string) (*cauth.CredentialParams, error) {
+
+	if !c.opened {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Credential store is not opened")
+	}
+
+	var doc credentialDocument
+	if err := c.Collection.FindOne(ctx, bson.M{"_id": key}).Decode(&doc); err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			return nil, cerr.NewConfigError(correlationId, "MISSING_CREDENTIALS", "missing credential param: "+key)
+		}
+		return nil, err
+	}
+
+	params := doc.Params
+	if c.cipher != nil {
+		var err error
+		if params, err = c.cipher.DecryptFields(params); err != nil {
+			return nil, cerr.NewInternalError(correlationId, "DECRYPT_FAILED", "Failed to decrypt credential "+key).
+				WithCause(err)
+		}
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved credential %s from %s", key, c.CollectionName)
+	return cauth.NewCredentialParams(params), nil
+}
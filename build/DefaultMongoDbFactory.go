@@ -3,13 +3,24 @@ package build
 import (
 	cref "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
 	cbuild "github.com/pip-services3-gox/pip-services3-components-gox/build"
+	cauth "github.com/pip-services3-gox/pip-services3-mongodb-gox/auth"
+	cconf "github.com/pip-services3-gox/pip-services3-mongodb-gox/config"
 	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	ccount "github.com/pip-services3-gox/pip-services3-mongodb-gox/count"
+	cmigration "github.com/pip-services3-gox/pip-services3-mongodb-gox/migration"
+	coutbox "github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
 )
 
 // DefaultMongoDbFactory helps creates MongoDb components by their descriptors.
 //
 //	see Factory
 //	see MongoDbConnection
+//	see MongoDbCounters
+//	see MongoDbConfigReader
+//	see MongoDbCredentialStore
+//	see MongoDbDiscovery
+//	see MongoDbOutboxRelay
+//	see MongoDbMigrator
 type DefaultMongoDbFactory struct {
 	cbuild.Factory
 }
@@ -21,7 +32,19 @@ func NewDefaultMongoDbFactory() *DefaultMongoDbFactory {
 	c := DefaultMongoDbFactory{}
 
 	mongoDbConnectionDescriptor := cref.NewDescriptor("pip-services", "connection", "mongodb", "*", "1.0")
+	mongoDbCountersDescriptor := cref.NewDescriptor("pip-services", "counters", "mongodb", "*", "1.0")
+	mongoDbConfigReaderDescriptor := cref.NewDescriptor("pip-services", "config-reader", "mongodb", "*", "1.0")
+	mongoDbCredentialStoreDescriptor := cref.NewDescriptor("pip-services", "credential-store", "mongodb", "*", "1.0")
+	mongoDbDiscoveryDescriptor := cref.NewDescriptor("pip-services", "discovery", "mongodb", "*", "1.0")
+	mongoDbOutboxRelayDescriptor := cref.NewDescriptor("pip-services", "outbox-relay", "mongodb", "*", "1.0")
+	mongoDbMigratorDescriptor := cref.NewDescriptor("pip-services", "migrator", "mongodb", "*", "1.0")
 
 	c.RegisterType(mongoDbConnectionDescriptor, conn.NewMongoDbConnection)
+	c.RegisterType(mongoDbCountersDescriptor, ccount.NewMongoDbCounters)
+	c.RegisterType(mongoDbConfigReaderDescriptor, cconf.NewEmptyMongoDbConfigReader)
+	c.RegisterType(mongoDbCredentialStoreDescriptor, cauth.NewMongoDbCredentialStore)
+	c.RegisterType(mongoDbDiscoveryDescriptor, conn.NewMongoDbDiscovery)
+	c.RegisterType(mongoDbOutboxRelayDescriptor, coutbox.NewMongoDbOutboxRelay)
+	c.RegisterType(mongoDbMigratorDescriptor, cmigration.NewMongoDbMigrator)
 	return &c
 }
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cconv "github.com/pip-services3-gox/pip-services3-commons-gox/convert"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	crun "github.com/pip-services3-gox/pip-services3-commons-gox/run"
+	ccfg "github.com/pip-services3-gox/pip-services3-components-gox/config"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDbConfigReader is a config reader that reads configuration from a document stored in MongoDB collection.
+// The document is found by its _id equal to the configured key, all other document fields
+// are treated as configuration. The reader supports parameterization using Mustache template engine
+// the same way as file-based config readers.
+//
+// When watching is enabled the reader subscribes to the document changes via change streams
+// and notifies registered change listeners, so containers can reconfigure themselves.
+// Change streams require MongoDB replica set or sharded cluster.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB collection name (default: configs)
+//		- key:                         key (_id) of the configuration document
+//		- parameters:                  this entire section is used as template parameters
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- watch:                     (optional) watch configuration document for changes (default: false)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	======== configs collection ======
+//	{ "_id": "my_service", "connection": { "host": "{{MONGO_HOST}}", "port": 27017 } }
+//	==================================
+//
+//	configReader := config.NewMongoDbConfigReader("my_service")
+//	configReader.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//	))
+//	parameters := cconf.NewConfigParamsFromTuples("MONGO_HOST", "10.1.1.100")
+//	res, err := configReader.ReadConfig(context.Background(), "123", parameters)
+//	// Possible result: connection.host=10.1.1.100;connection.port=27017
+type MongoDbConfigReader struct {
+	*ccfg.ConfigReader
+
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	watch           bool
+	listeners       []crun.INotifiable
+	lock            sync.Mutex
+	cancel          context.CancelFunc
+	wait            sync.WaitGroup
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The logger.
+	Logger *clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The MongoDB collection name.
+	CollectionName string
+	// The key of configuration document.
+	Key string
+	// The MongoDb collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewEmptyMongoDbConfigReader creates a new instance of the config reader.
+//
+//	Returns: *MongoDbConfigReader
+func NewEmptyMongoDbConfigReader() *MongoDbConfigReader {
+	return NewMongoDbConfigReader("")
+}
+
+// NewMongoDbConfigReader creates a new instance of the config reader.
+//
+//	Parameters:
+//		- key string a key (_id) of the configuration document.
+//	Returns: *MongoDbConfigReader
+func NewMongoDbConfigReader(key string) *MongoDbConfigReader {
+	c := &MongoDbConfigReader{
+		ConfigReader: ccfg.NewConfigReader(),
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "configs",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+			"options.watch", false,
+		),
+		config:         cconf.NewEmptyConfigParams(),
+		listeners:      make([]crun.INotifiable, 0),
+		Logger:         clog.NewCompositeLogger(),
+		CollectionName: "configs",
+		Key:            key,
+	}
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbConfigReader) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.ConfigReader.Configure(ctx, config)
+	c.DependencyResolver.Configure(ctx, config)
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.Key = config.GetAsStringWithDefault("key", c.Key)
+	c.watch = config.GetAsBooleanWithDefault("options.watch", c.watch)
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbConfigReader) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(ctx, references)
+
+	// try to get a connection
+	c.DependencyResolver.SetReferences(ctx, references)
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbConfigReader) UnsetReferences() {
+	c.Connection = nil
+}
+
+func (c *MongoDbConfigReader) createConnection(ctx context.Context) *conn.MongoDbConnection {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbConfigReader) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component and starts watching the configuration document when it is enabled.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbConfigReader) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	c.Collection = c.Connection.GetDatabase().Collection(c.CollectionName)
+
+	if c.watch {
+		if err := c.startWatching(ctx, correlationId); err != nil {
+			c.Collection = nil
+			return cerr.NewConnectionError(correlationId, "WATCH_FAILED",
+				"Failed to watch configuration in "+c.CollectionName).WithCause(err)
+		}
+	}
+
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Opened config reader on mongodb collection %s", c.CollectionName)
+	return nil
+}
+
+// Close closes component, stops watching configuration and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbConfigReader) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.wait.Wait()
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+func (c *MongoDbConfigReader) startWatching(ctx context.Context, correlationId string) error {
+	pipeline := mongodrv.Pipeline{
+		{{Key: "$match", Value: bson.M{"documentKey._id": c.Key}}},
+	}
+	stream, err := c.Collection.Watch(ctx, pipeline, mongoopt.ChangeStream())
+	if err != nil {
+		return err
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wait.Add(1)
+	go func() {
+		defer c.wait.Done()
+		defer stream.Close(context.Background())
+		for stream.Next(watchCtx) {
+			var event bson.M
+			if err := stream.Decode(&event); err != nil {
+				continue
+			}
+			c.Logger.Debug(watchCtx, correlationId, "Configuration %s changed in %s", c.Key, c.CollectionName)
+			c.notifyListeners(watchCtx, correlationId, event)
+		}
+		if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+			c.Logger.Error(watchCtx, correlationId, err, "Watching configuration %s stopped", c.Key)
+		}
+	}()
+	return nil
+}
+
+func (c *MongoDbConfigReader) notifyListeners(ctx context.Context, correlationId string, event bson.M) {
+	c.lock.Lock()
+	listeners := make([]crun.INotifiable, len(c.listeners))
+	copy(listeners, c.listeners)
+	c.lock.Unlock()
+
+	args := crun.NewParametersFromTuples(
+		"key", c.Key,
+		"collection", c.CollectionName,
+		"operation", event["operationType"],
+	)
+	for _, listener := range listeners {
+		listener.Notify(ctx, correlationId, args)
+	}
+}
+
+// ReadConfig reads configuration document from MongoDB, parameterize
+// it with given values and returns a new ConfigParams object.
+// If the component is not opened yet, it is opened automatically.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string transaction id to trace execution through call chain.
+//		- parameters *cconf.ConfigParams values to parameters the configuration.
+//	Returns: *cconf.ConfigParams, error configuration or error.
+func (c *MongoDbConfigReader) ReadConfig(ctx context.Context, correlationId string,
+	parameters *cconf.ConfigParams) (*cconf.ConfigParams, error) {
+
+	if c.Key == "" {
+		return nil, cerr.NewConfigError(correlationId, "NO_KEY", "Missing configuration key")
+	}
+
+	if !c.opened {
+		if err := c.Open(ctx, correlationId); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc bson.M
+	err := c.Collection.FindOne(ctx, bson.M{"_id": c.Key}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			return nil, cerr.NewNotFoundError(correlationId, "CONFIG_NOT_FOUND",
+				"Configuration "+c.Key+" was not found in "+c.CollectionName).
+				WithDetails("key", c.Key)
+		}
+		return nil, cerr.NewConnectionError(correlationId, "READ_FAILED",
+			"Failed reading configuration "+c.Key).WithCause(err)
+	}
+	delete(doc, "_id")
+
+	buf, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.Parameterize(string(buf), parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Read configuration %s from %s", c.Key, c.CollectionName)
+	return cconf.NewConfigParamsFromValue(cconv.JsonConverter.ToMap(data)), nil
+}
+
+// AddChangeListener adds a listener that will be notified when configuration is changed
+//
+//	Parameters:
+//		- ctx context.Context
+//		- listener crun.INotifiable a listener to be added.
+func (c *MongoDbConfigReader) AddChangeListener(ctx context.Context, listener crun.INotifiable) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.listeners = append(c.listeners, listener)
+}
+
+// RemoveChangeListener remove a previously added change listener.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- listener crun.INotifiable a listener to be removed.
+func (c *MongoDbConfigReader) RemoveChangeListener(ctx context.Context, listener crun.INotifiable) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, l := range c.listeners {
+		if l == listener {
+			c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
+			return
+		}
+	}
+}
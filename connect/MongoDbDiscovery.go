@@ -0,0 +1,327 @@
+package connect
+
+import (
+	"context"
+	"strings"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerror "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	ccon "github.com/pip-services3-gox/pip-services3-components-gox/connect"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type connectionDocument struct {
+	Key    string            `bson:"key"`
+	Params map[string]string `bson:"params"`
+}
+
+// MongoDbDiscovery is a discovery service that keeps named connection parameters in MongoDB collection.
+// Registering a key again replaces its connection parameters.
+// Secret fields (like URIs with embedded passwords) can be encrypted with AES-GCM
+// using a locally configured key before they are written into the collection.
+//
+// The discovery uses its own connection to MongoDB. That connection must not be resolved
+// through this discovery, otherwise opening it falls into a loop.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB collection name (default: connections)
+//		- connection(s):
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- encryption_key:            (optional) base64 encoded AES key (16, 24 or 32 bytes) to encrypt secrets
+//			- encrypted_fields:          (optional) comma-separated list of encrypted fields (default: uri,password)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+//	see IDiscovery
+//	see ConnectionParams
+//
+// Example:
+//	discovery := connect.NewMongoDbDiscovery()
+//	discovery.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//	))
+//	_ = discovery.Open(context.Background(), "123")
+//
+//	_, _ = discovery.Register("123", "key1", ccon.NewConnectionParamsFromTuples("host", "10.1.1.100", "port", 8080))
+//	connection, err := discovery.ResolveOne("123", "key1")
+type MongoDbDiscovery struct {
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	cipher          *SecretCipher
+	cipherErr       error
+	encryptedFields []string
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The logger.
+	Logger *clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *MongoDbConnection
+	// The MongoDB collection name.
+	CollectionName string
+	// The MongoDb collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewMongoDbDiscovery creates a new instance of the discovery service.
+//
+//	Returns: *MongoDbDiscovery
+func NewMongoDbDiscovery() *MongoDbDiscovery {
+	c := &MongoDbDiscovery{
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "connections",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+			"options.encrypted_fields", "uri,password",
+		),
+		config:          cconf.NewEmptyConfigParams(),
+		encryptedFields: []string{"uri", "password"},
+		Logger:          clog.NewCompositeLogger(),
+		CollectionName:  "connections",
+	}
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbDiscovery) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.DependencyResolver.Configure(ctx, config)
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+
+	c.encryptedFields = make([]string, 0)
+	for _, field := range strings.Split(config.GetAsString("options.encrypted_fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			c.encryptedFields = append(c.encryptedFields, field)
+		}
+	}
+	c.cipher, c.cipherErr = nil, nil
+	if key := config.GetAsString("options.encryption_key"); key != "" {
+		c.cipher, c.cipherErr = NewSecretCipherFromString(key)
+	}
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbDiscovery) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(ctx, references)
+
+	// try to get a connection
+	c.DependencyResolver.SetReferences(ctx, references)
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbDiscovery) UnsetReferences() {
+	c.Connection = nil
+}
+
+func (c *MongoDbDiscovery) createConnection(ctx context.Context) *MongoDbConnection {
+	connection := NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbDiscovery) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component and creates index on connection keys.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbDiscovery) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.cipherErr != nil {
+		return c.cipherErr
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	c.Collection = c.Connection.GetDatabase().Collection(c.CollectionName)
+	_, err := c.Collection.Indexes().CreateOne(ctx, mongodrv.IndexModel{Keys: bson.D{{Key: "key", Value: 1}}})
+	if err != nil {
+		c.Collection = nil
+		return cerror.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(err)
+	}
+
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Opened discovery on mongodb collection %s", c.CollectionName)
+	return nil
+}
+
+// Close closes component and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbDiscovery) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+// Register registers connection parameters into the discovery service.
+// Connection parameters registered before under the same key are replaced.
+//
+//	Parameters:
+//		- correlationId string transaction id to trace execution through call chain.
+//		- key string a key to uniquely identify the connection parameters.
+//		- connection *ccon.ConnectionParams connection parameters to be registered.
+//	Returns: *ccon.ConnectionParams, error registered connection or error.
+func (c *MongoDbDiscovery) Register(correlationId string, key string,
+	connection *ccon.ConnectionParams) (result *ccon.ConnectionParams, err error) {
+
+	if !c.opened {
+		return nil, cerror.NewInvalidStateError(correlationId, "NOT_OPENED", "Discovery is not opened")
+	}
+	if connection == nil {
+		return nil, nil
+	}
+
+	params := connection.Value()
+	if c.cipher != nil {
+		if params, err = c.cipher.EncryptFields(params, c.encryptedFields); err != nil {
+			return nil, cerror.NewInternalError(correlationId, "ENCRYPT_FAILED", "Failed to encrypt connection "+key).
+				WithCause(err)
+		}
+	}
+
+	ctx := context.Background()
+	// The new document is inserted before the old ones are deleted, so the key is always resolved
+	res, err := c.Collection.InsertOne(ctx, connectionDocument{Key: key, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.Collection.DeleteMany(ctx, bson.M{"key": key, "_id": bson.M{"$ne": res.InsertedID}}); err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Registered connection %s in %s", key, c.CollectionName)
+	return connection, nil
+}
+
+// ResolveOne resolves a single connection parameters by its key.
+// When several connections are found the latest registered one is returned.
+//
+//	Parameters:
+//		- correlationId string transaction id to trace execution through call chain.
+//		- key string a key to uniquely identify the connection.
+//	Returns: *ccon.ConnectionParams, error found connection or error.
+func (c *MongoDbDiscovery) ResolveOne(correlationId string, key string) (result *ccon.ConnectionParams, err error) {
+	connections, err := c.ResolveAll(correlationId, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(connections) > 0 {
+		return connections[0], nil
+	}
+	return nil, nil
+}
+
+// ResolveAll resolves all connection parameters by their key, the latest registered go first.
+//
+//	Parameters:
+//		- correlationId string transaction id to trace execution through call chain.
+//		- key string a key to uniquely identify the connections.
+//	Returns: []*ccon.ConnectionParams, error found connections or error.
+func (c *MongoDbDiscovery) ResolveAll(correlationId string, key string) (result []*ccon.ConnectionParams, err error) {
+	if !c.opened {
+		return nil, cerror.NewInvalidStateError(correlationId, "NOT_OPENED", "Discovery is not opened")
+	}
+
+	ctx := context.Background()
+	cursor, err := c.Collection.Find(ctx, bson.M{"key": key}, mongoopt.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []connectionDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	result = make([]*ccon.ConnectionParams, 0, len(docs))
+	for _, doc := range docs {
+		params := doc.Params
+		if c.cipher != nil {
+			if params, err = c.cipher.DecryptFields(params); err != nil {
+				return nil, cerror.NewInternalError(correlationId, "DECRYPT_FAILED", "Failed to decrypt connection "+key).
+					WithCause(err)
+			}
+		}
+		result = append(result, ccon.NewConnectionParams(params))
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Resolved %d connections %s from %s", len(result), key, c.CollectionName)
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package connect
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+)
+
+// EncryptedSecretPrefix marks values encrypted by SecretCipher.
+const EncryptedSecretPrefix = "enc:"
+
+// SecretCipher encrypts and decrypts secret values stored in MongoDB
+// using AES-GCM with a locally configured key.
+// Encrypted values are base64 encoded and prefixed with EncryptedSecretPrefix,
+// so plain values stored before encryption was enabled can still be read.
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSecretCipher creates a new cipher from a raw key.
+//
+//	Parameters:
+//		- key []byte AES key of 16, 24 or 32 bytes.
+//	Returns: *SecretCipher, error created cipher or error if the key is invalid.
+func NewSecretCipher(key []byte) (*SecretCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, cerr.NewConfigError("", "BAD_ENCRYPTION_KEY", "Encryption key must be 16, 24 or 32 bytes long").
+			WithCause(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretCipher{aead: aead}, nil
+}
+
+// NewSecretCipherFromString creates a new cipher from a base64 encoded key.
+//
+//	Parameters:
+//		- key string base64 encoded AES key of 16, 24 or 32 bytes.
+//	Returns: *SecretCipher, error created cipher or error if the key is invalid.
+func NewSecretCipherFromString(key string) (*SecretCipher, error) {
+	buf, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, cerr.NewConfigError("", "BAD_ENCRYPTION_KEY", "Encryption key must be base64 encoded").
+			WithCause(err)
+	}
+	return NewSecretCipher(buf)
+}
+
+// IsEncryptedSecret checks if the value was encrypted by SecretCipher.
+//
+//	Parameters:
+//		- value string a value to check.
+//	Returns: true if the value is encrypted.
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, EncryptedSecretPrefix)
+}
+
+// Encrypt encrypts a secret value.
+//
+//	Parameters:
+//		- value string a plain value.
+//	Returns: string, error encrypted value or error.
+func (c *SecretCipher) Encrypt(value string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	buf := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return EncryptedSecretPrefix + base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// Decrypt decrypts a secret value. Values without EncryptedSecretPrefix are returned as is.
+//
+//	Parameters:
+//		- value string an encrypted value.
+//	Returns: string, error plain value or error.
+func (c *SecretCipher) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(buf) < nonceSize {
+		return "", cerr.NewError("Encrypted value is too short")
+	}
+	plain, err := c.aead.Open(nil, buf[:nonceSize], buf[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// EncryptFields encrypts selected fields in the map of values.
+//
+//	Parameters:
+//		- values map[string]string values to process.
+//		- fields []string names of the fields to encrypt.
+//	Returns: map[string]string, error a copy of values with encrypted fields or error.
+func (c *SecretCipher) EncryptFields(values map[string]string, fields []string) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for k, v := range values {
+		result[k] = v
+	}
+	for _, field := range fields {
+		if v, ok := result[field]; ok && v != "" && !IsEncryptedSecret(v) {
+			encrypted, err := c.Encrypt(v)
+			if err != nil {
+				return nil, err
+			}
+			result[field] = encrypted
+		}
+	}
+	return result, nil
+}
+
+// DecryptFields decrypts all encrypted fields in the map of values.
+//
+//	Parameters:
+//		- values map[string]string values to process.
+//	Returns: map[string]string, error a copy of values with decrypted fields or error.
+func (c *SecretCipher) DecryptFields(values map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for k, v := range values {
+		plain, err := c.Decrypt(v)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = plain
+	}
+	return result, nil
+}
@@ -0,0 +1,474 @@
+package count
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	crun "github.com/pip-services3-gox/pip-services3-commons-gox/run"
+	ccount "github.com/pip-services3-gox/pip-services3-components-gox/count"
+	cinfo "github.com/pip-services3-gox/pip-services3-components-gox/info"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CounterRecord is a single counter measurement stored in MongoDB time-series collection.
+type CounterRecord struct {
+	Time    time.Time         `bson:"time" json:"time"`
+	Meta    CounterRecordMeta `bson:"meta" json:"meta"`
+	Last    float64           `bson:"last" json:"last"`
+	Count   int64             `bson:"count" json:"count"`
+	Min     float64           `bson:"min" json:"min"`
+	Max     float64           `bson:"max" json:"max"`
+	Average float64           `bson:"average" json:"average"`
+	// Number of measurements since the previous dump. Count is cumulative
+	// between resets, so aggregations shall sum deltas instead.
+	Delta int64 `bson:"delta" json:"delta"`
+}
+
+// CounterRecordMeta is a metadata of counter measurement used to group time-series buckets.
+type CounterRecordMeta struct {
+	Name   string `bson:"name" json:"name"`
+	Type   string `bson:"type" json:"type"`
+	Source string `bson:"source" json:"source"`
+}
+
+// CounterAggregate is aggregated counter values over a time interval.
+type CounterAggregate struct {
+	Time    time.Time `bson:"_id" json:"time"`
+	Last    float64   `bson:"last" json:"last"`
+	Count   int64     `bson:"count" json:"count"`
+	Min     float64   `bson:"min" json:"min"`
+	Max     float64   `bson:"max" json:"max"`
+	Average float64   `bson:"average" json:"average"`
+}
+
+// MongoDbCounters performance counters that periodically dumps counters measurements
+// into MongoDB time-series collection.
+//
+// The collection is created on opening with timeseries options when it doesn't exist yet.
+// Stored measurements can be queried back aggregated over time intervals with GetAggregatedValues method.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB collection name (default: counters)
+//		- source:                      (optional) name of the counters source (default: context name)
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- interval:                  (optional) interval in milliseconds to save current counters measurements (default: 5 mins)
+//			- reset_timeout:             (optional) timeout in milliseconds to reset the counters at the next dump. 0 disables the reset (default: 0)
+//			- granularity:               (optional) time-series granularity: seconds, minutes or hours (default: minutes)
+//			- retention:                 (optional) time in seconds to keep measurements. 0 keeps them forever (default: 0)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:context-info:*:*:1.0     (optional) ContextInfo to detect the context id and specify counters source
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	counters := count.NewMongoDbCounters()
+//	counters.Configure(context.Background(), config.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//	))
+//
+//	_ = counters.Open(context.Background(), "123")
+//	counters.IncrementOne(context.Background(), "mycomponent.mymethod.calls")
+//	timing := counters.BeginTiming(context.Background(), "mycomponent.mymethod.exec_time")
+//	defer timing.EndTiming(context.Background())
+//
+//	// do something
+//	counters.Dump(context.Background())
+type MongoDbCounters struct {
+	*ccount.CachedCounters
+
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	timer           *crun.FixedRateTimer
+	interval        int
+	granularity     string
+	retention       int64
+	source          string
+	resetTimeout    int64
+	lastResetTime   time.Time
+	countsLock      sync.Mutex
+	savedCounts     map[string]int64
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The logger.
+	Logger *clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The MongoDB collection name.
+	CollectionName string
+	// The MongoDb collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewMongoDbCounters creates a new instance of the counters.
+//
+//	Returns: *MongoDbCounters
+func NewMongoDbCounters() *MongoDbCounters {
+	c := &MongoDbCounters{
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "counters",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+			"options.interval", ccount.DefaultInterval,
+			"options.granularity", "minutes",
+			"options.retention", 0,
+			"options.reset_timeout", 0,
+		),
+		config:         cconf.NewEmptyConfigParams(),
+		savedCounts:    map[string]int64{},
+		interval:       int(ccount.DefaultInterval),
+		granularity:    "minutes",
+		Logger:         clog.NewCompositeLogger(),
+		CollectionName: "counters",
+	}
+	c.CachedCounters = ccount.InheritCacheCounters(c)
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbCounters) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.DependencyResolver.Configure(ctx, config)
+
+	// The reset timeout is handled at dumps, so the counts saved before a reset are known
+	options := config.GetSection("options")
+	c.resetTimeout = options.GetAsLongWithDefault("reset_timeout", c.resetTimeout)
+	options.Put("reset_timeout", 0)
+	c.CachedCounters.Configure(ctx, options)
+
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.source = config.GetAsStringWithDefault("source", c.source)
+	c.interval = config.GetAsIntegerWithDefault("options.interval", c.interval)
+	c.granularity = config.GetAsStringWithDefault("options.granularity", c.granularity)
+	c.retention = config.GetAsLongWithDefault("options.retention", c.retention)
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbCounters) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(ctx, references)
+
+	contextInfo, ok := references.GetOneOptional(
+		crefer.NewDescriptor("pip-services", "context-info", "*", "*", "1.0"),
+	).(*cinfo.ContextInfo)
+	if ok && contextInfo != nil && c.source == "" {
+		c.source = contextInfo.Name
+	}
+
+	// try to get a connection
+	c.DependencyResolver.SetReferences(ctx, references)
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbCounters) UnsetReferences() {
+	c.Connection = nil
+}
+
+func (c *MongoDbCounters) createConnection(ctx context.Context) *conn.MongoDbConnection {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbCounters) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component, creates time-series collection
+// if it doesn't exist and starts periodic dumping of the counters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCounters) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	db := c.Connection.GetDatabase()
+	if err := c.createCollection(ctx, db); err != nil {
+		return cerr.NewConnectionError(correlationId, "CREATE_COLLECTION_FAILED",
+			"Failed to create time-series collection "+c.CollectionName).WithCause(err)
+	}
+	c.Collection = db.Collection(c.CollectionName)
+
+	c.countsLock.Lock()
+	c.lastResetTime = time.Now()
+	c.countsLock.Unlock()
+
+	c.timer = crun.NewFixedRateTimerFromCallback(func(ctx context.Context) {
+		if err := c.Dump(ctx); err != nil {
+			c.Logger.Error(ctx, correlationId, err, "Failed to dump counters to %s", c.CollectionName)
+		}
+	}, c.interval, c.interval, 1)
+	c.timer.Start(ctx)
+
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Opened counters in mongodb collection %s", c.CollectionName)
+	return nil
+}
+
+func (c *MongoDbCounters) createCollection(ctx context.Context, db *mongodrv.Database) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": c.CollectionName})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+
+	timeSeries := mongoopt.TimeSeries().
+		SetTimeField("time").
+		SetMetaField("meta").
+		SetGranularity(c.granularity)
+	options := mongoopt.CreateCollection().SetTimeSeriesOptions(timeSeries)
+	if c.retention > 0 {
+		options.SetExpireAfterSeconds(c.retention)
+	}
+	return db.CreateCollection(ctx, c.CollectionName, options)
+}
+
+// Close closes component, dumps the remaining measurements and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCounters) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	if c.timer != nil {
+		c.timer.Stop(ctx)
+		c.timer = nil
+	}
+
+	if err := c.Dump(ctx); err != nil {
+		c.Logger.Error(ctx, correlationId, err, "Failed to dump counters to %s", c.CollectionName)
+	}
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+// Clear clears (resets) a counter specified by its name.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- name string a counter name to clear.
+func (c *MongoDbCounters) Clear(ctx context.Context, name string) {
+	c.countsLock.Lock()
+	defer c.countsLock.Unlock()
+
+	c.CachedCounters.Clear(ctx, name)
+	delete(c.savedCounts, name)
+}
+
+// ClearAll clears (resets) all counters.
+//
+//	Parameters:
+//		- ctx context.Context
+func (c *MongoDbCounters) ClearAll(ctx context.Context) {
+	c.countsLock.Lock()
+	defer c.countsLock.Unlock()
+
+	c.CachedCounters.ClearAll(ctx)
+	c.savedCounts = map[string]int64{}
+}
+
+// Save saves the current counters measurements.
+// Each record keeps the number of measurements since the previous dump, counters are reset
+// after they are saved when the reset timeout has passed.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- counters []ccount.Counter current counters measurements to be saves.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbCounters) Save(ctx context.Context, counters []ccount.Counter) error {
+	if len(counters) == 0 || c.Collection == nil {
+		return nil
+	}
+
+	c.countsLock.Lock()
+	defer c.countsLock.Unlock()
+
+	now := time.Now().UTC()
+	records := make([]any, 0, len(counters))
+	for _, counter := range counters {
+		record := c.toRecord(counter, now)
+		record.Delta = record.Count - c.savedCounts[counter.Name]
+		records = append(records, record)
+	}
+
+	if _, err := c.Collection.InsertMany(ctx, records); err != nil {
+		return err
+	}
+
+	if c.resetTimeout > 0 && now.Sub(c.lastResetTime) >= time.Duration(c.resetTimeout)*time.Millisecond {
+		c.CachedCounters.ClearAll(ctx)
+		c.savedCounts = map[string]int64{}
+		c.lastResetTime = now
+	} else {
+		for _, counter := range counters {
+			c.savedCounts[counter.Name] = counter.Count
+		}
+	}
+	c.Logger.Trace(ctx, "", "Saved %d counters to %s", len(records), c.CollectionName)
+	return nil
+}
+
+func (c *MongoDbCounters) toRecord(counter ccount.Counter, now time.Time) CounterRecord {
+	record := CounterRecord{
+		Time: now,
+		Meta: CounterRecordMeta{
+			Name:   counter.Name,
+			Type:   counter.Type.ToString(),
+			Source: c.source,
+		},
+		Last:    counter.Last,
+		Count:   counter.Count,
+		Min:     counter.Min,
+		Max:     counter.Max,
+		Average: counter.Average,
+	}
+	if counter.Type == ccount.Timestamp && !counter.Time.IsZero() {
+		record.Time = counter.Time.UTC()
+	}
+	return record
+}
+
+// GetAggregatedValues gets counter measurements aggregated over equal time intervals.
+// Count of an interval is the number of measurements made in it, other values are
+// aggregated from the cumulative values stored by dumps.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- name string a counter name.
+//		- from time.Time start of the time range (inclusive).
+//		- to time.Time end of the time range (exclusive).
+//		- interval time.Duration duration of the aggregation interval.
+//	Returns: []CounterAggregate, error aggregated values sorted by time and error, if they are occurred.
+func (c *MongoDbCounters) GetAggregatedValues(ctx context.Context, correlationId string,
+	name string, from time.Time, to time.Time, interval time.Duration) ([]CounterAggregate, error) {
+
+	if c.Collection == nil {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Counters are not opened")
+	}
+	intervalMs := interval.Milliseconds()
+	if intervalMs <= 0 {
+		return nil, cerr.NewBadRequestError(correlationId, "BAD_INTERVAL", "Aggregation interval must be positive").
+			WithDetails("interval", interval.String())
+	}
+
+	match := bson.M{
+		"meta.name": name,
+		"time":      bson.M{"$gte": from, "$lt": to},
+	}
+	if c.source != "" {
+		match["meta.source"] = c.source
+	}
+
+	timeMs := bson.M{"$toLong": "$time"}
+	pipeline := mongodrv.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"time": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$toDate": bson.M{
+				"$subtract": bson.A{timeMs, bson.M{"$mod": bson.A{timeMs, intervalMs}}},
+			}},
+			"last":    bson.M{"$last": "$last"},
+			"count":   bson.M{"$sum": "$delta"},
+			"min":     bson.M{"$min": "$min"},
+			"max":     bson.M{"$max": "$max"},
+			"average": bson.M{"$avg": "$average"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := c.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]CounterAggregate, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d aggregated values of %s from %s", len(items), name, c.CollectionName)
+	return items, nil
+}
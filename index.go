@@ -1,7 +1,12 @@
 package mongodb
 
 import (
+	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/auth"
 	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/build"
+	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/config"
 	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/count"
+	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/migration"
+	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
 	_ "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
 )
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoDbMigrationFunc changes the database to apply or revert a migration.
+type MongoDbMigrationFunc func(ctx context.Context, db *mongodrv.Database) error
+
+// MongoDbMigration is a versioned change of the database.
+// Migrations are applied in ascending order of versions and reverted in descending order.
+type MongoDbMigration struct {
+	// Unique positive version of the migration.
+	Version int64
+	// Human readable description of the migration.
+	Description string
+	// Function that applies the migration.
+	Up MongoDbMigrationFunc
+	// Function that reverts the migration, nil if the migration can't be reverted.
+	Down MongoDbMigrationFunc
+}
+
+// MongoDbMigrationRecord is a record about applied migration kept in the migrations collection.
+type MongoDbMigrationRecord struct {
+	Version     int64     `bson:"_id" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedTime time.Time `bson:"applied_time" json:"applied_time"`
+	Duration    int64     `bson:"duration" json:"duration"`
+}
+
+// MongoDbMigrationStatus is a state of a registered or applied migration.
+type MongoDbMigrationStatus struct {
+	Version     int64
+	Description string
+	// True if the migration is applied.
+	Applied bool
+	// Time when the migration was applied.
+	AppliedTime time.Time
+	// True if the migration is applied, but it is not registered in the migrator.
+	Unknown bool
+}
+
+// IMongoDbMigrations is an interface for components that provide migrations
+// to MongoDbMigrator through references.
+type IMongoDbMigrations interface {
+	// GetMigrations gets migrations provided by the component.
+	GetMigrations() []MongoDbMigration
+}
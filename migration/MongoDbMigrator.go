@@ -0,0 +1,590 @@
+package migration
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const migrationLockId = "lock"
+
+type migrationStep struct {
+	migration MongoDbMigration
+	up        bool
+}
+
+// MongoDbMigrator applies versioned migrations to MongoDB database.
+// Applied migrations are recorded in the migrations collection, so each of them runs only once.
+// Before migrating the migrator takes a lock in the same collection, so only one
+// instance migrates the database while others wait for the lock.
+// Migrations are not transactional: a failed migration stops migrating and is not recorded.
+//
+// Migrations are registered with Register or provided by referenced IMongoDbMigrations components.
+// Progress is logged through the logger of the MongoDB connection.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) migrations collection name (default: _migrations)
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- auto_migrate:              (optional) apply pending migrations when the component is opened (default: false)
+//			- dry_run:                   (optional) log and return planned migrations without running them (default: false)
+//			- lock_timeout:              (optional) timeout in milliseconds after which the lock of a crashed instance expires (default: 600000)
+//			- lock_wait_timeout:         (optional) timeout in milliseconds to wait for the lock taken by another instance (default: 60000)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:migrations:*:*:1.0       (optional) IMongoDbMigrations components with migrations
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	migrator := migration.NewMongoDbMigrator()
+//	migrator.Configure(context.Background(), config.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//		"options.auto_migrate", true,
+//	))
+//	migrator.Register(migration.MongoDbMigration{
+//		Version:     1,
+//		Description: "Add index on dummies key",
+//		Up: func(ctx context.Context, db *mongo.Database) error {
+//			_, err := db.Collection("dummies").Indexes().CreateOne(ctx, mongo.IndexModel{
+//				Keys:    bson.D{{Key: "key", Value: 1}},
+//				Options: options.Index().SetName("key_1"),
+//			})
+//			return err
+//		},
+//		Down: func(ctx context.Context, db *mongo.Database) error {
+//			_, err := db.Collection("dummies").Indexes().DropOne(ctx, "key_1")
+//			return err
+//		},
+//	})
+//	_ = migrator.Open(context.Background(), "123")
+type MongoDbMigrator struct {
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	autoMigrate     bool
+	dryRun          bool
+	lockTimeout     int64
+	lockWaitTimeout int64
+	lockRetry       time.Duration
+	owner           string
+	migrations      []MongoDbMigration
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The migrations collection name.
+	CollectionName string
+	// The migrations collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewMongoDbMigrator creates a new instance of the migrator.
+//
+//	Returns: *MongoDbMigrator
+func NewMongoDbMigrator() *MongoDbMigrator {
+	c := &MongoDbMigrator{
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "_migrations",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+		),
+		config:          cconf.NewEmptyConfigParams(),
+		lockTimeout:     600000,
+		lockWaitTimeout: 60000,
+		lockRetry:       500 * time.Millisecond,
+		owner:           cdata.IdGenerator.NextLong(),
+		migrations:      make([]MongoDbMigration, 0),
+		CollectionName:  "_migrations",
+	}
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbMigrator) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.DependencyResolver.Configure(ctx, config)
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.autoMigrate = config.GetAsBooleanWithDefault("options.auto_migrate", c.autoMigrate)
+	c.dryRun = config.GetAsBooleanWithDefault("options.dry_run", c.dryRun)
+	c.lockTimeout = config.GetAsLongWithDefault("options.lock_timeout", c.lockTimeout)
+	c.lockWaitTimeout = config.GetAsLongWithDefault("options.lock_wait_timeout", c.lockWaitTimeout)
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbMigrator) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.DependencyResolver.SetReferences(ctx, references)
+
+	for _, provider := range references.GetOptional(crefer.NewDescriptor("*", "migrations", "*", "*", "1.0")) {
+		if migrations, ok := provider.(IMongoDbMigrations); ok {
+			c.Register(migrations.GetMigrations()...)
+		}
+	}
+
+	// try to get a connection
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbMigrator) UnsetReferences() {
+	c.Connection = nil
+}
+
+func (c *MongoDbMigrator) createConnection(ctx context.Context) *conn.MongoDbConnection {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// Register adds migrations to be applied by the migrator.
+//
+//	Parameters:
+//		- migrations ...MongoDbMigration migrations to be registered.
+func (c *MongoDbMigrator) Register(migrations ...MongoDbMigration) {
+	c.migrations = append(c.migrations, migrations...)
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbMigrator) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component and applies pending migrations when auto_migrate option is set.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbMigrator) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	c.Collection = c.Connection.GetDatabase().Collection(c.CollectionName)
+	c.opened = true
+
+	if c.autoMigrate {
+		if _, err := c.MigrateUp(ctx, correlationId); err != nil {
+			_ = c.Close(ctx, correlationId)
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the component and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbMigrator) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+// GetStatus gets states of registered migrations and migrations applied to the database.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: []MongoDbMigrationStatus, error states of migrations ordered by versions and error, if they are occurred.
+func (c *MongoDbMigrator) GetStatus(ctx context.Context, correlationId string) ([]MongoDbMigrationStatus, error) {
+	migrations, err := c.sortedMigrations(correlationId)
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.readRecords(ctx, correlationId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MongoDbMigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MongoDbMigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := records[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedTime = record.AppliedTime
+			delete(records, migration.Version)
+		}
+		result = append(result, status)
+	}
+	for _, record := range records {
+		result = append(result, MongoDbMigrationStatus{
+			Version:     record.Version,
+			Description: record.Description,
+			Applied:     true,
+			AppliedTime: record.AppliedTime,
+			Unknown:     true,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// MigrateUp applies all pending migrations in order of their versions.
+// Pending migrations with versions lower than already applied ones are applied as well.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: []MongoDbMigration, error applied (or planned in dry run) migrations and error, if they are occurred.
+func (c *MongoDbMigrator) MigrateUp(ctx context.Context, correlationId string) ([]MongoDbMigration, error) {
+	return c.MigrateTo(ctx, correlationId, math.MaxInt64)
+}
+
+// MigrateTo migrates the database to a given version. Pending migrations up to the version are applied
+// and applied migrations above the version are reverted.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- version int64 a target version, 0 to revert all migrations.
+//	Returns: []MongoDbMigration, error applied or reverted (or planned in dry run) migrations and error, if they are occurred.
+func (c *MongoDbMigrator) MigrateTo(ctx context.Context, correlationId string, version int64) ([]MongoDbMigration, error) {
+	return c.execute(ctx, correlationId, func(migrations []MongoDbMigration,
+		records map[int64]MongoDbMigrationRecord) ([]migrationStep, error) {
+
+		if err := c.checkRevertible(correlationId, migrations, records, version); err != nil {
+			return nil, err
+		}
+
+		steps := make([]migrationStep, 0)
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if _, ok := records[migrations[i].Version]; ok && migrations[i].Version > version {
+				steps = append(steps, migrationStep{migration: migrations[i], up: false})
+			}
+		}
+		for _, migration := range migrations {
+			if _, ok := records[migration.Version]; !ok && migration.Version <= version {
+				steps = append(steps, migrationStep{migration: migration, up: true})
+			}
+		}
+		return steps, nil
+	})
+}
+
+// MigrateDown reverts a number of the last applied migrations.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- count int a number of migrations to be reverted. 0 reverts nothing.
+//	Returns: []MongoDbMigration, error reverted (or planned in dry run) migrations and error, if they are occurred.
+func (c *MongoDbMigrator) MigrateDown(ctx context.Context, correlationId string, count int) ([]MongoDbMigration, error) {
+	if count < 0 {
+		return nil, cerr.NewBadRequestError(correlationId, "INVALID_COUNT",
+			"Number of migrations to revert can't be negative").
+			WithDetails("count", count)
+	}
+	if count == 0 {
+		return []MongoDbMigration{}, nil
+	}
+
+	return c.execute(ctx, correlationId, func(migrations []MongoDbMigration,
+		records map[int64]MongoDbMigrationRecord) ([]migrationStep, error) {
+
+		versions := make([]int64, 0, len(records))
+		for version := range records {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if count < len(versions) {
+			versions = versions[:count]
+		}
+		if len(versions) == 0 {
+			return nil, nil
+		}
+		if err := c.checkRevertible(correlationId, migrations, records, versions[len(versions)-1]-1); err != nil {
+			return nil, err
+		}
+
+		registered := make(map[int64]MongoDbMigration, len(migrations))
+		for _, migration := range migrations {
+			registered[migration.Version] = migration
+		}
+		steps := make([]migrationStep, 0, len(versions))
+		for _, version := range versions {
+			steps = append(steps, migrationStep{migration: registered[version], up: false})
+		}
+		return steps, nil
+	})
+}
+
+// checkRevertible checks that all applied migrations above a version are registered and can be reverted.
+func (c *MongoDbMigrator) checkRevertible(correlationId string, migrations []MongoDbMigration,
+	records map[int64]MongoDbMigrationRecord, version int64) error {
+
+	registered := make(map[int64]MongoDbMigration, len(migrations))
+	for _, migration := range migrations {
+		registered[migration.Version] = migration
+	}
+	for applied := range records {
+		if applied <= version {
+			continue
+		}
+		migration, ok := registered[applied]
+		if !ok {
+			return cerr.NewNotFoundError(correlationId, "UNKNOWN_MIGRATION",
+				"Applied migration "+strconv.FormatInt(applied, 10)+" is not registered").
+				WithDetails("version", applied)
+		}
+		if migration.Down == nil {
+			return cerr.NewBadRequestError(correlationId, "IRREVERSIBLE_MIGRATION",
+				"Migration "+strconv.FormatInt(applied, 10)+" can't be reverted").
+				WithDetails("version", applied)
+		}
+	}
+	return nil
+}
+
+// execute takes the lock, plans migration steps and runs them one by one recording the results.
+func (c *MongoDbMigrator) execute(ctx context.Context, correlationId string,
+	plan func(migrations []MongoDbMigration, records map[int64]MongoDbMigrationRecord) ([]migrationStep, error)) ([]MongoDbMigration, error) {
+
+	migrations, err := c.sortedMigrations(correlationId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.opened {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Migrator is not opened")
+	}
+
+	if err := c.acquireLock(ctx, correlationId); err != nil {
+		return nil, err
+	}
+	defer c.releaseLock(correlationId)
+
+	records, err := c.readRecords(ctx, correlationId)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := plan(migrations, records)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := c.Connection.Logger
+	done := make([]MongoDbMigration, 0, len(steps))
+	if len(steps) == 0 {
+		logger.Info(ctx, correlationId, "Database %s is up to date", c.Connection.GetDatabaseName())
+		return done, nil
+	}
+
+	for _, step := range steps {
+		action := "Reverting"
+		if step.up {
+			action = "Applying"
+		}
+		if c.dryRun {
+			logger.Info(ctx, correlationId, "Dry run: %s migration %d: %s", action, step.migration.Version, step.migration.Description)
+			done = append(done, step.migration)
+			continue
+		}
+
+		logger.Info(ctx, correlationId, "%s migration %d: %s", action, step.migration.Version, step.migration.Description)
+		if err := c.runStep(ctx, correlationId, step); err != nil {
+			logger.Error(ctx, correlationId, err, "Migration %d failed", step.migration.Version)
+			return done, err
+		}
+		done = append(done, step.migration)
+	}
+
+	logger.Info(ctx, correlationId, "Completed %d migrations of database %s", len(done), c.Connection.GetDatabaseName())
+	return done, nil
+}
+
+func (c *MongoDbMigrator) runStep(ctx context.Context, correlationId string, step migrationStep) error {
+	version := strconv.FormatInt(step.migration.Version, 10)
+	start := time.Now()
+
+	run := step.migration.Down
+	if step.up {
+		run = step.migration.Up
+	}
+	if err := run(ctx, c.Connection.GetDatabase()); err != nil {
+		return cerr.NewInternalError(correlationId, "MIGRATION_FAILED", "Migration "+version+" failed").
+			WithDetails("version", step.migration.Version).
+			WithCause(err)
+	}
+
+	var err error
+	if step.up {
+		_, err = c.Collection.InsertOne(ctx, MongoDbMigrationRecord{
+			Version:     step.migration.Version,
+			Description: step.migration.Description,
+			AppliedTime: start.UTC(),
+			Duration:    time.Since(start).Milliseconds(),
+		})
+	} else {
+		_, err = c.Collection.DeleteOne(ctx, bson.M{"_id": step.migration.Version})
+	}
+	if err != nil {
+		return cerr.NewConnectionError(correlationId, "MIGRATION_NOT_RECORDED",
+			"Migration "+version+" was run, but its record was not saved").
+			WithDetails("version", step.migration.Version).
+			WithCause(err)
+	}
+
+	c.Connection.Logger.Debug(ctx, correlationId, "Migration %d completed in %d ms", step.migration.Version, time.Since(start).Milliseconds())
+	return nil
+}
+
+// sortedMigrations validates registered migrations and sorts them by versions.
+func (c *MongoDbMigrator) sortedMigrations(correlationId string) ([]MongoDbMigration, error) {
+	migrations := append(make([]MongoDbMigration, 0, len(c.migrations)), c.migrations...)
+	sort.SliceStable(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version <= 0 || migration.Up == nil {
+			return nil, cerr.NewBadRequestError(correlationId, "INVALID_MIGRATION",
+				"Migration "+strconv.FormatInt(migration.Version, 10)+" must have positive version and up function").
+				WithDetails("version", migration.Version)
+		}
+		if i > 0 && migrations[i-1].Version == migration.Version {
+			return nil, cerr.NewBadRequestError(correlationId, "DUPLICATE_MIGRATION",
+				"Migration "+strconv.FormatInt(migration.Version, 10)+" is registered more than once").
+				WithDetails("version", migration.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// readRecords reads records about applied migrations.
+func (c *MongoDbMigrator) readRecords(ctx context.Context, correlationId string) (map[int64]MongoDbMigrationRecord, error) {
+	if !c.opened {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Migrator is not opened")
+	}
+
+	cursor, err := c.Collection.Find(ctx, bson.M{"_id": bson.M{"$type": "long"}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := make(map[int64]MongoDbMigrationRecord)
+	for cursor.Next(ctx) {
+		var record MongoDbMigrationRecord
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		records[record.Version] = record
+	}
+	return records, cursor.Err()
+}
+
+// acquireLock takes the migrations lock waiting while it's held by another instance.
+// The lock document can be inserted only when it doesn't exist or the previous lock has expired.
+func (c *MongoDbMigrator) acquireLock(ctx context.Context, correlationId string) error {
+	deadline := time.Now().Add(time.Duration(c.lockWaitTimeout) * time.Millisecond)
+	for {
+		now := time.Now().UTC()
+		_, err := c.Collection.UpdateOne(ctx,
+			bson.M{"_id": migrationLockId, "locked_until": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{
+				"owner":        c.owner,
+				"locked_until": now.Add(time.Duration(c.lockTimeout) * time.Millisecond),
+			}},
+			mongoopt.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		if !mongodrv.IsDuplicateKeyError(err) {
+			return cerr.NewConnectionError(correlationId, "LOCK_FAILED", "Failed to lock migrations").WithCause(err)
+		}
+		if time.Now().After(deadline) {
+			return cerr.NewConflictError(correlationId, "MIGRATIONS_LOCKED",
+				"Migrations in "+c.CollectionName+" are locked by another instance")
+		}
+
+		c.Connection.Logger.Debug(ctx, correlationId, "Waiting for migrations lock in %s", c.CollectionName)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.lockRetry):
+		}
+	}
+}
+
+// releaseLock removes the lock if it's still held by this instance.
+func (c *MongoDbMigrator) releaseLock(correlationId string) {
+	// The context may be already cancelled, so the lock is released with a separate one
+	_, err := c.Collection.DeleteOne(context.Background(), bson.M{"_id": migrationLockId, "owner": c.owner})
+	if err != nil {
+		c.Connection.Logger.Error(context.Background(), correlationId, err, "Failed to unlock migrations in %s", c.CollectionName)
+	}
+}
@@ -0,0 +1,14 @@
+package outbox
+
+import (
+	"context"
+)
+
+// IOutboxPublisher is an interface for components that publish outbox events
+// to external systems (message queues, event buses, etc).
+// MongoDbOutboxRelay resolves it by *:outbox-publisher:*:*:1.0 descriptor.
+type IOutboxPublisher interface {
+	// Publish publishes an outbox event.
+	// Returning error makes the relay retry the event later.
+	Publish(ctx context.Context, correlationId string, event OutboxEvent) error
+}
@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoDbOutbox writes events into the outbox collection.
+// To enqueue events atomically with other writes call Enqueue
+// with a session context inside a MongoDB transaction.
+//
+// Example:
+//	outbox := outbox.NewMongoDbOutbox(db.Collection("outbox"), "dummies")
+//	session, _ := client.StartSession()
+//	defer session.EndSession(ctx)
+//	_, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+//		if _, err := collection.InsertOne(ctx, item); err != nil {
+//			return nil, err
+//		}
+//		return nil, outbox.Enqueue(ctx, "123", outbox.NewOutboxEvent("created", item.Id, item))
+//	})
+type MongoDbOutbox struct {
+	// The outbox collection object.
+	Collection *mongodrv.Collection
+	// The default source of enqueued events.
+	Source string
+}
+
+// NewMongoDbOutbox creates a new outbox writer.
+//
+//	Parameters:
+//		- collection *mongodrv.Collection the outbox collection.
+//		- source string (optional) the default source of enqueued events.
+//	Returns: *MongoDbOutbox
+func NewMongoDbOutbox(collection *mongodrv.Collection, source string) *MongoDbOutbox {
+	return &MongoDbOutbox{
+		Collection: collection,
+		Source:     source,
+	}
+}
+
+// Enqueue writes events into the outbox collection with pending status.
+//
+//	Parameters:
+//		- ctx context.Context (session context to participate in a transaction)
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- events ...OutboxEvent events to enqueue.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbOutbox) Enqueue(ctx context.Context, correlationId string, events ...OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(events))
+	for _, event := range events {
+		if event.Id == "" {
+			event.Id = cdata.IdGenerator.NextLong()
+		}
+		if event.Source == "" {
+			event.Source = c.Source
+		}
+		if event.CorrelationId == "" {
+			event.CorrelationId = correlationId
+		}
+		event.Status = OutboxEventPending
+		event.Attempts = 0
+		event.CreateTime = now
+		event.NextAttemptTime = now
+		docs = append(docs, event)
+	}
+
+	_, err := c.Collection.InsertMany(ctx, docs)
+	return err
+}
@@ -0,0 +1,468 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDbOutboxRelay tails the outbox collection and hands pending events to IOutboxPublisher.
+// Successfully published events are marked as dispatched. Failed events are retried
+// with exponential backoff until maximum number of attempts is reached, then they are marked as failed.
+//
+// Events are claimed before publishing, so several relay instances can safely work
+// over the same outbox. Claims of crashed instances expire after lock timeout.
+// Every claim counts as an attempt, so events with expired claims are also marked as failed
+// after maximum number of attempts.
+// The relay polls the outbox with configured interval and, when watching is enabled,
+// also reacts immediately to inserted events using change streams.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) outbox collection name (default: outbox)
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- interval:                  (optional) polling interval in milliseconds (default: 1000)
+//			- batch_size:                (optional) maximum number of events dispatched in one pass (default: 100)
+//			- max_attempts:              (optional) maximum number of dispatch attempts (default: 10)
+//			- retry_delay:               (optional) initial retry delay in milliseconds (default: 1000)
+//			- max_retry_delay:           (optional) maximum retry delay in milliseconds (default: 300000)
+//			- lock_timeout:              (optional) timeout in milliseconds to claim an event (default: 60000)
+//			- watch:                     (optional) use change streams to react to new events (default: false)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:outbox-publisher:*:*:1.0 IOutboxPublisher to publish the events
+//		- *:connection:mongodb:*:1.0 (optional) shared MongoDB connection
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	relay := outbox.NewMongoDbOutboxRelay()
+//	relay.Configure(context.Background(), config.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//	))
+//	relay.SetPublisher(myPublisher)
+//	_ = relay.Open(context.Background(), "123")
+type MongoDbOutboxRelay struct {
+	defaultConfig   *cconf.ConfigParams
+	config          *cconf.ConfigParams
+	references      crefer.IReferences
+	opened          bool
+	localConnection bool
+	interval        int
+	batchSize       int
+	maxAttempts     int
+	retryDelay      int64
+	maxRetryDelay   int64
+	lockTimeout     int64
+	watch           bool
+	publisher       IOutboxPublisher
+	trigger         chan struct{}
+	cancel          context.CancelFunc
+	wait            sync.WaitGroup
+	lock            sync.Mutex
+
+	// The dependency resolver.
+	DependencyResolver *crefer.DependencyResolver
+	// The logger.
+	Logger *clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The outbox collection name.
+	CollectionName string
+	// The outbox collection object.
+	Collection *mongodrv.Collection
+}
+
+// NewMongoDbOutboxRelay creates a new instance of the outbox relay.
+//
+//	Returns: *MongoDbOutboxRelay
+func NewMongoDbOutboxRelay() *MongoDbOutboxRelay {
+	c := &MongoDbOutboxRelay{
+		defaultConfig: cconf.NewConfigParamsFromTuples(
+			"collection", "outbox",
+			"dependencies.connection", "*:connection:mongodb:*:1.0",
+			"dependencies.publisher", "*:outbox-publisher:*:*:1.0",
+		),
+		config:         cconf.NewEmptyConfigParams(),
+		interval:       1000,
+		batchSize:      100,
+		maxAttempts:    10,
+		retryDelay:     1000,
+		maxRetryDelay:  300000,
+		lockTimeout:    60000,
+		Logger:         clog.NewCompositeLogger(),
+		CollectionName: "outbox",
+	}
+	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, nil)
+	return c
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbOutboxRelay) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	config = config.SetDefaults(c.defaultConfig)
+	c.config = config
+	c.DependencyResolver.Configure(ctx, config)
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.interval = config.GetAsIntegerWithDefault("options.interval", c.interval)
+	c.batchSize = config.GetAsIntegerWithDefault("options.batch_size", c.batchSize)
+	c.maxAttempts = config.GetAsIntegerWithDefault("options.max_attempts", c.maxAttempts)
+	c.retryDelay = config.GetAsLongWithDefault("options.retry_delay", c.retryDelay)
+	c.maxRetryDelay = config.GetAsLongWithDefault("options.max_retry_delay", c.maxRetryDelay)
+	c.lockTimeout = config.GetAsLongWithDefault("options.lock_timeout", c.lockTimeout)
+	c.watch = config.GetAsBooleanWithDefault("options.watch", c.watch)
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MongoDbOutboxRelay) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(ctx, references)
+	c.DependencyResolver.SetReferences(ctx, references)
+
+	if publisher, ok := c.DependencyResolver.GetOneOptional("publisher").(IOutboxPublisher); ok && publisher != nil {
+		c.publisher = publisher
+	}
+
+	// try to get a connection
+	if conn, ok := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection); ok && conn != nil {
+		c.Connection = conn
+		c.localConnection = false
+		return
+	}
+	// or create a local one
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+}
+
+// UnsetReferences unsets (clears) previously set references to dependent components.
+func (c *MongoDbOutboxRelay) UnsetReferences() {
+	c.Connection = nil
+	c.publisher = nil
+}
+
+func (c *MongoDbOutboxRelay) createConnection(ctx context.Context) *conn.MongoDbConnection {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(ctx, c.config)
+	if c.references != nil {
+		connection.SetReferences(ctx, c.references)
+	}
+	return connection
+}
+
+// SetPublisher sets publisher of the events explicitly.
+//
+//	Parameters:
+//		- publisher IOutboxPublisher a publisher of the events.
+func (c *MongoDbOutboxRelay) SetPublisher(publisher IOutboxPublisher) {
+	c.publisher = publisher
+}
+
+// IsOpen checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MongoDbOutboxRelay) IsOpen() bool {
+	return c.opened
+}
+
+// Open opens the component and starts dispatching the events.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbOutboxRelay) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+
+	if c.publisher == nil {
+		return cerr.NewConfigError(correlationId, "NO_PUBLISHER", "Outbox publisher is not set")
+	}
+
+	if c.Connection == nil {
+		c.Connection = c.createConnection(ctx)
+		c.localConnection = true
+	}
+
+	if c.localConnection {
+		if err := c.Connection.Open(ctx, correlationId); err != nil {
+			return err
+		}
+	}
+
+	if !c.Connection.IsOpen() {
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+
+	c.Collection = c.Connection.GetDatabase().Collection(c.CollectionName)
+	_, err := c.Collection.Indexes().CreateOne(ctx, mongodrv.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_time", Value: 1}},
+	})
+	if err != nil {
+		c.Collection = nil
+		return cerr.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(err)
+	}
+
+	relayCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.trigger = make(chan struct{}, 1)
+
+	if c.watch {
+		stream, err := c.Collection.Watch(ctx, mongodrv.Pipeline{
+			{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+		})
+		if err != nil {
+			cancel()
+			c.Collection = nil
+			return cerr.NewConnectionError(correlationId, "WATCH_FAILED",
+				"Failed to watch outbox "+c.CollectionName).WithCause(err)
+		}
+		c.wait.Add(1)
+		go c.watchEvents(relayCtx, correlationId, stream)
+	}
+
+	c.wait.Add(1)
+	go c.run(relayCtx, correlationId)
+
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Started outbox relay on mongodb collection %s", c.CollectionName)
+	return nil
+}
+
+// Close stops dispatching the events and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbOutboxRelay) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+
+	c.cancel()
+	c.wait.Wait()
+	c.cancel = nil
+
+	c.opened = false
+	c.Collection = nil
+
+	if c.localConnection {
+		return c.Connection.Close(ctx, correlationId)
+	}
+	return nil
+}
+
+func (c *MongoDbOutboxRelay) watchEvents(ctx context.Context, correlationId string, stream *mongodrv.ChangeStream) {
+	defer c.wait.Done()
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		select {
+		case c.trigger <- struct{}{}:
+		default:
+		}
+	}
+	if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		c.Logger.Error(ctx, correlationId, err, "Watching outbox %s stopped", c.CollectionName)
+	}
+}
+
+func (c *MongoDbOutboxRelay) run(ctx context.Context, correlationId string) {
+	defer c.wait.Done()
+
+	ticker := time.NewTicker(time.Duration(c.interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.trigger:
+		}
+
+		if _, err := c.Dispatch(ctx, correlationId); err != nil && !errors.Is(err, context.Canceled) {
+			c.Logger.Error(ctx, correlationId, err, "Failed to dispatch events from %s", c.CollectionName)
+		}
+	}
+}
+
+// Dispatch makes a single pass over pending events and publishes them.
+// It is called periodically by the relay, but can also be called directly.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: int, error number of dispatched events and error, if they are occurred.
+func (c *MongoDbOutboxRelay) Dispatch(ctx context.Context, correlationId string) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Collection == nil {
+		return 0, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Outbox relay is not opened")
+	}
+
+	if err := c.failExpired(ctx, correlationId); err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	for i := 0; i < c.batchSize; i++ {
+		if ctx.Err() != nil {
+			return dispatched, ctx.Err()
+		}
+
+		event, ok, err := c.claim(ctx)
+		if err != nil {
+			return dispatched, err
+		}
+		if !ok {
+			break
+		}
+
+		if err := c.publisher.Publish(ctx, event.CorrelationId, event); err != nil {
+			c.Logger.Warn(ctx, event.CorrelationId, "Failed to publish event %s from %s: %s", event.Id, c.CollectionName, err.Error())
+			if err := c.reschedule(ctx, event, err); err != nil {
+				return dispatched, err
+			}
+			continue
+		}
+
+		if err := c.complete(ctx, event); err != nil {
+			return dispatched, err
+		}
+		dispatched++
+	}
+
+	if dispatched > 0 {
+		c.Logger.Trace(ctx, correlationId, "Dispatched %d events from %s", dispatched, c.CollectionName)
+	}
+	return dispatched, nil
+}
+
+func (c *MongoDbOutboxRelay) claim(ctx context.Context) (event OutboxEvent, ok bool, err error) {
+	now := time.Now().UTC()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": OutboxEventPending, "next_attempt_time": bson.M{"$lte": now}},
+		bson.M{"status": OutboxEventProcessing, "lock_time": bson.M{"$lte": now}, "attempts": bson.M{"$lt": c.maxAttempts}},
+	}}
+	// Every claim is counted as an attempt, so events which publishing never completes
+	// because of crashes or hangs also reach the maximum number of attempts
+	update := bson.M{
+		"$set": bson.M{
+			"status":    OutboxEventProcessing,
+			"lock_time": now.Add(time.Duration(c.lockTimeout) * time.Millisecond),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	options := mongoopt.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "create_time", Value: 1}}).
+		SetReturnDocument(mongoopt.After)
+
+	res := c.Collection.FindOneAndUpdate(ctx, filter, update, options)
+	if err := res.Decode(&event); err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			return event, false, nil
+		}
+		return event, false, err
+	}
+	return event, true, nil
+}
+
+func (c *MongoDbOutboxRelay) complete(ctx context.Context, event OutboxEvent) error {
+	_, err := c.Collection.UpdateOne(ctx,
+		bson.M{"_id": event.Id, "status": OutboxEventProcessing},
+		bson.M{
+			"$set":   bson.M{"status": OutboxEventDispatched, "dispatch_time": time.Now().UTC()},
+			"$unset": bson.M{"lock_time": "", "last_error": ""},
+		},
+	)
+	return err
+}
+
+// failExpired marks events as failed when their claims expired after the last allowed attempt.
+func (c *MongoDbOutboxRelay) failExpired(ctx context.Context, correlationId string) error {
+	res, err := c.Collection.UpdateMany(ctx,
+		bson.M{
+			"status":    OutboxEventProcessing,
+			"lock_time": bson.M{"$lte": time.Now().UTC()},
+			"attempts":  bson.M{"$gte": c.maxAttempts},
+		},
+		bson.M{
+			"$set":   bson.M{"status": OutboxEventFailed, "last_error": "Claim expired before the event was published"},
+			"$unset": bson.M{"lock_time": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		c.Logger.Warn(ctx, correlationId, "Marked %d events with expired claims as failed in %s", res.ModifiedCount, c.CollectionName)
+	}
+	return nil
+}
+
+func (c *MongoDbOutboxRelay) reschedule(ctx context.Context, event OutboxEvent, cause error) error {
+	// The attempt was already counted when the event was claimed
+	attempts := event.Attempts
+	status := OutboxEventPending
+	if attempts >= c.maxAttempts {
+		status = OutboxEventFailed
+	}
+
+	_, err := c.Collection.UpdateOne(ctx,
+		bson.M{"_id": event.Id, "status": OutboxEventProcessing},
+		bson.M{
+			"$set": bson.M{
+				"status":            status,
+				"attempts":          attempts,
+				"next_attempt_time": time.Now().UTC().Add(c.retryDelayFor(attempts)),
+				"last_error":        cause.Error(),
+			},
+			"$unset": bson.M{"lock_time": ""},
+		},
+	)
+	return err
+}
+
+func (c *MongoDbOutboxRelay) retryDelayFor(attempts int) time.Duration {
+	delay := c.retryDelay
+	for i := 1; i < attempts && delay < c.maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.maxRetryDelay {
+		delay = c.maxRetryDelay
+	}
+	return time.Duration(delay) * time.Millisecond
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Statuses of outbox events
+const (
+	// OutboxEventPending the event waits to be dispatched
+	OutboxEventPending = "pending"
+	// OutboxEventProcessing the event is being dispatched by a relay
+	OutboxEventProcessing = "processing"
+	// OutboxEventDispatched the event was successfully dispatched
+	OutboxEventDispatched = "dispatched"
+	// OutboxEventFailed the event exceeded maximum number of dispatch attempts
+	OutboxEventFailed = "failed"
+)
+
+// OutboxEvent is a domain event stored in the outbox collection
+// until it is dispatched by MongoDbOutboxRelay.
+type OutboxEvent struct {
+	Id              string    `bson:"_id" json:"id"`
+	Type            string    `bson:"type" json:"type"`
+	Source          string    `bson:"source" json:"source"`
+	ObjectId        any       `bson:"object_id,omitempty" json:"object_id"`
+	Payload         any       `bson:"payload,omitempty" json:"payload"`
+	CorrelationId   string    `bson:"correlation_id,omitempty" json:"correlation_id"`
+	Status          string    `bson:"status" json:"status"`
+	Attempts        int       `bson:"attempts" json:"attempts"`
+	CreateTime      time.Time `bson:"create_time" json:"create_time"`
+	NextAttemptTime time.Time `bson:"next_attempt_time" json:"next_attempt_time"`
+	LockTime        time.Time `bson:"lock_time,omitempty" json:"lock_time"`
+	DispatchTime    time.Time `bson:"dispatch_time,omitempty" json:"dispatch_time"`
+	LastError       string    `bson:"last_error,omitempty" json:"last_error"`
+}
+
+// NewOutboxEvent creates a new outbox event.
+//
+//	Parameters:
+//		- eventType string a type of the event.
+//		- objectId any an id of the object the event relates to.
+//		- payload any event payload.
+//	Returns: OutboxEvent
+func NewOutboxEvent(eventType string, objectId any, payload any) OutboxEvent {
+	return OutboxEvent{
+		Type:     eventType,
+		ObjectId: objectId,
+		Payload:  payload,
+	}
+}
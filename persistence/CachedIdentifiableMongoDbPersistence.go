@@ -0,0 +1,610 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cconv "github.com/pip-services3-gox/pip-services3-commons-gox/convert"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	ccache "github.com/pip-services3-gox/pip-services3-components-gox/cache"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+)
+
+// CachedIdentifiableMongoDbPersistence is IdentifiableMongoDbPersistence that caches
+// data items retrieved by ids in ICache resolved from references.
+//
+// GetOneById and GetListByIds read items from the cache and store missing ones after reading them from MongoDB.
+// Created items are written to the cache, updated and deleted items are removed from it.
+// Items changed by filters or by other instances are removed only when watching of change streams is enabled,
+// otherwise they stay in the cache until the timeout expires.
+// Reads and creates inside transactions bypass the cache, so uncommitted changes are never cached.
+// Items changed inside transactions started by ExecuteInTransaction are removed from the cache again
+// after commit, so values cached by concurrent readers before the commit are not kept.
+// When no cache is referenced the persistence works as IdentifiableMongoDbPersistence.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB collection name
+//		- connection(s):               see IdentifiableMongoDbPersistence
+//		- credential(s):               see IdentifiableMongoDbPersistence
+//		- options:                     see IdentifiableMongoDbPersistence
+//		- cache:
+//			- timeout:                   (optional) time to keep items in the cache in milliseconds (default: 60000)
+//			- key_prefix:                (optional) prefix of cache keys (default: collection name)
+//			- watch:                     (optional) remove items changed by other instances using change streams (default: false)
+//
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:cache:*:*:1.0            (optional) ICache[T] to cache data items
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	type MyCachedMongoDbPersistence struct {
+//		*persist.CachedIdentifiableMongoDbPersistence[MyData, string]
+//	}
+//
+//	func NewMyCachedMongoDbPersistence() *MyCachedMongoDbPersistence {
+//		c := &MyCachedMongoDbPersistence{}
+//		c.CachedIdentifiableMongoDbPersistence = persist.InheritCachedIdentifiableMongoDbPersistence[MyData, string](c, "mydata")
+//		return c
+//	}
+//
+//	func main() {
+//		persistence := NewMyCachedMongoDbPersistence()
+//		persistence.Configure(context.Background(), config.NewConfigParamsFromTuples(
+//			"connection.host", "localhost",
+//			"connection.port", 27017,
+//			"cache.timeout", 30000,
+//		))
+//		persistence.SetCache(cache.NewMemoryCache[MyData]())
+//
+//		_ = persistence.Open(context.Background(), "123")
+//		item, err := persistence.GetOneById(context.Background(), "123", "1")
+//	}
+type CachedIdentifiableMongoDbPersistence[T any, K any] struct {
+	*IdentifiableMongoDbPersistence[T, K]
+
+	cache     ccache.ICache[T]
+	timeout   int64
+	keyPrefix string
+	watch     bool
+	cancel    context.CancelFunc
+	wait      sync.WaitGroup
+}
+
+// InheritCachedIdentifiableMongoDbPersistence creates a new instance of the cached persistence component.
+//
+//	Parameters:
+//		- overrides IMongoDbPersistenceOverrides overrided mongodb persistence
+//		- collection string a collection name.
+//	Returns: *CachedIdentifiableMongoDbPersistence[T, K] new created CachedIdentifiableMongoDbPersistence component
+func InheritCachedIdentifiableMongoDbPersistence[T any, K any](overrides IMongoDbPersistenceOverrides[T],
+	collection string) *CachedIdentifiableMongoDbPersistence[T, K] {
+
+	c := CachedIdentifiableMongoDbPersistence[T, K]{}
+	c.IdentifiableMongoDbPersistence = InheritIdentifiableMongoDbPersistence[T, K](overrides, collection)
+	c.DependencyResolver.Put(context.Background(), "cache", crefer.NewDescriptor("*", "cache", "*", "*", "1.0"))
+	c.timeout = 60000
+	return &c
+}
+
+// Configure is configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	c.IdentifiableMongoDbPersistence.Configure(ctx, config)
+	c.timeout = config.GetAsLongWithDefault("cache.timeout", c.timeout)
+	c.keyPrefix = config.GetAsStringWithDefault("cache.key_prefix", c.keyPrefix)
+	c.watch = config.GetAsBooleanWithDefault("cache.watch", c.watch)
+}
+
+// SetReferences sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.IdentifiableMongoDbPersistence.SetReferences(ctx, references)
+	if cache, ok := c.DependencyResolver.GetOneOptional("cache").(ccache.ICache[T]); ok && cache != nil {
+		c.cache = cache
+	}
+}
+
+// SetCache sets the cache to keep data items.
+//
+//	Parameters:
+//		- cache ccache.ICache[T] a cache or nil to turn caching off.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) SetCache(cache ccache.ICache[T]) {
+	c.cache = cache
+}
+
+// Open opens the component and starts watching changes when it is enabled.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Open(ctx context.Context, correlationId string) error {
+	if c.IsOpen() {
+		return nil
+	}
+	if c.watch && c.tenancyMode != TenancyNone {
+		return cerr.NewConfigError(correlationId, "UNSUPPORTED_TENANCY",
+			"Watching cached items is not supported with tenancy mode "+string(c.tenancyMode))
+	}
+
+	if err := c.IdentifiableMongoDbPersistence.Open(ctx, correlationId); err != nil {
+		return err
+	}
+	if !c.watch || c.cache == nil {
+		return nil
+	}
+
+	stream, err := c.Collection.Watch(ctx, mongodrv.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"update", "replace", "delete"}}}}},
+	})
+	if err != nil {
+		_ = c.IdentifiableMongoDbPersistence.Close(ctx, correlationId)
+		return cerr.NewConnectionError(correlationId, "WATCH_FAILED",
+			"Failed to watch collection "+c.CollectionName).WithCause(err)
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wait.Add(1)
+	go c.watchChanges(watchCtx, correlationId, stream)
+	return nil
+}
+
+// Close stops watching changes and closes the component.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Close(ctx context.Context, correlationId string) error {
+	if c.cancel != nil {
+		c.cancel()
+		c.wait.Wait()
+		c.cancel = nil
+	}
+	return c.IdentifiableMongoDbPersistence.Close(ctx, correlationId)
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) watchChanges(ctx context.Context, correlationId string,
+	stream *mongodrv.ChangeStream) {
+
+	defer c.wait.Done()
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change struct {
+			DocumentKey struct {
+				Id any `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			c.Logger.Error(ctx, correlationId, err, "Failed to decode change of %s", c.CollectionName)
+			continue
+		}
+
+		id := change.DocumentKey.Id
+		if c.toPublicId != nil {
+			id = c.toPublicId(id)
+		}
+		if err := c.cache.Remove(ctx, correlationId, c.cacheKey(ctx, id)); err != nil {
+			c.Logger.Error(ctx, correlationId, err, "Failed to remove changed item %v of %s from cache", id, c.CollectionName)
+		}
+	}
+	if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		c.Logger.Error(ctx, correlationId, err, "Watching changes of %s stopped", c.CollectionName)
+	}
+}
+
+// Invalidate removes a data item from the cache.
+// Call it after changing the item with other operations than provided by the persistence.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be removed from the cache.
+//	Returns: error or nil for success.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Invalidate(ctx context.Context, correlationId string, id K) error {
+	if c.cache == nil {
+		return nil
+	}
+	return c.cache.Remove(ctx, correlationId, c.cacheKey(ctx, id))
+}
+
+// GetOneById is gets a data item by its unique id from the cache or from MongoDB.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be retrieved.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error a data and error, if they are occurred.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) GetOneById(ctx context.Context, correlationId string,
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	if !c.useCache(ctx) {
+		return c.IdentifiableMongoDbPersistence.GetOneById(ctx, correlationId, id, queryOptions...)
+	}
+
+	key := c.cacheKey(ctx, id)
+	if item, ok := c.retrieve(ctx, correlationId, key); ok {
+		c.Logger.Trace(ctx, correlationId, "Retrieved from cache of %s by id = %s", c.CollectionName, id)
+		return item, nil
+	}
+
+	item, err = c.IdentifiableMongoDbPersistence.GetOneById(ctx, correlationId, id, queryOptions...)
+	if err != nil {
+		return item, err
+	}
+	if _, found := c.itemKey(ctx, item); found {
+		c.store(ctx, correlationId, key, item)
+	}
+	return item, nil
+}
+
+// GetListByIds is gets a list of data items by given unique ids.
+// Items missing in the cache are read from MongoDB in a single query.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- ids []K ids of data items to be retrieved
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: items []T, err error a data list and error, if they are occurred.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) GetListByIds(ctx context.Context, correlationId string,
+	ids []K, queryOptions ...MongoDbQueryOption) (items []T, err error) {
+
+	if !c.useCache(ctx) {
+		return c.IdentifiableMongoDbPersistence.GetListByIds(ctx, correlationId, ids, queryOptions...)
+	}
+
+	keys := make([]string, 0, len(ids))
+	found := make(map[string]T, len(ids))
+	missing := make([]K, 0)
+	for _, id := range ids {
+		key := c.cacheKey(ctx, id)
+		if _, ok := found[key]; ok {
+			continue
+		}
+		keys = append(keys, key)
+		if item, ok := c.retrieve(ctx, correlationId, key); ok {
+			found[key] = item
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		loaded, loadErr := c.IdentifiableMongoDbPersistence.GetListByIds(ctx, correlationId, missing, queryOptions...)
+		if loadErr != nil && loaded == nil {
+			return nil, loadErr
+		}
+		// Decode errors collected by the persistence are returned together with the items
+		err = loadErr
+		for _, item := range loaded {
+			if key, ok := c.itemKey(ctx, item); ok {
+				found[key] = item
+				c.store(ctx, correlationId, key, item)
+			}
+		}
+	}
+
+	items = make([]T, 0, len(found))
+	for _, key := range keys {
+		if item, ok := found[key]; ok {
+			items = append(items, item)
+		}
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d from %s with %d from cache", len(items), c.CollectionName, len(keys)-len(missing))
+	return items, err
+}
+
+// Create creates a data item and writes it to the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error created item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Create(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.Create(ctx, correlationId, item, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.cacheCreated(ctx, correlationId, result)
+	return result, nil
+}
+
+// Set sets a data item and removes it from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be set.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error updated item and error, if they occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Set(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.Set(ctx, correlationId, item, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.invalidateItem(ctx, correlationId, result)
+	return result, nil
+}
+
+// Update updates a data item and removes it from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error updated item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) Update(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.Update(ctx, correlationId, item, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.invalidateItem(ctx, correlationId, item)
+	return result, nil
+}
+
+// UpdatePartially updates only few selected fields in a data item and removes it from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be updated.
+//		- data cdata.AnyValueMap a map with fields to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) UpdatePartially(ctx context.Context, correlationId string,
+	id K, data cdata.AnyValueMap, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	item, err = c.IdentifiableMongoDbPersistence.UpdatePartially(ctx, correlationId, id, data, queryOptions...)
+	if err != nil {
+		return item, err
+	}
+	c.invalidateId(ctx, correlationId, id)
+	return item, nil
+}
+
+// UpdatePartiallyWithBuilder updates a data item with atomic update operators
+// composed by the update builder and removes it from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be updated.
+//		- update *MongoDbUpdateBuilder update builder with operators to be applied.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) UpdatePartiallyWithBuilder(ctx context.Context, correlationId string,
+	id K, update *MongoDbUpdateBuilder, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	item, err = c.IdentifiableMongoDbPersistence.UpdatePartiallyWithBuilder(ctx, correlationId, id, update, queryOptions...)
+	if err != nil {
+		return item, err
+	}
+	c.invalidateId(ctx, correlationId, id)
+	return item, nil
+}
+
+// DeleteById deletes a data item by it's unique id and removes it from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K id of the item to be deleted
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error deleted item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) DeleteById(ctx context.Context, correlationId string,
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	item, err = c.IdentifiableMongoDbPersistence.DeleteById(ctx, correlationId, id, queryOptions...)
+	if err != nil {
+		return item, err
+	}
+	c.invalidateId(ctx, correlationId, id)
+	return item, nil
+}
+
+// DeleteByIds deletes multiple data items by their unique ids and removes them from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- ids []K ids of data items to be deleted.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: error or nil for success.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) DeleteByIds(ctx context.Context, correlationId string,
+	ids []K, queryOptions ...MongoDbQueryOption) error {
+
+	if err := c.IdentifiableMongoDbPersistence.DeleteByIds(ctx, correlationId, ids, queryOptions...); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		c.invalidateId(ctx, correlationId, id)
+	}
+	return nil
+}
+
+// CreateWithEvents creates a data item, enqueues events in the same transaction and writes the item to the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be created.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the created item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error created item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) CreateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.CreateWithEvents(ctx, correlationId, item, events, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.cacheCreated(ctx, correlationId, result)
+	return result, nil
+}
+
+// UpdateWithEvents updates a data item, enqueues events in the same transaction and removes the item from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be updated.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the updated item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error updated item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) UpdateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.UpdateWithEvents(ctx, correlationId, item, events, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.invalidateItem(ctx, correlationId, item)
+	return result, nil
+}
+
+// DeleteByIdWithEvents deletes a data item, enqueues events in the same transaction and removes the item from the cache.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K id of the item to be deleted
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the deleted item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error deleted item and error, if they are occurred
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) DeleteByIdWithEvents(ctx context.Context, correlationId string,
+	id K, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	result, err = c.IdentifiableMongoDbPersistence.DeleteByIdWithEvents(ctx, correlationId, id, events, queryOptions...)
+	if err != nil {
+		return result, err
+	}
+	c.invalidateId(ctx, correlationId, id)
+	return result, nil
+}
+
+// useCache checks if reads can use the cache.
+// Reads inside transactions may see uncommitted changes, so they are never cached.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) useCache(ctx context.Context) bool {
+	return c.cache != nil && mongodrv.SessionFromContext(ctx) == nil
+}
+
+// cacheKey composes a cache key from the collection, the tenant and the item id.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) cacheKey(ctx context.Context, id any) string {
+	prefix := c.keyPrefix
+	if prefix == "" {
+		prefix = c.CollectionName
+	}
+	if c.tenancyMode != TenancyNone {
+		prefix += ":" + GetTenantId(ctx)
+	}
+
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		return prefix + ":" + v.Hex()
+	case fmt.Stringer:
+		return prefix + ":" + v.String()
+	}
+	return prefix + ":" + cconv.StringConverter.ToString(id)
+}
+
+// itemKey composes a cache key from the id of a data item.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) itemKey(ctx context.Context, item T) (string, bool) {
+	doc, err := c.Overrides.ConvertFromPublic(item)
+	if err != nil || isEmptyId(doc["_id"]) {
+		return "", false
+	}
+	return c.cacheKey(ctx, doc["_id"]), true
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) retrieve(ctx context.Context, correlationId string, key string) (T, bool) {
+	var item T
+	if !c.cache.Contains(ctx, correlationId, key) {
+		return item, false
+	}
+	item, err := c.cache.Retrieve(ctx, correlationId, key)
+	if err != nil {
+		c.Logger.Warn(ctx, correlationId, "Failed to retrieve %s from cache: %v", key, err)
+		return item, false
+	}
+	return item, true
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) store(ctx context.Context, correlationId string, key string, item T) {
+	if _, err := c.cache.Store(ctx, correlationId, key, item, c.timeout); err != nil {
+		c.Logger.Warn(ctx, correlationId, "Failed to store %s in cache: %v", key, err)
+	}
+}
+
+// cacheCreated writes a created item to the cache. Items created inside transactions
+// are not cached, as the transaction may be aborted.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) cacheCreated(ctx context.Context, correlationId string, item T) {
+	if !c.useCache(ctx) {
+		return
+	}
+	if key, ok := c.itemKey(ctx, item); ok {
+		c.store(ctx, correlationId, key, item)
+	}
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) invalidateItem(ctx context.Context, correlationId string, item T) {
+	if c.cache == nil {
+		return
+	}
+	if key, ok := c.itemKey(ctx, item); ok {
+		c.remove(ctx, correlationId, key)
+	}
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) invalidateId(ctx context.Context, correlationId string, id K) {
+	if c.cache == nil {
+		return
+	}
+	c.remove(ctx, correlationId, c.cacheKey(ctx, id))
+}
+
+// remove invalidates a cached item. Inside transactions the item is invalidated again after commit,
+// so values cached by concurrent readers before the commit don't outlive the change.
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) remove(ctx context.Context, correlationId string, key string) {
+	c.removeKey(ctx, correlationId, key)
+	if mongodrv.SessionFromContext(ctx) != nil {
+		afterCommit(ctx, func() {
+			c.removeKey(context.Background(), correlationId, key)
+		})
+	}
+}
+
+func (c *CachedIdentifiableMongoDbPersistence[T, K]) removeKey(ctx context.Context, correlationId string, key string) {
+	// Failed invalidation leaves a stale item that expires with the timeout
+	if err := c.cache.Remove(ctx, correlationId, key); err != nil {
+		c.Logger.Warn(ctx, correlationId, "Failed to remove %s from cache: %v", key, err)
+	}
+}
@@ -0,0 +1,20 @@
+package persistence
+
+// DecodeErrorPolicy defines how read operations handle documents
+// that can't be decoded or converted to public objects.
+//
+//	Configuration values of options.decode_error_policy:
+//		- skip:    skips the document and logs the error (default)
+//		- collect: skips the document and returns read items with an error that lists all failed documents
+//		- fail:    stops reading and returns the error of the first failed document
+type DecodeErrorPolicy string
+
+const (
+	// DecodeErrorSkip skips undecodable documents and logs the errors.
+	DecodeErrorSkip DecodeErrorPolicy = "skip"
+	// DecodeErrorCollect skips undecodable documents and returns read items
+	// together with an error that lists all failed documents.
+	DecodeErrorCollect DecodeErrorPolicy = "collect"
+	// DecodeErrorFail stops reading on the first undecodable document and returns its error.
+	DecodeErrorFail DecodeErrorPolicy = "fail"
+)
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IIdStrategy defines a strategy to generate unique ids for new data items
+// in IdentifiableMongoDbPersistence.
+//
+//	Configuration values of options.id_strategy:
+//		- long:     32 hex characters long id generated by cdata.IdGenerator.NextLong (default)
+//		- short:    9 digits long id generated by cdata.IdGenerator.NextShort
+//		- objectid: MongoDB ObjectID, exposed as hex string when the persistence id type is string
+//		- uuid4:    random UUID version 4
+//		- uuid7:    time ordered UUID version 7
+//		- ulid:     time ordered ULID in Crockford's base32
+//		- none:     ids are not generated and must be set by the caller
+type IIdStrategy interface {
+	// NextId generates a new unique id.
+	NextId() any
+}
+
+// IdStrategyFunc is an adapter to use a function as IIdStrategy.
+//
+// Example:
+//	persistence.SetIdStrategy(persist.IdStrategyFunc(func() any {
+//		return "dummy-" + cdata.IdGenerator.NextShort()
+//	}))
+type IdStrategyFunc func() any
+
+// NextId generates a new unique id by calling the function.
+func (f IdStrategyFunc) NextId() any {
+	return f()
+}
+
+type objectIdStrategy struct{}
+
+func (objectIdStrategy) NextId() any {
+	return primitive.NewObjectID()
+}
+
+var (
+	// LongIdStrategy generates 32 hex characters long ids.
+	LongIdStrategy IIdStrategy = IdStrategyFunc(func() any { return cdata.IdGenerator.NextLong() })
+	// ShortIdStrategy generates 9 digits long ids.
+	ShortIdStrategy IIdStrategy = IdStrategyFunc(func() any { return cdata.IdGenerator.NextShort() })
+	// ObjectIdStrategy generates MongoDB ObjectIDs.
+	ObjectIdStrategy IIdStrategy = objectIdStrategy{}
+	// UuidV4IdStrategy generates random UUIDs version 4.
+	UuidV4IdStrategy IIdStrategy = IdStrategyFunc(func() any { return uuid.NewString() })
+	// UuidV7IdStrategy generates time ordered UUIDs version 7.
+	UuidV7IdStrategy IIdStrategy = IdStrategyFunc(func() any { return newUuidV7() })
+	// UlidIdStrategy generates time ordered ULIDs.
+	UlidIdStrategy IIdStrategy = IdStrategyFunc(func() any { return newUlid() })
+)
+
+// NewIdStrategy gets an id strategy by its configuration name.
+//
+//	Parameters:
+//		- name string a strategy name: long, short, objectid, uuid4, uuid7 or ulid.
+//	Returns: strategy IIdStrategy, ok bool the strategy and true if the name is known.
+func NewIdStrategy(name string) (strategy IIdStrategy, ok bool) {
+	switch strings.ToLower(name) {
+	case "long":
+		return LongIdStrategy, true
+	case "short":
+		return ShortIdStrategy, true
+	case "objectid":
+		return ObjectIdStrategy, true
+	case "uuid", "uuid4":
+		return UuidV4IdStrategy, true
+	case "uuid7":
+		return UuidV7IdStrategy, true
+	case "ulid":
+		return UlidIdStrategy, true
+	}
+	return nil, false
+}
+
+// timeOrderedBytes fills 16 bytes with 48 bit unix time in milliseconds followed by random bits.
+func timeOrderedBytes() [16]byte {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(b[:6], ts[2:])
+	return b
+}
+
+func newUuidV7() string {
+	b := timeOrderedBytes()
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+	return uuid.UUID(b).String()
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func newUlid() string {
+	b := timeOrderedBytes()
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// 128 bits are encoded into 26 characters by 5 bits from the lowest ones
+	var result [26]byte
+	for i := 25; i >= 0; i-- {
+		result[i] = crockfordAlphabet[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+	return string(result[:])
+}
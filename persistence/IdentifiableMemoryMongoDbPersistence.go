@@ -0,0 +1,470 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdentifiableMemoryMongoDbPersistence is an in-memory fake of IdentifiableMongoDbPersistence for unit tests.
+// It implements the same CRUD operations over data items with unique ids,
+// so child persistence components can be tested with the same fixtures against both backends.
+// Events enqueued with EnqueueEvents and *WithEvents methods are kept in memory
+// and can be read with GetEnqueuedEvents.
+//
+// See MemoryMongoDbPersistence for supported query and update operators.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) collection name
+//		- options:
+//			- max_page_size:             (optional) maximum page size (default: 100)
+//			- id_strategy:               (optional) id generation strategy: long, short, objectid, uuid4, uuid7, ulid or none (default: long)
+//
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//
+// Example:
+//	type MyMemoryPersistence struct {
+//		*persist.IdentifiableMemoryMongoDbPersistence[test_persistence.Dummy, string]
+//	}
+//
+//	func NewMyMemoryPersistence() *MyMemoryPersistence {
+//		c := &MyMemoryPersistence{}
+//		c.IdentifiableMemoryMongoDbPersistence = persist.InheritIdentifiableMemoryMongoDbPersistence[test_persistence.Dummy, string](c, "dummies")
+//		return c
+//	}
+//
+//	func (c *MyMemoryPersistence) GetPageByFilter(ctx context.Context, correlationId string, filter cdata.FilterParams, paging cdata.PagingParams) (page cdata.DataPage[test_persistence.Dummy], err error) {
+//		return c.IdentifiableMemoryMongoDbPersistence.GetPageByFilter(ctx, correlationId, composeFilter(filter), paging,
+//			bson.M{"key": -1}, nil)
+//	}
+type IdentifiableMemoryMongoDbPersistence[T any, K any] struct {
+	*MemoryMongoDbPersistence[T]
+
+	// Flag to turn on automated string ID generation
+	_autoGenerateId bool
+	// The strategy to generate ids for new data items
+	idStrategy IIdStrategy
+	// Flag to store string ids as ObjectIDs and expose them as hex strings
+	objectIdAsHex bool
+	// The configured id strategy that is not known, it fails Open
+	unknownIdStrategy string
+}
+
+// InheritIdentifiableMemoryMongoDbPersistence is creates a new instance of the in-memory persistence component.
+//
+//	Parameters:
+//		- overrides IMongoDbPersistenceOverrides[T] a child component with overridden conversions.
+//		- collection string (optional) a collection name.
+//	Returns: *IdentifiableMemoryMongoDbPersistence[T, K] new created IdentifiableMemoryMongoDbPersistence component
+func InheritIdentifiableMemoryMongoDbPersistence[T any, K any](overrides IMongoDbPersistenceOverrides[T], collection string) *IdentifiableMemoryMongoDbPersistence[T, K] {
+	if collection == "" {
+		panic("Collection name could not be nil")
+	}
+	c := IdentifiableMemoryMongoDbPersistence[T, K]{}
+	c.MemoryMongoDbPersistence = InheritMemoryMongoDbPersistence(overrides, collection)
+	c._autoGenerateId = true
+	c.idStrategy = LongIdStrategy
+	return &c
+}
+
+// Configure is configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config  *cconf.ConfigParams configuration parameters to be set.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	c.MemoryMongoDbPersistence.Configure(ctx, config)
+
+	if name, ok := config.GetAsNullableString("options.id_strategy"); ok && name != "" {
+		c.unknownIdStrategy = ""
+		if name == "none" {
+			c._autoGenerateId = false
+		} else if strategy, ok := NewIdStrategy(name); ok {
+			c._autoGenerateId = true
+			c.SetIdStrategy(strategy)
+		} else {
+			c.unknownIdStrategy = name
+		}
+	}
+}
+
+// Open opens the component after the configured id strategy is checked.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) Open(ctx context.Context, correlationId string) error {
+	if c.unknownIdStrategy != "" {
+		return cerr.NewConfigError(correlationId, "INVALID_ID_STRATEGY", "Unknown id strategy "+c.unknownIdStrategy).
+			WithDetails("strategy", c.unknownIdStrategy)
+	}
+	return c.MemoryMongoDbPersistence.Open(ctx, correlationId)
+}
+
+// SetAutoGenerateId turns on or off generation of ids for new data items with empty ids.
+//
+//	Parameters:
+//		- value bool true to generate ids.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) SetAutoGenerateId(value bool) {
+	c._autoGenerateId = value
+}
+
+// SetIdStrategy sets the strategy to generate ids for new data items.
+// When ObjectIdStrategy is used with string ids, the ids are stored as ObjectIDs
+// and converted to hex strings on read.
+//
+//	Parameters:
+//		- strategy IIdStrategy an id generation strategy.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) SetIdStrategy(strategy IIdStrategy) {
+	c.idStrategy = strategy
+	c.unknownIdStrategy = ""
+
+	_, isObjectId := strategy.(objectIdStrategy)
+	var id K
+	_, isString := any(id).(string)
+	c.objectIdAsHex = isObjectId && isString
+	if c.objectIdAsHex {
+		c.toPublicId = objectIdToHex
+	} else {
+		c.toPublicId = nil
+	}
+}
+
+// generateId sets a new id to the item if it has no id and generation is turned on.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) generateId(newItem map[string]any) {
+	val, ok := newItem["_id"]
+	if (!ok || isEmptyId(val)) && c._autoGenerateId {
+		newItem["_id"] = c.idStrategy.NextId()
+	} else if ok {
+		newItem["_id"] = c.toStoredId(val)
+	}
+}
+
+// toStoredId converts a public id into the stored one.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) toStoredId(id any) any {
+	if !c.objectIdAsHex {
+		return id
+	}
+	if hex, ok := id.(string); ok {
+		if oid, err := primitive.ObjectIDFromHex(hex); err == nil {
+			return oid
+		}
+	}
+	return id
+}
+
+// toStoredIds converts public ids into the stored ones.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) toStoredIds(ids []K) []any {
+	result := make([]any, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, c.toStoredId(id))
+	}
+	return result
+}
+
+// GetListByIds is gets a list of data items retrieved by given unique ids.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- ids  []K ids of data items to be retrieved
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: items []T, err error a data list and error, if they are occurred.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) GetListByIds(ctx context.Context, correlationId string,
+	ids []K, queryOptions ...MongoDbQueryOption) (items []T, err error) {
+
+	filter := bson.M{
+		"_id": bson.M{"$in": c.toStoredIds(ids)},
+	}
+	return c.GetListByFilter(ctx, correlationId, filter, nil, nil)
+}
+
+// GetOneById is gets a data item by its unique id.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId     (optional) transaction id to Trace execution through call chain.
+//		- id                an id of data item to be retrieved.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, err error a data and error, if they are occurred.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) GetOneById(ctx context.Context, correlationId string,
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	item, found, err := c.GetOneByFilter(ctx, correlationId, bson.M{"_id": c.toStoredId(id)}, nil)
+	if err != nil || !found {
+		return item, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved from %s by id = %s", c.CollectionName, id)
+	return item, nil
+}
+
+// Create was creates a data item.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- item any an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result any, err error created item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) Create(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	doc, err := c.toDocument(correlationId, item)
+	if err != nil {
+		return result, err
+	}
+	if err := c.insert(ctx, correlationId, doc); err != nil {
+		return result, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Created in %s with id = %s", c.CollectionName, doc["_id"])
+	return c.decodeDocument(correlationId, doc, nil)
+}
+
+// Set is sets a data item. If the data item exists it updates it,
+// otherwise it create a new data item.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be set.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result any, err error updated item and error, if they occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) Set(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	doc, err := c.toDocument(correlationId, item)
+	if err != nil {
+		return result, err
+	}
+	if err := c.replace(ctx, correlationId, doc); err != nil {
+		return result, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Set in %s with id = %s", c.CollectionName, doc["_id"])
+	return c.decodeDocument(correlationId, doc, nil)
+}
+
+// Update is updates a data item.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result any, err error updated item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) Update(ctx context.Context, correlationId string,
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	newItem, err := c.Overrides.ConvertFromPublic(item)
+	if err != nil {
+		return result, err
+	}
+	newItem["_id"] = c.toStoredId(newItem["_id"])
+	id := newItem["_id"]
+
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": newItem}
+	return c.UpdateOneByFilter(ctx, correlationId, filter, update)
+}
+
+// UpdatePartially is updates only few selected fields in a data item.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be updated.
+//		- data cdata.AnyValueMap a map with fields to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item any, err error updated item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) UpdatePartially(ctx context.Context, correlationId string,
+	id K, data cdata.AnyValueMap, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	return c.UpdateOneByFilter(ctx, correlationId, bson.M{"_id": c.toStoredId(id)}, data)
+}
+
+// UpdatePartiallyWithBuilder is updates a data item with atomic update operators
+// composed by the update builder.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be updated.
+//		- update *MongoDbUpdateBuilder update builder with operators to be applied.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) UpdatePartiallyWithBuilder(ctx context.Context, correlationId string,
+	id K, update *MongoDbUpdateBuilder, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	return c.UpdateOneByFilter(ctx, correlationId, bson.M{"_id": c.toStoredId(id)}, update)
+}
+
+// DeleteById is deleted a data item by it's unique id.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- id K id of the item to be deleted
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, err error deleted item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) DeleteById(ctx context.Context, correlationId string,
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	doc, err := c.remove(ctx, correlationId, c.toStoredId(id))
+	if err != nil || doc == nil {
+		return item, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Deleted from %s with id = %s", c.CollectionName, id)
+	return c.decodeDocument(correlationId, doc, nil)
+}
+
+// DeleteByIds is deletes multiple data items by their unique ids.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- ids []K ids of data items to be deleted.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: error or nil for success.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) DeleteByIds(ctx context.Context, correlationId string,
+	ids []K, queryOptions ...MongoDbQueryOption) error {
+
+	filter := bson.M{
+		"_id": bson.M{"$in": c.toStoredIds(ids)},
+	}
+	return c.DeleteByFilter(ctx, correlationId, filter)
+}
+
+// EnqueueEvents keeps events in memory the same way as they are written into the outbox collection.
+// Events enqueued inside ExecuteInTransaction are removed when the transaction fails.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- events ...outbox.OutboxEvent events to be enqueued.
+//	Returns: error or nil for success.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) EnqueueEvents(ctx context.Context, correlationId string,
+	events ...outbox.OutboxEvent) error {
+
+	if err := c.checkOpened(correlationId); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	for _, event := range events {
+		if event.Id == "" {
+			event.Id = cdata.IdGenerator.NextLong()
+		}
+		if event.Source == "" {
+			event.Source = c.CollectionName
+		}
+		if event.CorrelationId == "" {
+			event.CorrelationId = correlationId
+		}
+		event.Status = outbox.OutboxEventPending
+		event.Attempts = 0
+		event.CreateTime = now
+		event.NextAttemptTime = now
+		transaction.recordEvent(event.Id)
+		c.events = append(c.events, event)
+	}
+	c.lock.Unlock()
+
+	c.Logger.Trace(ctx, correlationId, "Enqueued %d events from %s", len(events), c.CollectionName)
+	return nil
+}
+
+// GetEnqueuedEvents gets events enqueued with EnqueueEvents and *WithEvents methods.
+//
+//	Returns: []outbox.OutboxEvent enqueued events in order of enqueueing.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) GetEnqueuedEvents() []outbox.OutboxEvent {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append(make([]outbox.OutboxEvent, 0, len(c.events)), c.events...)
+}
+
+// CreateWithEvents creates a data item and enqueues events in the same transaction.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be created.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the created item.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result T, err error created item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) CreateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.Create(ctx, correlationId, item); err != nil {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
+}
+
+// UpdateWithEvents updates a data item and enqueues events in the same transaction.
+// When the item is not found nothing is enqueued and an empty item is returned.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be updated.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the updated item.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result T, err error updated item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) UpdateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.Update(ctx, correlationId, item); err != nil || isEmptyItem(result) {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
+}
+
+// DeleteByIdWithEvents deletes a data item by it's unique id and enqueues events in the same transaction.
+// When the item is not found nothing is enqueued and an empty item is returned.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K id of the item to be deleted
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the deleted item.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result T, err error deleted item and error, if they are occurred
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) DeleteByIdWithEvents(ctx context.Context, correlationId string,
+	id K, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.DeleteById(ctx, correlationId, id); err != nil || isEmptyItem(result) {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
+}
+
+// toDocument converts a data item into a document to be stored and generates its id.
+func (c *IdentifiableMemoryMongoDbPersistence[T, K]) toDocument(correlationId string, item T) (bson.M, error) {
+	newItem, err := c.Overrides.ConvertFromPublic(item)
+	if err != nil {
+		return nil, err
+	}
+	c.generateId(newItem)
+	return toMemoryDocument(correlationId, newItem)
+}
@@ -3,10 +3,15 @@ package persistence
 import (
 	"context"
 	"errors"
+	"reflect"
+	"time"
 
 	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
 	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	mngoptions "go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -46,6 +51,20 @@ import (
 //			- ssl:                       (optional) enable SSL connection (default: false) (not implements in this release)
 //			- auth_source:               (optional) authentication source
 //			- debug:                     (optional) enable debug output (default: false). (not used)
+//			- decode_error_policy:       (optional) handling of undecodable documents: skip, collect or fail (default: skip)
+//			- facet_count:               (optional) read page items and total in a single $facet aggregation (default: false)
+//			- estimated_count:           (optional) use estimated document count for totals of unfiltered pages (default: false)
+//			- max_count:                 (optional) maximum number of documents to count for totals, 0 for no limit (default: 0)
+//			- max_time_ms:               (optional) maximum time to execute operations in milliseconds, 0 for no limit (default: 0)
+//			- allow_disk_use:            (optional) allow large sorts and aggregations to use temporary files
+//			- comment:                   (optional) comment to identify operations in server logs
+//			- collation_locale:          (optional) locale of collation to compare strings in operations
+//			- collation_strength:        (optional) strength of collation, 1 or 2 for case-insensitive comparison
+//			- id_strategy:               (optional) id generation strategy: long, short, objectid, uuid4, uuid7, ulid or none (default: long)
+//			- outbox_collection:         (optional) collection to enqueue events with *WithEvents methods (default: outbox)
+//			- audit:                     (optional) record history of changes of data items (default: false)
+//			- audit_mode:                (optional) history records with full snapshot or diff of changed fields (default: snapshot)
+//			- audit_collection:          (optional) collection to keep the history (default: <collection>_history)
 //
 //	References:
 //		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages components to pass log messages
@@ -97,6 +116,15 @@ type IdentifiableMongoDbPersistence[T any, K any] struct {
 
 	// Flag to turn on automated string ID generation
 	_autoGenerateId bool
+	// The strategy to generate ids for new data items
+	idStrategy IIdStrategy
+	// Flag to store string ids as ObjectIDs and expose them as hex strings
+	objectIdAsHex bool
+	// The configured id strategy that is not known, it fails Open
+	unknownIdStrategy string
+
+	// The outbox collection name.
+	OutboxCollectionName string
 }
 
 // InheritIdentifiableMongoDbPersistence is creates a new instance of the persistence component.
@@ -112,6 +140,8 @@ func InheritIdentifiableMongoDbPersistence[T any, K any](overrides IMongoDbPersi
 	c.MongoDbPersistence = InheritMongoDbPersistence(overrides, collection)
 	c.maxPageSize = 100
 	c._autoGenerateId = true
+	c.idStrategy = LongIdStrategy
+	c.OutboxCollectionName = "outbox"
 	return &c
 }
 
@@ -123,6 +153,135 @@ func InheritIdentifiableMongoDbPersistence[T any, K any](overrides IMongoDbPersi
 func (c *IdentifiableMongoDbPersistence[T, K]) Configure(ctx context.Context, config *cconf.ConfigParams) {
 	c.MongoDbPersistence.Configure(ctx, config)
 	c.maxPageSize = (int32)(config.GetAsIntegerWithDefault("options.max_page_size", (int)(c.maxPageSize)))
+	c.OutboxCollectionName = config.GetAsStringWithDefault("options.outbox_collection", c.OutboxCollectionName)
+
+	if config.GetAsBooleanWithDefault("options.audit", c.audit != nil) {
+		if c.audit == nil {
+			c.audit = &mongoDbAuditTrail{mode: AuditSnapshot}
+		}
+		c.audit.mode = config.GetAsStringWithDefault("options.audit_mode", c.audit.mode)
+		c.audit.collectionName = config.GetAsStringWithDefault("options.audit_collection", c.audit.collectionName)
+	} else {
+		c.audit = nil
+	}
+
+	if name, ok := config.GetAsNullableString("options.id_strategy"); ok && name != "" {
+		c.unknownIdStrategy = ""
+		if name == "none" {
+			c._autoGenerateId = false
+		} else if strategy, ok := NewIdStrategy(name); ok {
+			c._autoGenerateId = true
+			c.SetIdStrategy(strategy)
+		} else {
+			c.unknownIdStrategy = name
+		}
+	}
+}
+
+// Open opens the component after the configured id strategy and audit mode are checked.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *IdentifiableMongoDbPersistence[T, K]) Open(ctx context.Context, correlationId string) error {
+	if c.unknownIdStrategy != "" {
+		return cerr.NewConfigError(correlationId, "INVALID_ID_STRATEGY", "Unknown id strategy "+c.unknownIdStrategy).
+			WithDetails("strategy", c.unknownIdStrategy)
+	}
+	if c.audit != nil && c.audit.mode != AuditSnapshot && c.audit.mode != AuditDiff {
+		return cerr.NewConfigError(correlationId, "INVALID_AUDIT_MODE", "Unknown audit mode "+c.audit.mode).
+			WithDetails("mode", c.audit.mode)
+	}
+	return c.MongoDbPersistence.Open(ctx, correlationId)
+}
+
+// SetAutoGenerateId turns on or off generation of ids for new data items with empty ids.
+//
+//	Parameters:
+//		- value bool true to generate ids.
+func (c *IdentifiableMongoDbPersistence[T, K]) SetAutoGenerateId(value bool) {
+	c._autoGenerateId = value
+}
+
+// SetIdStrategy sets the strategy to generate ids for new data items.
+// When ObjectIdStrategy is used with string ids, the ids are stored as ObjectIDs
+// and converted to hex strings on read.
+//
+//	Parameters:
+//		- strategy IIdStrategy an id generation strategy.
+func (c *IdentifiableMongoDbPersistence[T, K]) SetIdStrategy(strategy IIdStrategy) {
+	c.idStrategy = strategy
+	c.unknownIdStrategy = ""
+
+	_, isObjectId := strategy.(objectIdStrategy)
+	var id K
+	_, isString := any(id).(string)
+	c.objectIdAsHex = isObjectId && isString
+	if c.objectIdAsHex {
+		c.toPublicId = objectIdToHex
+	} else {
+		c.toPublicId = nil
+	}
+}
+
+// generateId sets a new id to the item if it has no id and generation is turned on.
+func (c *IdentifiableMongoDbPersistence[T, K]) generateId(newItem map[string]any) {
+	val, ok := newItem["_id"]
+	if (!ok || isEmptyId(val)) && c._autoGenerateId {
+		newItem["_id"] = c.idStrategy.NextId()
+	} else if ok {
+		newItem["_id"] = c.toStoredId(val)
+	}
+}
+
+// toStoredId converts a public id into the stored one.
+func (c *IdentifiableMongoDbPersistence[T, K]) toStoredId(id any) any {
+	if !c.objectIdAsHex {
+		return id
+	}
+	if hex, ok := id.(string); ok {
+		if oid, err := primitive.ObjectIDFromHex(hex); err == nil {
+			return oid
+		}
+	}
+	return id
+}
+
+// toStoredIds converts public ids into the stored ones.
+func (c *IdentifiableMongoDbPersistence[T, K]) toStoredIds(ids []K) any {
+	if !c.objectIdAsHex {
+		return ids
+	}
+	result := make([]any, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, c.toStoredId(id))
+	}
+	return result
+}
+
+func isEmptyId(id any) bool {
+	switch v := id.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case primitive.ObjectID:
+		return v.IsZero()
+	}
+	return false
+}
+
+// isEmptyItem checks if the item is a zero value returned by writes that matched no documents.
+func isEmptyItem[T any](item T) bool {
+	return reflect.ValueOf(&item).Elem().IsZero()
+}
+
+func objectIdToHex(id any) any {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		return oid.Hex()
+	}
+	return id
 }
 
 // GetListByIds is gets a list of data items retrieved by given unique ids.
@@ -131,14 +290,15 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Configure(ctx context.Context, co
 //		- ctx context.Context
 //		- correlationId  string (optional) transaction id to Trace execution through call chain.
 //		- ids  []K ids of data items to be retrieved
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: items []T, err error a data list and error, if they are occurred.
 func (c *IdentifiableMongoDbPersistence[T, K]) GetListByIds(ctx context.Context, correlationId string,
-	ids []K) (items []T, err error) {
+	ids []K, queryOptions ...MongoDbQueryOption) (items []T, err error) {
 
 	filter := bson.M{
-		"_id": bson.M{"$in": ids},
+		"_id": bson.M{"$in": c.toStoredIds(ids)},
 	}
-	return c.GetListByFilter(ctx, correlationId, filter, nil, nil)
+	return c.GetListByFilter(ctx, correlationId, filter, nil, nil, queryOptions...)
 }
 
 // GetOneById is gets a data item by its unique id.
@@ -147,14 +307,17 @@ func (c *IdentifiableMongoDbPersistence[T, K]) GetListByIds(ctx context.Context,
 //		- ctx context.Context
 //		- correlationId     (optional) transaction id to Trace execution through call chain.
 //		- id                an id of data item to be retrieved.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: item T, err error a data and error, if they are occurred.
 func (c *IdentifiableMongoDbPersistence[T, K]) GetOneById(ctx context.Context, correlationId string,
-	id K) (item T, err error) {
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
 
-	filter := bson.M{"_id": id}
-	var docPointer map[string]any
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": c.toStoredId(id)})
+	if err != nil {
+		return item, err
+	}
 
-	res := c.Collection.FindOne(ctx, filter)
+	res := collection.FindOne(ctx, filter, c.resolveQueryOptions(queryOptions).findOne())
 	if err := res.Err(); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return item, nil
@@ -162,14 +325,16 @@ func (c *IdentifiableMongoDbPersistence[T, K]) GetOneById(ctx context.Context, c
 		return item, err
 	}
 
-	if err := res.Decode(&docPointer); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return item, nil
-		}
+	raw, err := res.DecodeBytes()
+	if err != nil {
 		return item, err
 	}
+	if item, err = c.decodeDocument(raw); err != nil {
+		var defaultValue T
+		return defaultValue, c.handleSingleDecodeError(ctx, correlationId, raw, err)
+	}
 	c.Logger.Trace(ctx, correlationId, "Retrieved from %s by id = %s", c.CollectionName, id)
-	return c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
 }
 
 // Create was creates a data item.
@@ -178,9 +343,10 @@ func (c *IdentifiableMongoDbPersistence[T, K]) GetOneById(ctx context.Context, c
 //		- ctx context.Context
 //		- correlation_id string (optional) transaction id to Trace execution through call chain.
 //		- item any an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: result any, err error created item and error, if they are occurred
 func (c *IdentifiableMongoDbPersistence[T, K]) Create(ctx context.Context, correlationId string,
-	item T) (result T, err error) {
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
 	var defaultValue T
 
 	newItem, err := c.Overrides.ConvertFromPublic(item)
@@ -189,17 +355,32 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Create(ctx context.Context, corre
 	}
 
 	// Auto generate unique id
-	val, ok := newItem["_id"]
-	if (!ok || val == nil || val == "") && c._autoGenerateId {
-		newItem["_id"] = cdata.IdGenerator.NextLong()
+	c.generateId(newItem)
+
+	if err = c.resolveDocument(ctx, correlationId, newItem); err != nil {
+		return defaultValue, err
+	}
+	stored, err := c.encryptDocument(correlationId, newItem)
+	if err != nil {
+		return defaultValue, err
+	}
+	collection, err := c.ResolveCollection(ctx, correlationId)
+	if err != nil {
+		return defaultValue, err
 	}
 
-	res, err := c.Collection.InsertOne(ctx, newItem)
+	var res *mongo.InsertOneResult
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		if res, err = collection.InsertOne(ctx, stored, c.resolveQueryOptions(queryOptions).insertOne()); err != nil {
+			return err
+		}
+		return c.writeAudit(ctx, correlationId, collection, nil, withDocumentId(stored, res.InsertedID))
+	})
 	if err != nil {
 		return result, err
 	}
 
-	result, err = c.Overrides.ConvertToPublic(newItem)
+	result, err = c.Overrides.ConvertToPublic(c.toPublicDocument(newItem))
 	if err != nil {
 		return defaultValue, err
 	}
@@ -216,9 +397,10 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Create(ctx context.Context, corre
 //		- ctx context.Context
 //		- correlation_id string (optional) transaction id to Trace execution through call chain.
 //		- item T an item to be set.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: result any, err error updated item and error, if they occurred
 func (c *IdentifiableMongoDbPersistence[T, K]) Set(ctx context.Context, correlationId string,
-	item T) (result T, err error) {
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
 	var defaultValue T
 
 	newItem, err := c.Overrides.ConvertFromPublic(item)
@@ -227,37 +409,47 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Set(ctx context.Context, correlat
 	}
 
 	// Auto unique generate id
-	val, ok := newItem["_id"]
-	if (!ok || val == nil || val == "") && c._autoGenerateId {
-		newItem["_id"] = cdata.IdGenerator.NextLong()
+	c.generateId(newItem)
+
+	if err = c.resolveDocument(ctx, correlationId, newItem); err != nil {
+		return defaultValue, err
+	}
+	if newItem, err = c.encryptDocument(correlationId, newItem); err != nil {
+		return defaultValue, err
 	}
 
 	id := newItem["_id"]
-	filter := bson.M{"_id": id}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": c.toStoredId(id)})
+	if err != nil {
+		return defaultValue, err
+	}
 	var options mngoptions.FindOneAndReplaceOptions
 	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
 	upsert := true
 	options.Upsert = &upsert
 
-	res := c.Collection.FindOneAndReplace(ctx, filter, newItem, &options)
-	if err := res.Err(); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return result, nil
+	var raw bson.Raw
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		before, err := c.auditBefore(ctx, collection, filter)
+		if err != nil {
+			return err
 		}
-		return result, err
-	}
-
-	c.Logger.Trace(ctx, correlationId, "Set in %s with id = %s", c.CollectionName, id)
-	var docPointer map[string]any
-	if err := res.Decode(&docPointer); err != nil {
+		raw, err = collection.FindOneAndReplace(ctx, filter, newItem, &options, c.resolveQueryOptions(queryOptions).findOneAndReplace()).DecodeBytes()
+		if err != nil {
+			return err
+		}
+		return c.writeAudit(ctx, correlationId, collection, before, raw)
+	})
+	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return result, nil
 		}
 		return result, err
 	}
 
-	return c.Overrides.ConvertToPublic(docPointer)
+	c.Logger.Trace(ctx, correlationId, "Set in %s with id = %s", c.CollectionName, id)
+	return c.decodeDocument(raw)
 }
 
 // Update is updates a data item.
@@ -266,25 +458,36 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Set(ctx context.Context, correlat
 //		- ctx context.Context
 //		- correlation_id string (optional) transaction id to Trace execution through call chain.
 //		- item T an item to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: result any, err error updated item and error, if they are occurred
 func (c *IdentifiableMongoDbPersistence[T, K]) Update(ctx context.Context, correlationId string,
-	item T) (result T, err error) {
+	item T, queryOptions ...MongoDbQueryOption) (result T, err error) {
 
 	newItem, err := c.Overrides.ConvertFromPublic(item)
 	if err != nil {
 		return result, err
 	}
+	newItem["_id"] = c.toStoredId(newItem["_id"])
 	id := newItem["_id"]
+	if err = c.resolveDocument(ctx, correlationId, newItem); err != nil {
+		return result, err
+	}
+	if newItem, err = c.encryptDocument(correlationId, newItem); err != nil {
+		return result, err
+	}
 
-	filter := bson.M{"_id": id}
-	update := bson.D{{"$set", newItem}}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": id})
+	if err != nil {
+		return result, err
+	}
+	update := bson.D{{Key: "$set", Value: newItem}}
 
 	var options mngoptions.FindOneAndUpdateOptions
 	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
 
-	res := c.Collection.FindOneAndUpdate(ctx, filter, update, &options)
-	if err := res.Err(); err != nil {
+	raw, err := c.auditUpdateOne(ctx, correlationId, collection, filter, update, &options, c.resolveQueryOptions(queryOptions))
+	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return result, nil
 		}
@@ -292,16 +495,7 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Update(ctx context.Context, corre
 	}
 
 	c.Logger.Trace(ctx, correlationId, "Updated in %s with id = %s", c.CollectionName, id)
-
-	var docPointer map[string]any
-	if err := res.Decode(&docPointer); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return result, nil
-		}
-		return result, err
-	}
-
-	return c.Overrides.ConvertToPublic(docPointer)
+	return c.decodeDocument(raw)
 }
 
 // UpdatePartially is updates only few selected fields in a data item.
@@ -311,39 +505,56 @@ func (c *IdentifiableMongoDbPersistence[T, K]) Update(ctx context.Context, corre
 //		- correlation_id string (optional) transaction id to Trace execution through call chain.
 //		- id K an id of data item to be updated.
 //		- data cdata.AnyValueMap a map with fields to be updated.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: item any, err error updated item and error, if they are occurred
 func (c *IdentifiableMongoDbPersistence[T, K]) UpdatePartially(ctx context.Context, correlationId string,
-	id K, data cdata.AnyValueMap) (item T, err error) {
+	id K, data cdata.AnyValueMap, queryOptions ...MongoDbQueryOption) (item T, err error) {
 
 	newItem := bson.M{}
 	for k, v := range data.Value() {
 		newItem[k] = v
 	}
-	filter := bson.M{"_id": id}
-	update := bson.D{{"$set", newItem}}
+	var update any = bson.D{{Key: "$set", Value: newItem}}
+	if err = c.resolveUpdate(ctx, correlationId, update); err != nil {
+		return item, err
+	}
+	if update, err = c.encryptUpdate(correlationId, update); err != nil {
+		return item, err
+	}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": c.toStoredId(id)})
+	if err != nil {
+		return item, err
+	}
 
 	var options mngoptions.FindOneAndUpdateOptions
 	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
 
-	res := c.Collection.FindOneAndUpdate(ctx, filter, update, &options)
-	if err := res.Err(); err != nil {
+	raw, err := c.auditUpdateOne(ctx, correlationId, collection, filter, update, &options, c.resolveQueryOptions(queryOptions))
+	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return item, nil
 		}
 		return item, err
 	}
 	c.Logger.Trace(ctx, correlationId, "Updated partially in %s with id = %s", c.Collection, id)
+	return c.decodeDocument(raw)
+}
 
-	var docPointer map[string]any
-	if err := res.Decode(&docPointer); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return item, nil
-		}
-		return item, err
-	}
+// UpdatePartiallyWithBuilder is updates a data item with atomic update operators
+// composed by the update builder.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item to be updated.
+//		- update *MongoDbUpdateBuilder update builder with operators to be applied.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *IdentifiableMongoDbPersistence[T, K]) UpdatePartiallyWithBuilder(ctx context.Context, correlationId string,
+	id K, update *MongoDbUpdateBuilder, queryOptions ...MongoDbQueryOption) (item T, err error) {
 
-	return c.Overrides.ConvertToPublic(docPointer)
+	return c.UpdateOneByFilter(ctx, correlationId, bson.M{"_id": c.toStoredId(id)}, update, queryOptions...)
 }
 
 // DeleteById is deleted a data item by it's unique id.
@@ -352,31 +563,32 @@ func (c *IdentifiableMongoDbPersistence[T, K]) UpdatePartially(ctx context.Conte
 //		- ctx context.Context
 //		- correlation_id string (optional) transaction id to Trace execution through call chain.
 //		- id K id of the item to be deleted
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: item T, err error deleted item and error, if they are occurred
 func (c *IdentifiableMongoDbPersistence[T, K]) DeleteById(ctx context.Context, correlationId string,
-	id K) (item T, err error) {
+	id K, queryOptions ...MongoDbQueryOption) (item T, err error) {
 
-	filter := bson.M{"_id": id}
-
-	res := c.Collection.FindOneAndDelete(ctx, filter)
-	if err := res.Err(); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return item, nil
-		}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": c.toStoredId(id)})
+	if err != nil {
 		return item, err
 	}
 
-	c.Logger.Trace(ctx, correlationId, "Deleted from %s with id = %s", c.CollectionName, id)
-
-	var docPointer map[string]any
-	if err := res.Decode(&docPointer); err != nil {
+	var raw bson.Raw
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		if raw, err = collection.FindOneAndDelete(ctx, filter, c.resolveQueryOptions(queryOptions).findOneAndDelete()).DecodeBytes(); err != nil {
+			return err
+		}
+		return c.writeAudit(ctx, correlationId, collection, raw, nil)
+	})
+	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return item, nil
 		}
 		return item, err
 	}
 
-	return c.Overrides.ConvertToPublic(docPointer)
+	c.Logger.Trace(ctx, correlationId, "Deleted from %s with id = %s", c.CollectionName, id)
+	return c.decodeDocument(raw)
 }
 
 // DeleteByIds is deletes multiple data items by their unique ids.
@@ -385,12 +597,237 @@ func (c *IdentifiableMongoDbPersistence[T, K]) DeleteById(ctx context.Context, c
 //		- ctx context.Context
 //		- correlationId string (optional) transaction id to Trace execution through call chain.
 //		- ids []K ids of data items to be deleted.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: error or nil for success.
 func (c *IdentifiableMongoDbPersistence[T, K]) DeleteByIds(ctx context.Context, correlationId string,
-	ids []K) error {
+	ids []K, queryOptions ...MongoDbQueryOption) error {
 
 	filter := bson.M{
-		"_id": bson.M{"$in": ids},
+		"_id": bson.M{"$in": c.toStoredIds(ids)},
+	}
+	return c.DeleteByFilter(ctx, correlationId, filter, queryOptions...)
+}
+
+// GetHistoryById gets a page of history records of a data item from the latest to the oldest.
+// The history is recorded when options.audit is enabled.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item.
+//		- paging cdata.PagingParams (optional) paging parameters
+//	Returns: page cdata.DataPage[MongoDbAuditRecord], err error a page of history records and error, if they are occurred.
+func (c *IdentifiableMongoDbPersistence[T, K]) GetHistoryById(ctx context.Context, correlationId string,
+	id K, paging cdata.PagingParams) (page cdata.DataPage[MongoDbAuditRecord], err error) {
+
+	history, filter, err := c.historyScope(ctx, correlationId, id)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbAuditRecord](), err
+	}
+
+	options := mngoptions.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(paging.GetTake((int64)(c.maxPageSize)))
+	if skip := paging.GetSkip(-1); skip >= 0 {
+		options.SetSkip(skip)
+	}
+
+	cursor, err := history.Find(ctx, filter, options)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbAuditRecord](), err
+	}
+	records := make([]MongoDbAuditRecord, 0)
+	if err = cursor.All(ctx, &records); err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbAuditRecord](), err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d history records from %s by id = %s", len(records), history.Name(), id)
+
+	if !paging.Total {
+		return *cdata.NewDataPage(records, cdata.EmptyTotalValue), nil
+	}
+	total, err := history.CountDocuments(ctx, filter)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbAuditRecord](), err
+	}
+	return *cdata.NewDataPage(records, int(total)), nil
+}
+
+// GetOneByIdAsOf reconstructs a data item as it was at a point in time from its history.
+// In diff mode the item is replayed from all recorded changes, so its history must start with the creation.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K an id of data item.
+//		- asOf time.Time a point in time.
+//	Returns: item T, found bool, err error the data item, true if it existed at the time and error, if they are occurred.
+func (c *IdentifiableMongoDbPersistence[T, K]) GetOneByIdAsOf(ctx context.Context, correlationId string,
+	id K, asOf time.Time) (item T, found bool, err error) {
+
+	history, filter, err := c.historyScope(ctx, correlationId, id)
+	if err != nil {
+		return item, false, err
+	}
+	filter["time"] = bson.M{"$lte": asOf}
+
+	var doc map[string]any
+	if c.audit.mode == AuditDiff {
+		options := mngoptions.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+		cursor, err := history.Find(ctx, filter, options)
+		if err != nil {
+			return item, false, err
+		}
+		records := make([]MongoDbAuditRecord, 0)
+		if err = cursor.All(ctx, &records); err != nil {
+			return item, false, err
+		}
+		for _, record := range records {
+			if record.Operation == AuditDelete {
+				doc = nil
+				continue
+			}
+			if doc == nil {
+				doc = map[string]any{}
+			}
+			applyAuditChanges(doc, record.Changes)
+		}
+	} else {
+		options := mngoptions.FindOne().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+		var record MongoDbAuditRecord
+		if err = history.FindOne(ctx, filter, options).Decode(&record); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return item, false, err
+		}
+		doc = record.After
+	}
+
+	if doc == nil {
+		return item, false, nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return item, false, err
+	}
+	if item, err = c.decodeDocument(raw); err != nil {
+		var defaultValue T
+		return defaultValue, false, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Reconstructed from %s by id = %s as of %s", history.Name(), id, asOf)
+	return item, true, nil
+}
+
+// historyScope resolves the history collection and the filter of history records of a data item.
+func (c *IdentifiableMongoDbPersistence[T, K]) historyScope(ctx context.Context, correlationId string,
+	id K) (*mongo.Collection, bson.M, error) {
+
+	if c.audit == nil {
+		return nil, nil, cerr.NewInvalidStateError(correlationId, "AUDIT_DISABLED",
+			"History of "+c.CollectionName+" is not recorded")
+	}
+	collection, err := c.ResolveCollection(ctx, correlationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if collection == nil {
+		return nil, nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+	history, err := c.auditCollection(collection)
+	if err != nil {
+		return nil, nil, cerr.NewConnectionError(correlationId, "AUDIT_FAILED", "Failed to prepare history of "+c.CollectionName).
+			WithCause(err)
+	}
+
+	filter := bson.M{"document_id": c.toStoredId(id)}
+	if c.tenancyMode != TenancyNone {
+		filter["tenant_id"] = GetTenantId(ctx)
+	}
+	return history, filter, nil
+}
+
+// EnqueueEvents writes events into the outbox collection.
+// To enqueue events atomically with other writes call it inside ExecuteInTransaction
+// with the context passed to the action.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- events ...outbox.OutboxEvent events to be enqueued.
+//	Returns: error or nil for success.
+func (c *IdentifiableMongoDbPersistence[T, K]) EnqueueEvents(ctx context.Context, correlationId string,
+	events ...outbox.OutboxEvent) error {
+
+	if c.Db == nil {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+
+	writer := outbox.NewMongoDbOutbox(c.Db.Collection(c.OutboxCollectionName), c.CollectionName)
+	if err := writer.Enqueue(ctx, correlationId, events...); err != nil {
+		return err
 	}
-	return c.DeleteByFilter(ctx, correlationId, filter)
+	c.Logger.Trace(ctx, correlationId, "Enqueued %d events from %s to %s", len(events), c.CollectionName, c.OutboxCollectionName)
+	return nil
+}
+
+// CreateWithEvents creates a data item and enqueues events in the same transaction.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be created.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the created item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error created item and error, if they are occurred
+func (c *IdentifiableMongoDbPersistence[T, K]) CreateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.Create(ctx, correlationId, item, queryOptions...); err != nil {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
+}
+
+// UpdateWithEvents updates a data item and enqueues events in the same transaction.
+// When the item is not found nothing is enqueued and an empty item is returned.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- item T an item to be updated.
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the updated item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error updated item and error, if they are occurred
+func (c *IdentifiableMongoDbPersistence[T, K]) UpdateWithEvents(ctx context.Context, correlationId string,
+	item T, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.Update(ctx, correlationId, item, queryOptions...); err != nil || isEmptyItem(result) {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
+}
+
+// DeleteByIdWithEvents deletes a data item by it's unique id and enqueues events in the same transaction.
+// When the item is not found nothing is enqueued and an empty item is returned.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- id K id of the item to be deleted
+//		- events func(result T) []outbox.OutboxEvent a function that composes events from the deleted item.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result T, err error deleted item and error, if they are occurred
+func (c *IdentifiableMongoDbPersistence[T, K]) DeleteByIdWithEvents(ctx context.Context, correlationId string,
+	id K, events func(result T) []outbox.OutboxEvent, queryOptions ...MongoDbQueryOption) (result T, err error) {
+
+	err = c.ExecuteInTransaction(ctx, correlationId, func(ctx context.Context) error {
+		if result, err = c.DeleteById(ctx, correlationId, id, queryOptions...); err != nil || isEmptyItem(result) {
+			return err
+		}
+		return c.EnqueueEvents(ctx, correlationId, events(result)...)
+	})
+	return result, err
 }
@@ -0,0 +1,1011 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemoryMongoDbPersistence is an in-memory fake of MongoDbPersistence for unit tests.
+// It has the same method set and keeps data items as BSON documents in process,
+// so persistence components built on top of it and their test fixtures run without MongoDB server.
+//
+// Filters, sorting, projections and updates are evaluated with a subset of MongoDB operators:
+//	- query:      $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $regex, $not, $size, $all, $elemMatch, $and, $or, $nor
+//	- update:     $set, $setOnInsert, $unset, $inc, $push, $addToSet (with $each) and $pull
+//	- projection: inclusion or exclusion of fields
+//
+// Other operators, positional updates, array filters and update pipelines fail with BadRequest errors.
+// Indexes are not maintained, only uniqueness of _id is checked.
+// Transactions restore only the documents and events changed by the action when it fails.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) collection name
+//		- options:
+//			- max_page_size:             (optional) maximum page size (default: 100)
+//
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//
+// Example:
+//	type MyMemoryPersistence struct {
+//		*persist.MemoryMongoDbPersistence[MyData]
+//	}
+//
+//	func NewMyMemoryPersistence() *MyMemoryPersistence {
+//		c := &MyMemoryPersistence{}
+//		c.MemoryMongoDbPersistence = persist.InheritMemoryMongoDbPersistence[MyData](c, "my_data")
+//		return c
+//	}
+//
+//	func (c *MyMemoryPersistence) GetCountByName(ctx context.Context, correlationId string, name string) (count int64, err error) {
+//		return c.MemoryMongoDbPersistence.GetCountByFilter(ctx, correlationId, bson.M{"name": name})
+//	}
+type MemoryMongoDbPersistence[T any] struct {
+	Overrides IMongoDbPersistenceOverrides[T]
+
+	lock         sync.RWMutex
+	documents    []bson.M
+	events       []outbox.OutboxEvent
+	opened       bool
+	isTerminated chan struct{}
+	maxPageSize  int32
+	// Converts stored ids into public ones, nil to keep them as is
+	toPublicId func(id any) any
+
+	// The logger.
+	Logger clog.CompositeLogger
+	// The collection name.
+	CollectionName string
+}
+
+// memoryTransactionKey is a context key of the transaction started by the persistence.
+type memoryTransactionKey struct {
+	owner any
+}
+
+// memoryTransaction is an undo log of changes made by a transaction action.
+// It keeps original documents touched by the action, so only they are restored on failure.
+type memoryTransaction struct {
+	documents []memoryUndo
+	events    []string
+}
+
+// memoryUndo is an original state of a document, nil when the document didn't exist.
+type memoryUndo struct {
+	id  any
+	doc bson.M
+}
+
+// recordDocument keeps the original state of a document when it's changed for the first time.
+func (t *memoryTransaction) recordDocument(id any, original bson.M) {
+	if t == nil {
+		return
+	}
+	for _, undo := range t.documents {
+		if cmp, sameType := compareMemoryValues(undo.id, id); sameType && cmp == 0 {
+			return
+		}
+	}
+	t.documents = append(t.documents, memoryUndo{id: id, doc: original})
+}
+
+// recordEvent keeps an id of the enqueued event to remove it on failure.
+func (t *memoryTransaction) recordEvent(id string) {
+	if t != nil {
+		t.events = append(t.events, id)
+	}
+}
+
+// InheritMemoryMongoDbPersistence are creates a new instance of the in-memory persistence component.
+//
+//	Parameters:
+//		- overrides IMongoDbPersistenceOverrides[T] a child component with overridden conversions.
+//		- collection string (optional) a collection name.
+//	Returns: *MemoryMongoDbPersistence[T] new created MemoryMongoDbPersistence component
+func InheritMemoryMongoDbPersistence[T any](overrides IMongoDbPersistenceOverrides[T], collection string) *MemoryMongoDbPersistence[T] {
+	c := &MemoryMongoDbPersistence[T]{
+		Overrides:      overrides,
+		documents:      make([]bson.M, 0),
+		events:         make([]outbox.OutboxEvent, 0),
+		maxPageSize:    100,
+		Logger:         *clog.NewCompositeLogger(),
+		CollectionName: collection,
+	}
+	return c
+}
+
+// Configure method is configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config  *cconf.ConfigParams configuration parameters to be set.
+func (c *MemoryMongoDbPersistence[T]) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.maxPageSize = int32(config.GetAsIntegerWithDefault("options.max_page_size", int(c.maxPageSize)))
+}
+
+// SetReferences method are sets references to dependent components.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- references crefer.IReferences references to locate the component dependencies.
+func (c *MemoryMongoDbPersistence[T]) SetReferences(ctx context.Context, references crefer.IReferences) {
+	c.Logger.SetReferences(ctx, references)
+}
+
+// UnsetReferences method is unsets (clears) previously set references to dependent components.
+func (c *MemoryMongoDbPersistence[T]) UnsetReferences() {
+}
+
+// DefineSchema is a hook to define indexes in child types. It's called when the component is opened.
+func (c *MemoryMongoDbPersistence[T]) DefineSchema() {
+	// Override in child classes
+}
+
+// EnsureIndex accepts an index definition for compatibility with MongoDbPersistence.
+// In-memory persistence doesn't maintain indexes.
+//
+//	Parameters:
+//		- keys any index keys (fields)
+//		- options *mongoopt.IndexOptions index options
+func (c *MemoryMongoDbPersistence[T]) EnsureIndex(keys any, options *mongoopt.IndexOptions) {
+}
+
+// ConvertFromPublic method help convert object (map) from public view by replaced "Id" to "_id" field
+//
+//	Parameters:
+//		- item *any converted item
+func (c *MemoryMongoDbPersistence[T]) ConvertFromPublic(value T) (map[string]any, error) {
+	return convertFromPublic(value)
+}
+
+// ConvertFromPublicPartial method help convert object (map) from public view by replaced "Id" to "_id" field
+//
+//	Parameters:
+//		- item *any converted item
+func (c *MemoryMongoDbPersistence[T]) ConvertFromPublicPartial(item T) (map[string]any, error) {
+	return c.ConvertFromPublic(item)
+}
+
+// ConvertToPublic method is convert object (map) to public view by replaced "_id" to "Id" field
+//
+//	Parameters:
+//		- item *any converted item
+func (c *MemoryMongoDbPersistence[T]) ConvertToPublic(value any) (T, error) {
+	return convertToPublic[T](value)
+}
+
+// IsOpen method is checks if the component is opened.
+//
+//	Returns: true if the component has been opened and false otherwise.
+func (c *MemoryMongoDbPersistence[T]) IsOpen() bool {
+	return c.opened
+}
+
+// IsTerminated checks if the wee need to terminate process before close component.
+//
+//	Returns: true if you need terminate your processes.
+func (c *MemoryMongoDbPersistence[T]) IsTerminated() bool {
+	select {
+	case _, ok := <-c.isTerminated:
+		if !ok {
+			return true
+		}
+	default:
+		return false
+	}
+	return false
+}
+
+// Open method is opens the component.
+// Stored data items are kept between Close and Open.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *MemoryMongoDbPersistence[T]) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+	c.isTerminated = make(chan struct{})
+	c.Overrides.DefineSchema()
+	c.opened = true
+	c.Logger.Debug(ctx, correlationId, "Opened in-memory collection %s", c.CollectionName)
+	return nil
+}
+
+// Close methods closes component and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *MemoryMongoDbPersistence[T]) Close(ctx context.Context, correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+	c.opened = false
+	close(c.isTerminated)
+	return nil
+}
+
+// Clear method are clears component state.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MemoryMongoDbPersistence[T]) Clear(ctx context.Context, correlationId string) error {
+	if c.CollectionName == "" {
+		return cerr.NewError("Collection name is not defined")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.documents = make([]bson.M, 0)
+	c.events = make([]outbox.OutboxEvent, 0)
+	return nil
+}
+
+// GetPageByFilter is gets a page of data items retrieved by a given filter and sorted according to sort parameters.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) GetPageByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter JSON object
+//		- paging cdata.PagingParams (optional) paging parameters
+//		- sort any (optional) sorting BSON object
+//		- select  any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: page cdata.DataPage[T], err error a data page or error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlationId string,
+	filter any, paging cdata.PagingParams, sort any, sel any, queryOptions ...MongoDbQueryOption) (page cdata.DataPage[T], err error) {
+
+	skip := paging.GetSkip(-1)
+	take := paging.GetTake((int64)(c.maxPageSize))
+
+	docs, err := c.find(correlationId, filter, sort)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[T](), err
+	}
+	total := len(docs)
+
+	if skip > 0 {
+		if skip > int64(len(docs)) {
+			skip = int64(len(docs))
+		}
+		docs = docs[skip:]
+	}
+	if take >= 0 && int64(len(docs)) > take {
+		docs = docs[:take]
+	}
+
+	items, err := c.decodeDocuments(correlationId, docs, sel)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[T](), err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
+
+	if paging.Total {
+		return *cdata.NewDataPage(items, total), nil
+	}
+	return *cdata.NewDataPage(items, cdata.EmptyTotalValue), nil
+}
+
+// GetListByFilter is gets a list of data items retrieved by a given filter and sorted according to sort parameters.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) GetListByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId	string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- sort any (optional) sorting BSON object
+//		- select any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: items []T, err error data list and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) GetListByFilter(ctx context.Context, correlationId string,
+	filter any, sort any, sel any, queryOptions ...MongoDbQueryOption) (items []T, err error) {
+
+	docs, err := c.find(correlationId, filter, sort)
+	if err != nil {
+		return nil, err
+	}
+	items, err = c.decodeDocuments(correlationId, docs, sel)
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
+	return items, nil
+}
+
+// StreamByFilter is gets data items that match to a given filter as a stream.
+// The stream is closed after the last item, when ctx is cancelled or when the persistence is closed.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) streamByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter JSON object
+//		- sort any (optional) sorting BSON object
+//		- sel any (optional) projection BSON object
+//		- options *MongoDbStreamOptions (optional) streaming options, only BufferSize is used
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: stream <-chan MongoDbStreamItem[T], err error a stream of data items and error, if query failed.
+func (c *MemoryMongoDbPersistence[T]) StreamByFilter(ctx context.Context, correlationId string,
+	filter any, sort any, sel any, options *MongoDbStreamOptions,
+	queryOptions ...MongoDbQueryOption) (stream <-chan MongoDbStreamItem[T], err error) {
+
+	if options == nil {
+		options = &MongoDbStreamOptions{}
+	}
+	if c.IsTerminated() {
+		return nil, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
+	}
+
+	docs, err := c.find(correlationId, filter, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	terminated := c.isTerminated
+	result := make(chan MongoDbStreamItem[T], options.BufferSize)
+
+	go func() {
+		defer close(result)
+
+		for _, doc := range docs {
+			var streamItem MongoDbStreamItem[T]
+			streamItem.Item, streamItem.Err = c.decodeDocument(correlationId, doc, sel)
+
+			select {
+			case result <- streamItem:
+			case <-ctx.Done():
+				return
+			case <-terminated:
+				return
+			}
+		}
+		c.Logger.Trace(ctx, correlationId, "Streamed %d from %s", len(docs), c.CollectionName)
+	}()
+
+	return result, nil
+}
+
+// GetOneByFilter is gets the first data item that matches to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) getOneByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- sort any (optional) sorting BSON object to select the first item
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, found bool, err error a data item, true if it was found and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) GetOneByFilter(ctx context.Context, correlationId string,
+	filter any, sort any, queryOptions ...MongoDbQueryOption) (item T, found bool, err error) {
+
+	docs, err := c.find(correlationId, filter, sort)
+	if err != nil || len(docs) == 0 {
+		return item, false, err
+	}
+	if item, err = c.decodeDocument(correlationId, docs[0], nil); err != nil {
+		return item, false, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved from %s with id = %s", c.CollectionName, docs[0]["_id"])
+	return item, true, nil
+}
+
+// ExistsByFilter is checks if there are data items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) existsByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: exists bool, err error true if matching items exist and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) ExistsByFilter(ctx context.Context, correlationId string,
+	filter any, queryOptions ...MongoDbQueryOption) (exists bool, err error) {
+
+	docs, err := c.find(correlationId, filter, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(docs) > 0, nil
+}
+
+// GetDistinctValues is gets distinct values of a field in data items that match to a given filter.
+// Values of _id field are converted the same way as ids of data items.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) getDistinctValues method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- field string a field path to get values of.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: values []any, err error distinct values and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) GetDistinctValues(ctx context.Context, correlationId string,
+	field string, filter any, queryOptions ...MongoDbQueryOption) (values []any, err error) {
+
+	docs, err := c.find(correlationId, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values = make([]any, 0)
+	parts := strings.Split(field, ".")
+	for _, doc := range docs {
+		found, _ := lookupMemoryPath(doc, parts)
+		for _, value := range found {
+			candidates := []any{value}
+			if arr, ok := value.(bson.A); ok {
+				candidates = arr
+			}
+			for _, candidate := range candidates {
+				if !matchMemoryEquals(values, true, candidate) {
+					values = append(values, candidate)
+				}
+			}
+		}
+	}
+
+	if field == "_id" && c.toPublicId != nil {
+		for i, value := range values {
+			values[i] = c.toPublicId(value)
+		}
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d distinct values of %s from %s", len(values), field, c.CollectionName)
+	return values, nil
+}
+
+// GetOneRandom is gets a random item from items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) getOneRandom method from child class that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item any, err error random item or zero value if no items match and error, if theq are occured
+func (c *MemoryMongoDbPersistence[T]) GetOneRandom(ctx context.Context, correlationId string,
+	filter any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	items, err := c.GetRandomList(ctx, correlationId, filter, 1)
+	if err != nil || len(items) == 0 {
+		return item, err
+	}
+	return items[0], nil
+}
+
+// GetRandomList is gets a list of random items from items that match to a given filter.
+// The list contains less items if not enough items match to the filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) getRandomList method from child class that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- size int64 maximum number of items to be retrieved.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: items []T, err error random items and error, if they are occured
+func (c *MemoryMongoDbPersistence[T]) GetRandomList(ctx context.Context, correlationId string,
+	filter any, size int64, queryOptions ...MongoDbQueryOption) (items []T, err error) {
+
+	if size <= 0 {
+		return make([]T, 0), nil
+	}
+
+	docs, err := c.find(correlationId, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(docs), func(i, j int) { docs[i], docs[j] = docs[j], docs[i] })
+	if int64(len(docs)) > size {
+		docs = docs[:size]
+	}
+
+	items, err = c.decodeDocuments(correlationId, docs, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d random items from %s", len(items), c.CollectionName)
+	return items, nil
+}
+
+// Create was creates a data item.
+// Like MongoDB, it generates an ObjectID for data items without _id.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- item any an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result any, err error created item and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) Create(ctx context.Context, correlationId string, item T,
+	queryOptions ...MongoDbQueryOption) (result T, err error) {
+	newItem, err := c.Overrides.ConvertFromPublic(item)
+	if err != nil {
+		return result, err
+	}
+	doc, err := toMemoryDocument(correlationId, newItem)
+	if err != nil {
+		return result, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	if err := c.insert(ctx, correlationId, doc); err != nil {
+		return result, err
+	}
+
+	result, err = c.Overrides.ConvertToPublic(newItem)
+	if err != nil {
+		return result, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Created in %s with id = %s", c.CollectionName, doc["_id"])
+	return result, nil
+}
+
+// DeleteByFilter is deletes data items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) deleteByFilter method from child class that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: error or nil for success.
+func (c *MemoryMongoDbPersistence[T]) DeleteByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) error {
+	query, err := toMemoryDocument(correlationId, filter)
+	if err != nil {
+		return err
+	}
+	if err := c.checkOpened(correlationId); err != nil {
+		return err
+	}
+
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	kept := make([]bson.M, 0, len(c.documents))
+	deletedDocs := make([]bson.M, 0)
+	for _, doc := range c.documents {
+		matched, err := matchMemoryDocument(correlationId, doc, query)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			kept = append(kept, doc)
+		} else {
+			deletedDocs = append(deletedDocs, doc)
+		}
+	}
+	for _, doc := range deletedDocs {
+		transaction.recordDocument(doc["_id"], doc)
+	}
+	deleted := len(c.documents) - len(kept)
+	c.documents = kept
+
+	c.Logger.Trace(ctx, correlationId, "Deleted %d items from %s", deleted, c.CollectionName)
+	return nil
+}
+
+// UpdateByFilter is updates all data items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) updateByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: result MongoDbUpdateResult, err error counts of updated items and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) UpdateByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (result MongoDbUpdateResult, err error) {
+
+	_, result, err = c.update(ctx, correlationId, filter, update, true, false)
+	if err != nil {
+		return result, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Updated %d items in %s", result.ModifiedCount, c.CollectionName)
+	return result, nil
+}
+
+// UpdateOneByFilter is updates the first data item that matches to a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) updateOneByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) UpdateOneByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	return c.updateOne(ctx, correlationId, filter, update, false)
+}
+
+// UpsertByFilter is updates the first data item that matches to a given filter
+// or creates a new one from the filter equality fields and the update if no items match.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) upsertByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: item T, err error updated or created item and error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) UpsertByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	return c.updateOne(ctx, correlationId, filter, update, true)
+}
+
+func (c *MemoryMongoDbPersistence[T]) updateOne(ctx context.Context, correlationId string,
+	filter any, update any, upsert bool) (item T, err error) {
+
+	docs, _, err := c.update(ctx, correlationId, filter, update, false, upsert)
+	if err != nil || len(docs) == 0 {
+		return item, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Updated in %s with id = %s", c.CollectionName, docs[0]["_id"])
+	return c.decodeDocument(correlationId, docs[0], nil)
+}
+
+// GetCountByFilter is gets a count of data items retrieved by a given filter.
+// This method shall be called by a func (c *IdentifiableMemoryMongoDbPersistence) GetCountByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- filter any
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, query options are not supported in memory
+//	Returns: count int, err error a data count or error, if they are occurred
+func (c *MemoryMongoDbPersistence[T]) GetCountByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) (count int64, err error) {
+	docs, err := c.find(correlationId, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+	count = int64(len(docs))
+	c.Logger.Trace(ctx, correlationId, "Find %d items in %s", count, c.CollectionName)
+	return count, nil
+}
+
+// ExecuteInTransaction executes an action and reverts changes made by it when the action fails.
+// Nested calls with the context passed to the action join the outer transaction.
+// Only documents and events changed by the action are restored, concurrent changes of other documents are kept.
+// Unlike MongoDB transactions, changes are visible to other callers before the action completes,
+// and concurrent changes of the same documents are overwritten by the rollback. Clear is not reverted.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- action func(ctx context.Context) error an action to execute.
+//	Returns: error or nil when the transaction was committed.
+func (c *MemoryMongoDbPersistence[T]) ExecuteInTransaction(ctx context.Context, correlationId string,
+	action func(ctx context.Context) error) error {
+
+	if c.transactionOf(ctx) != nil {
+		return action(ctx)
+	}
+
+	transaction := &memoryTransaction{}
+	if err := action(context.WithValue(ctx, memoryTransactionKey{owner: c}, transaction)); err != nil {
+		c.rollback(transaction)
+		return err
+	}
+	return nil
+}
+
+// transactionOf gets the transaction of the persistence carried by the context or nil.
+func (c *MemoryMongoDbPersistence[T]) transactionOf(ctx context.Context) *memoryTransaction {
+	if ctx == nil {
+		return nil
+	}
+	transaction, _ := ctx.Value(memoryTransactionKey{owner: c}).(*memoryTransaction)
+	return transaction
+}
+
+// rollback restores original states of documents and removes events recorded by the transaction.
+func (c *MemoryMongoDbPersistence[T]) rollback(transaction *memoryTransaction) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, undo := range transaction.documents {
+		index := c.indexOf(undo.id)
+		switch {
+		case undo.doc == nil && index >= 0:
+			c.documents = append(c.documents[:index:index], c.documents[index+1:]...)
+		case undo.doc != nil && index >= 0:
+			c.documents[index] = undo.doc
+		case undo.doc != nil:
+			c.documents = append(c.documents, undo.doc)
+		}
+	}
+
+	if len(transaction.events) > 0 {
+		enqueued := make(map[string]bool, len(transaction.events))
+		for _, id := range transaction.events {
+			enqueued[id] = true
+		}
+		kept := make([]outbox.OutboxEvent, 0, len(c.events))
+		for _, event := range c.events {
+			if !enqueued[event.Id] {
+				kept = append(kept, event)
+			}
+		}
+		c.events = kept
+	}
+}
+
+func (c *MemoryMongoDbPersistence[T]) checkOpened(correlationId string) error {
+	if !c.opened {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+	return nil
+}
+
+// find gets stored documents that match to a filter ordered by sort document.
+// Stored documents are never changed in place, so they can be read without lock.
+func (c *MemoryMongoDbPersistence[T]) find(correlationId string, filter any, sort any) ([]bson.M, error) {
+	query, err := toMemoryDocument(correlationId, filter)
+	if err != nil {
+		return nil, err
+	}
+	sortKeys, err := parseMemorySort(correlationId, sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkOpened(correlationId); err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	docs := make([]bson.M, 0)
+	for _, doc := range c.documents {
+		matched, err := matchMemoryDocument(correlationId, doc, query)
+		if err != nil {
+			c.lock.RUnlock()
+			return nil, err
+		}
+		if matched {
+			docs = append(docs, doc)
+		}
+	}
+	c.lock.RUnlock()
+
+	sortMemoryDocuments(docs, sortKeys)
+	return docs, nil
+}
+
+// indexOf gets a position of a stored document by its id or -1 if it's not found.
+func (c *MemoryMongoDbPersistence[T]) indexOf(id any) int {
+	for i, doc := range c.documents {
+		if cmp, sameType := compareMemoryValues(doc["_id"], id); sameType && cmp == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// insert stores a new document. It fails with a duplicate key error if a document with the same id exists.
+func (c *MemoryMongoDbPersistence[T]) insert(ctx context.Context, correlationId string, doc bson.M) error {
+	if err := c.checkOpened(correlationId); err != nil {
+		return err
+	}
+
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.indexOf(doc["_id"]) >= 0 {
+		return c.duplicateKeyError(doc["_id"])
+	}
+	transaction.recordDocument(doc["_id"], nil)
+	c.documents = append(c.documents, doc)
+	return nil
+}
+
+// duplicateKeyError composes the same error as MongoDB driver, so mongo.IsDuplicateKeyError can be used.
+func (c *MemoryMongoDbPersistence[T]) duplicateKeyError(id any) error {
+	return mongodrv.WriteException{
+		WriteErrors: mongodrv.WriteErrors{{
+			Code:    11000,
+			Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", c.CollectionName, id),
+		}},
+	}
+}
+
+// update applies an update to the first or all documents that match to a filter.
+// When upsert is true and no documents match, a new one is inserted.
+// Returns the updated documents.
+func (c *MemoryMongoDbPersistence[T]) update(ctx context.Context, correlationId string, filter any, update any,
+	multi bool, upsert bool) (docs []bson.M, result MongoDbUpdateResult, err error) {
+
+	doc, arrayFilters, err := composeUpdate(correlationId, update)
+	if err != nil {
+		return nil, result, err
+	}
+	if arrayFilters != nil {
+		return nil, result, unsupportedMemoryOperator(correlationId, "array filters")
+	}
+	updateDoc, err := toMemoryUpdate(correlationId, doc)
+	if err != nil {
+		return nil, result, err
+	}
+	query, err := toMemoryDocument(correlationId, filter)
+	if err != nil {
+		return nil, result, err
+	}
+	if err := c.checkOpened(correlationId); err != nil {
+		return nil, result, err
+	}
+
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Changes are applied to copies and stored only when all of them succeed
+	positions := make([]int, 0)
+	docs = make([]bson.M, 0)
+	for i, stored := range c.documents {
+		matched, err := matchMemoryDocument(correlationId, stored, query)
+		if err != nil {
+			return nil, result, err
+		}
+		if !matched {
+			continue
+		}
+
+		updated := copyMemoryValue(stored).(bson.M)
+		if err := applyMemoryUpdate(correlationId, updated, updateDoc, false); err != nil {
+			return nil, result, err
+		}
+		result.MatchedCount++
+		if !reflect.DeepEqual(stored, updated) {
+			result.ModifiedCount++
+		}
+		positions = append(positions, i)
+		docs = append(docs, updated)
+		if !multi {
+			break
+		}
+	}
+
+	if len(docs) == 0 && upsert {
+		inserted := seedMemoryDocument(query)
+		if err := applyMemoryUpdate(correlationId, inserted, updateDoc, true); err != nil {
+			return nil, result, err
+		}
+		if _, ok := inserted["_id"]; !ok {
+			inserted["_id"] = primitive.NewObjectID()
+		}
+		if c.indexOf(inserted["_id"]) >= 0 {
+			return nil, result, c.duplicateKeyError(inserted["_id"])
+		}
+		transaction.recordDocument(inserted["_id"], nil)
+		c.documents = append(c.documents, inserted)
+		return []bson.M{inserted}, result, nil
+	}
+
+	for i, position := range positions {
+		transaction.recordDocument(c.documents[position]["_id"], c.documents[position])
+		c.documents[position] = docs[i]
+	}
+	return docs, result, nil
+}
+
+// replace replaces a stored document with the same id or inserts a new one.
+func (c *MemoryMongoDbPersistence[T]) replace(ctx context.Context, correlationId string, doc bson.M) error {
+	if err := c.checkOpened(correlationId); err != nil {
+		return err
+	}
+
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if index := c.indexOf(doc["_id"]); index >= 0 {
+		transaction.recordDocument(doc["_id"], c.documents[index])
+		c.documents[index] = doc
+	} else {
+		transaction.recordDocument(doc["_id"], nil)
+		c.documents = append(c.documents, doc)
+	}
+	return nil
+}
+
+// remove deletes a stored document by its id. Returns the deleted document or nil if it wasn't found.
+func (c *MemoryMongoDbPersistence[T]) remove(ctx context.Context, correlationId string, id any) (bson.M, error) {
+	if err := c.checkOpened(correlationId); err != nil {
+		return nil, err
+	}
+
+	transaction := c.transactionOf(ctx)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index := c.indexOf(id)
+	if index < 0 {
+		return nil, nil
+	}
+	doc := c.documents[index]
+	transaction.recordDocument(doc["_id"], doc)
+	c.documents = append(c.documents[:index:index], c.documents[index+1:]...)
+	return doc, nil
+}
+
+// decodeDocument applies a projection to a stored document and converts it into a public object
+// with Overrides.ConvertToPublic the same way as MongoDbPersistence does.
+func (c *MemoryMongoDbPersistence[T]) decodeDocument(correlationId string, doc bson.M, sel any) (item T, err error) {
+	projected, err := projectMemoryDocument(correlationId, doc, sel)
+	if err != nil {
+		return item, err
+	}
+	buf, err := bson.Marshal(projected)
+	if err != nil {
+		return item, err
+	}
+	var docPointer map[string]any
+	if err = bson.Unmarshal(buf, &docPointer); err != nil {
+		return item, err
+	}
+	if c.toPublicId != nil {
+		if id, ok := docPointer["_id"]; ok {
+			docPointer["_id"] = c.toPublicId(id)
+		}
+	}
+	return c.Overrides.ConvertToPublic(docPointer)
+}
+
+func (c *MemoryMongoDbPersistence[T]) decodeDocuments(correlationId string, docs []bson.M, sel any) ([]T, error) {
+	items := make([]T, 0, len(docs))
+	for _, doc := range docs {
+		item, err := c.decodeDocument(correlationId, doc, sel)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,1048 @@
+package persistence
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Order of BSON types in comparisons and sorting
+const (
+	memoryTypeNull = iota
+	memoryTypeNumber
+	memoryTypeString
+	memoryTypeDocument
+	memoryTypeArray
+	memoryTypeBinary
+	memoryTypeObjectId
+	memoryTypeBoolean
+	memoryTypeDate
+	memoryTypeTimestamp
+	memoryTypeRegex
+	memoryTypeOther
+)
+
+type memorySortKey struct {
+	path      []string
+	direction int
+}
+
+func unsupportedMemoryOperator(correlationId string, operator string) error {
+	return cerr.NewBadRequestError(correlationId, "UNSUPPORTED_OPERATOR",
+		"Operator "+operator+" is not supported by in-memory persistence").
+		WithDetails("operator", operator)
+}
+
+func invalidMemoryQuery(correlationId string, message string) *cerr.ApplicationError {
+	return cerr.NewBadRequestError(correlationId, "INVALID_QUERY", message)
+}
+
+// toMemoryDocument converts a BSON document of any type into a detached bson.M
+// with nested documents as bson.M and arrays as bson.A.
+func toMemoryDocument(correlationId string, doc any) (bson.M, error) {
+	if doc == nil {
+		return bson.M{}, nil
+	}
+	buf, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, invalidMemoryQuery(correlationId, "Value is not a valid BSON document").WithCause(err)
+	}
+	var result bson.M
+	if err := bson.Unmarshal(buf, &result); err != nil {
+		return nil, invalidMemoryQuery(correlationId, "Value is not a valid BSON document").WithCause(err)
+	}
+	return normalizeMemoryValue(result).(bson.M), nil
+}
+
+func normalizeMemoryValue(value any) any {
+	switch v := value.(type) {
+	case bson.M:
+		for key, item := range v {
+			v[key] = normalizeMemoryValue(item)
+		}
+		return v
+	case map[string]any:
+		result := make(bson.M, len(v))
+		for key, item := range v {
+			result[key] = normalizeMemoryValue(item)
+		}
+		return result
+	case bson.D:
+		result := make(bson.M, len(v))
+		for _, e := range v {
+			result[e.Key] = normalizeMemoryValue(e.Value)
+		}
+		return result
+	case bson.A:
+		for i, item := range v {
+			v[i] = normalizeMemoryValue(item)
+		}
+		return v
+	case []any:
+		result := make(bson.A, len(v))
+		for i, item := range v {
+			result[i] = normalizeMemoryValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// copyMemoryValue makes a deep copy of documents and arrays.
+func copyMemoryValue(value any) any {
+	switch v := value.(type) {
+	case bson.M:
+		result := make(bson.M, len(v))
+		for key, item := range v {
+			result[key] = copyMemoryValue(item)
+		}
+		return result
+	case bson.A:
+		result := make(bson.A, len(v))
+		for i, item := range v {
+			result[i] = copyMemoryValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// lookupMemoryPath gets values by a dotted path. Arrays on the path are traversed
+// by numeric indexes or by all their elements.
+func lookupMemoryPath(value any, parts []string) (values []any, exists bool) {
+	if len(parts) == 0 {
+		return []any{value}, true
+	}
+	switch v := value.(type) {
+	case bson.M:
+		next, ok := v[parts[0]]
+		if !ok {
+			return nil, false
+		}
+		return lookupMemoryPath(next, parts[1:])
+	case bson.A:
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index < 0 || index >= len(v) {
+				return nil, false
+			}
+			return lookupMemoryPath(v[index], parts[1:])
+		}
+		for _, item := range v {
+			if _, ok := item.(bson.M); !ok {
+				continue
+			}
+			if found, ok := lookupMemoryPath(item, parts); ok {
+				values = append(values, found...)
+				exists = true
+			}
+		}
+		return values, exists
+	}
+	return nil, false
+}
+
+// expandMemoryValues adds elements of array values to the values.
+func expandMemoryValues(values []any) []any {
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+		if arr, ok := value.(bson.A); ok {
+			result = append(result, arr...)
+		}
+	}
+	return result
+}
+
+func isMemoryOperatorDocument(doc bson.M) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// matchMemoryDocument checks if a document matches to a query.
+func matchMemoryDocument(correlationId string, doc bson.M, query bson.M) (bool, error) {
+	for key, condition := range query {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchMemoryLogical(correlationId, doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, unsupportedMemoryOperator(correlationId, key)
+			}
+			values, exists := lookupMemoryPath(doc, strings.Split(key, "."))
+			matched, err = matchMemoryCondition(correlationId, values, exists, condition)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchMemoryLogical(correlationId string, doc bson.M, operator string, condition any) (bool, error) {
+	queries, ok := condition.(bson.A)
+	if !ok || len(queries) == 0 {
+		return false, invalidMemoryQuery(correlationId, operator+" must be a nonempty array")
+	}
+	for _, item := range queries {
+		query, ok := item.(bson.M)
+		if !ok {
+			return false, invalidMemoryQuery(correlationId, operator+" must contain only documents")
+		}
+		matched, err := matchMemoryDocument(correlationId, doc, query)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !matched:
+			return false, nil
+		case operator == "$or" && matched:
+			return true, nil
+		case operator == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return operator != "$or", nil
+}
+
+// matchMemoryCondition checks if field values match to a value or a document with query operators.
+func matchMemoryCondition(correlationId string, values []any, exists bool, condition any) (bool, error) {
+	if regex, ok := condition.(primitive.Regex); ok {
+		return matchMemoryRegex(correlationId, values, regex.Pattern, regex.Options)
+	}
+	operators, ok := condition.(bson.M)
+	if !ok || !isMemoryOperatorDocument(operators) {
+		return matchMemoryEquals(values, exists, condition), nil
+	}
+	for operator, operand := range operators {
+		if operator == "$options" {
+			continue
+		}
+		matched, err := matchMemoryOperator(correlationId, values, exists, operator, operand, operators)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchMemoryOperator(correlationId string, values []any, exists bool,
+	operator string, operand any, operators bson.M) (bool, error) {
+
+	switch operator {
+	case "$eq":
+		return matchMemoryEquals(values, exists, operand), nil
+	case "$ne":
+		return !matchMemoryEquals(values, exists, operand), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, value := range expandMemoryValues(values) {
+			cmp, sameType := compareMemoryValues(value, operand)
+			if !sameType {
+				continue
+			}
+			if (operator == "$gt" && cmp > 0) || (operator == "$gte" && cmp >= 0) ||
+				(operator == "$lt" && cmp < 0) || (operator == "$lte" && cmp <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		list, ok := operand.(bson.A)
+		if !ok {
+			return false, invalidMemoryQuery(correlationId, operator+" needs an array")
+		}
+		found := false
+		for _, item := range list {
+			matched, err := matchMemoryCondition(correlationId, values, exists, item)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$exists":
+		return exists == isMemoryTruthy(operand), nil
+	case "$regex":
+		options, _ := operators["$options"].(string)
+		switch v := operand.(type) {
+		case string:
+			return matchMemoryRegex(correlationId, values, v, options)
+		case primitive.Regex:
+			if options == "" {
+				options = v.Options
+			}
+			return matchMemoryRegex(correlationId, values, v.Pattern, options)
+		}
+		return false, invalidMemoryQuery(correlationId, "$regex has to be a string")
+	case "$not":
+		if _, ok := operand.(primitive.Regex); !ok {
+			if doc, ok := operand.(bson.M); !ok || !isMemoryOperatorDocument(doc) {
+				return false, invalidMemoryQuery(correlationId, "$not needs a regex or a document with operators")
+			}
+		}
+		matched, err := matchMemoryCondition(correlationId, values, exists, operand)
+		return !matched, err
+	case "$size":
+		size, ok := toMemoryNumber(operand)
+		if !ok {
+			return false, invalidMemoryQuery(correlationId, "$size needs a number")
+		}
+		for _, value := range values {
+			if arr, ok := value.(bson.A); ok && float64(len(arr)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := operand.(bson.A)
+		if !ok {
+			return false, invalidMemoryQuery(correlationId, "$all needs an array")
+		}
+		for _, item := range list {
+			matched, err := matchMemoryCondition(correlationId, values, exists, item)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		query, ok := operand.(bson.M)
+		if !ok {
+			return false, invalidMemoryQuery(correlationId, "$elemMatch needs a document")
+		}
+		for _, value := range values {
+			arr, ok := value.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, item := range arr {
+				matched, err := matchMemoryElement(correlationId, item, query)
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, unsupportedMemoryOperator(correlationId, operator)
+}
+
+// matchMemoryElement checks if an array element matches to a query or a document with operators.
+func matchMemoryElement(correlationId string, item any, query bson.M) (bool, error) {
+	if isMemoryOperatorDocument(query) {
+		return matchMemoryCondition(correlationId, []any{item}, true, query)
+	}
+	doc, ok := item.(bson.M)
+	if !ok {
+		return false, nil
+	}
+	return matchMemoryDocument(correlationId, doc, query)
+}
+
+func matchMemoryEquals(values []any, exists bool, operand any) bool {
+	if operand == nil && !exists {
+		return true
+	}
+	for _, value := range expandMemoryValues(values) {
+		if cmp, sameType := compareMemoryValues(value, operand); sameType && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMemoryRegex(correlationId string, values []any, pattern string, options string) (bool, error) {
+	flags := ""
+	for _, option := range options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		default:
+			return false, invalidMemoryQuery(correlationId, "Regex option "+string(option)+" is not supported")
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, invalidMemoryQuery(correlationId, "Invalid regex "+pattern).WithCause(err)
+	}
+	for _, value := range expandMemoryValues(values) {
+		if str, ok := value.(string); ok && regex.MatchString(str) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isMemoryTruthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	if number, ok := toMemoryNumber(value); ok {
+		return number != 0
+	}
+	return true
+}
+
+func toMemoryNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func memoryTypeOf(value any) int {
+	switch value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return memoryTypeNull
+	case int, int32, int64, float32, float64:
+		return memoryTypeNumber
+	case string, primitive.Symbol:
+		return memoryTypeString
+	case bson.M:
+		return memoryTypeDocument
+	case bson.A:
+		return memoryTypeArray
+	case primitive.Binary:
+		return memoryTypeBinary
+	case primitive.ObjectID:
+		return memoryTypeObjectId
+	case bool:
+		return memoryTypeBoolean
+	case primitive.DateTime:
+		return memoryTypeDate
+	case primitive.Timestamp:
+		return memoryTypeTimestamp
+	case primitive.Regex:
+		return memoryTypeRegex
+	}
+	return memoryTypeOther
+}
+
+// compareMemoryValues compares two values in order of BSON types.
+// Returns a comparison result and true if the values have the same type.
+func compareMemoryValues(a any, b any) (int, bool) {
+	typeA, typeB := memoryTypeOf(a), memoryTypeOf(b)
+	if typeA != typeB {
+		return typeA - typeB, false
+	}
+
+	switch typeA {
+	case memoryTypeNull:
+		return 0, true
+	case memoryTypeNumber:
+		numberA, _ := toMemoryNumber(a)
+		numberB, _ := toMemoryNumber(b)
+		return compareMemoryOrdered(numberA, numberB), true
+	case memoryTypeString:
+		return strings.Compare(memoryString(a), memoryString(b)), true
+	case memoryTypeDocument:
+		return compareMemoryDocuments(a.(bson.M), b.(bson.M)), true
+	case memoryTypeArray:
+		arrA, arrB := a.(bson.A), b.(bson.A)
+		for i := 0; i < len(arrA) && i < len(arrB); i++ {
+			if cmp, _ := compareMemoryValues(arrA[i], arrB[i]); cmp != 0 {
+				return cmp, true
+			}
+		}
+		return len(arrA) - len(arrB), true
+	case memoryTypeBinary:
+		return bytes.Compare(a.(primitive.Binary).Data, b.(primitive.Binary).Data), true
+	case memoryTypeObjectId:
+		idA, idB := a.(primitive.ObjectID), b.(primitive.ObjectID)
+		return bytes.Compare(idA[:], idB[:]), true
+	case memoryTypeBoolean:
+		boolA, boolB := a.(bool), b.(bool)
+		if boolA == boolB {
+			return 0, true
+		} else if boolB {
+			return -1, true
+		}
+		return 1, true
+	case memoryTypeDate:
+		return compareMemoryOrdered(a.(primitive.DateTime), b.(primitive.DateTime)), true
+	case memoryTypeTimestamp:
+		return primitive.CompareTimestamp(a.(primitive.Timestamp), b.(primitive.Timestamp)), true
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 1, true
+}
+
+func compareMemoryOrdered[V int64 | float64 | primitive.DateTime](a V, b V) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func memoryString(value any) string {
+	if symbol, ok := value.(primitive.Symbol); ok {
+		return string(symbol)
+	}
+	return value.(string)
+}
+
+func compareMemoryDocuments(a bson.M, b bson.M) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := b[key]
+		if !ok {
+			return 1
+		}
+		if cmp, _ := compareMemoryValues(a[key], value); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// parseMemorySort converts a sort document into sort keys.
+// Keys of unordered maps are sorted by names.
+func parseMemorySort(correlationId string, sortDoc any) ([]memorySortKey, error) {
+	fields := make(bson.D, 0)
+	switch v := sortDoc.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		fields = v
+	case bson.M:
+		fields = sortedMemoryFields(v)
+	case map[string]any:
+		fields = sortedMemoryFields(v)
+	default:
+		return nil, invalidMemoryQuery(correlationId, "Sort must be bson.D or bson.M document")
+	}
+
+	keys := make([]memorySortKey, 0, len(fields))
+	for _, field := range fields {
+		direction, ok := toMemoryNumber(field.Value)
+		if !ok {
+			return nil, invalidMemoryQuery(correlationId, "Sort direction of "+field.Key+" must be 1 or -1")
+		}
+		key := memorySortKey{path: strings.Split(field.Key, "."), direction: 1}
+		if direction < 0 {
+			key.direction = -1
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func sortedMemoryFields(doc map[string]any) bson.D {
+	fields := make(bson.D, 0, len(doc))
+	for key, value := range doc {
+		fields = append(fields, bson.E{Key: key, Value: value})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	return fields
+}
+
+func sortMemoryDocuments(docs []bson.M, keys []memorySortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			cmp, _ := compareMemoryValues(memorySortValue(docs[i], key), memorySortValue(docs[j], key))
+			if cmp != 0 {
+				return cmp*key.direction < 0
+			}
+		}
+		return false
+	})
+}
+
+// memorySortValue gets a value to sort a document by. Arrays are sorted
+// by their lowest elements in ascending order and by the highest ones in descending order.
+func memorySortValue(doc bson.M, key memorySortKey) any {
+	values, exists := lookupMemoryPath(doc, key.path)
+	if !exists {
+		return nil
+	}
+	candidates := make([]any, 0, len(values))
+	for _, value := range values {
+		if arr, ok := value.(bson.A); ok {
+			candidates = append(candidates, arr...)
+		} else {
+			candidates = append(candidates, value)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	result := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if cmp, _ := compareMemoryValues(candidate, result); cmp*key.direction < 0 {
+			result = candidate
+		}
+	}
+	return result
+}
+
+// projectMemoryDocument applies an inclusion or exclusion projection to a document.
+func projectMemoryDocument(correlationId string, doc bson.M, projection any) (bson.M, error) {
+	if isEmptyDocument(projection) {
+		return doc, nil
+	}
+	spec, err := toMemoryDocument(correlationId, projection)
+	if err != nil {
+		return nil, err
+	}
+
+	includeId := true
+	fields := make(map[string]bool, len(spec))
+	include, exclude := false, false
+	for key, value := range spec {
+		if _, ok := value.(bool); !ok {
+			if _, ok := toMemoryNumber(value); !ok {
+				return nil, unsupportedMemoryOperator(correlationId, "projection of "+key)
+			}
+		}
+		flag := isMemoryTruthy(value)
+		if key == "_id" {
+			includeId = flag
+			continue
+		}
+		fields[key] = flag
+		include = include || flag
+		exclude = exclude || !flag
+	}
+	if include && exclude {
+		return nil, invalidMemoryQuery(correlationId, "Projection can't mix inclusion and exclusion")
+	}
+
+	if include {
+		result := bson.M{}
+		if id, ok := doc["_id"]; ok && includeId {
+			result["_id"] = id
+		}
+		for key := range fields {
+			copyMemoryPath(doc, result, strings.Split(key, "."))
+		}
+		return result, nil
+	}
+
+	result := copyMemoryValue(doc).(bson.M)
+	for key := range fields {
+		deleteMemoryPath(result, strings.Split(key, "."))
+	}
+	if !includeId {
+		delete(result, "_id")
+	}
+	return result, nil
+}
+
+func copyMemoryPath(src bson.M, dst bson.M, parts []string) {
+	value, ok := src[parts[0]]
+	if !ok {
+		return
+	}
+	if len(parts) == 1 {
+		dst[parts[0]] = value
+		return
+	}
+	switch v := value.(type) {
+	case bson.M:
+		sub, ok := dst[parts[0]].(bson.M)
+		if !ok {
+			sub = bson.M{}
+			dst[parts[0]] = sub
+		}
+		copyMemoryPath(v, sub, parts[1:])
+	case bson.A:
+		existing, _ := dst[parts[0]].(bson.A)
+		result := make(bson.A, 0, len(v))
+		for _, item := range v {
+			doc, ok := item.(bson.M)
+			if !ok {
+				continue
+			}
+			target := bson.M{}
+			if len(result) < len(existing) {
+				if prev, ok := existing[len(result)].(bson.M); ok {
+					target = prev
+				}
+			}
+			copyMemoryPath(doc, target, parts[1:])
+			result = append(result, target)
+		}
+		dst[parts[0]] = result
+	}
+}
+
+func deleteMemoryPath(doc bson.M, parts []string) {
+	if len(parts) == 1 {
+		delete(doc, parts[0])
+		return
+	}
+	switch v := doc[parts[0]].(type) {
+	case bson.M:
+		deleteMemoryPath(v, parts[1:])
+	case bson.A:
+		for _, item := range v {
+			if sub, ok := item.(bson.M); ok {
+				deleteMemoryPath(sub, parts[1:])
+			}
+		}
+	}
+}
+
+// toMemoryUpdate converts an update document with operators into bson.M.
+// Aggregation pipelines are not supported.
+func toMemoryUpdate(correlationId string, update any) (bson.M, error) {
+	switch update.(type) {
+	case bson.A, []any, []bson.D, []bson.M, mongodrv.Pipeline:
+		return nil, unsupportedMemoryOperator(correlationId, "update pipeline")
+	}
+	doc, err := toMemoryDocument(correlationId, update)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, cerr.NewBadRequestError(correlationId, "EMPTY_UPDATE", "Update has no operations")
+	}
+	for operator := range doc {
+		if !strings.HasPrefix(operator, "$") {
+			return nil, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update document must contain only update operators").
+				WithDetails("field", operator)
+		}
+	}
+	return doc, nil
+}
+
+// applyMemoryUpdate applies update operators to a document.
+// $setOnInsert is applied only when the document is inserted by upsert.
+func applyMemoryUpdate(correlationId string, doc bson.M, update bson.M, inserted bool) error {
+	operators := make([]string, 0, len(update))
+	for operator := range update {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	for _, operator := range operators {
+		fields, ok := update[operator].(bson.M)
+		if !ok {
+			return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Operator "+operator+" needs a document with fields").
+				WithDetails("operator", operator)
+		}
+		for _, field := range sortedMemoryFields(fields) {
+			if err := applyMemoryOperator(correlationId, doc, operator, field.Key, field.Value, inserted); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyMemoryOperator(correlationId string, doc bson.M, operator string, path string, operand any, inserted bool) error {
+	parts := strings.Split(path, ".")
+	for _, part := range parts {
+		if strings.HasPrefix(part, "$") {
+			return unsupportedMemoryOperator(correlationId, "positional "+part)
+		}
+	}
+	if parts[0] == "_id" && operator != "$setOnInsert" && !inserted {
+		if cmp, sameType := compareMemoryValues(doc["_id"], operand); operator != "$set" || !sameType || cmp != 0 {
+			return cerr.NewBadRequestError(correlationId, "IMMUTABLE_FIELD", "Field _id can't be changed").
+				WithDetails("path", path)
+		}
+		return nil
+	}
+
+	set := func(value any, exists bool) (any, bool, error) {
+		return copyMemoryValue(operand), true, nil
+	}
+
+	var err error
+	switch operator {
+	case "$set":
+		_, err = updateMemoryField(correlationId, doc, parts, true, set)
+	case "$setOnInsert":
+		if inserted {
+			_, err = updateMemoryField(correlationId, doc, parts, true, set)
+		}
+	case "$unset":
+		_, err = updateMemoryField(correlationId, doc, parts, false, func(value any, exists bool) (any, bool, error) {
+			return nil, false, nil
+		})
+	case "$inc":
+		_, err = updateMemoryField(correlationId, doc, parts, true, func(value any, exists bool) (any, bool, error) {
+			if !exists {
+				value = int32(0)
+			}
+			result, ok := addMemoryNumbers(value, operand)
+			if !ok {
+				return nil, false, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+					"Can't increment non-numeric value of "+path).
+					WithDetails("path", path)
+			}
+			return result, true, nil
+		})
+	case "$push", "$addToSet":
+		items, eachErr := memoryEachValues(correlationId, operand)
+		if eachErr != nil {
+			return eachErr
+		}
+		_, err = updateMemoryField(correlationId, doc, parts, true, func(value any, exists bool) (any, bool, error) {
+			arr, ok := value.(bson.A)
+			if exists && !ok {
+				return nil, false, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+					"Can't apply "+operator+" to non-array value of "+path).
+					WithDetails("path", path)
+			}
+			result := append(bson.A{}, arr...)
+			for _, item := range items {
+				if operator == "$addToSet" && matchMemoryEquals([]any{result}, true, item) {
+					continue
+				}
+				result = append(result, copyMemoryValue(item))
+			}
+			return result, true, nil
+		})
+	case "$pull":
+		_, err = updateMemoryField(correlationId, doc, parts, false, func(value any, exists bool) (any, bool, error) {
+			if !exists {
+				return nil, false, nil
+			}
+			arr, ok := value.(bson.A)
+			if !ok {
+				return nil, false, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+					"Can't apply $pull to non-array value of "+path).
+					WithDetails("path", path)
+			}
+			result := bson.A{}
+			for _, item := range arr {
+				var matched bool
+				var matchErr error
+				if query, ok := operand.(bson.M); ok {
+					matched, matchErr = matchMemoryElement(correlationId, item, query)
+				} else {
+					matched, matchErr = matchMemoryCondition(correlationId, []any{item}, true, operand)
+				}
+				if matchErr != nil {
+					return nil, false, matchErr
+				}
+				if !matched {
+					result = append(result, item)
+				}
+			}
+			return result, true, nil
+		})
+	default:
+		return unsupportedMemoryOperator(correlationId, operator)
+	}
+	return err
+}
+
+// updateMemoryField finds a field by path and replaces its value with the result of the update function.
+// The update function returns false to remove the field. Missing documents on the path are created
+// only when create is true.
+func updateMemoryField(correlationId string, container any, parts []string, create bool,
+	update func(value any, exists bool) (any, bool, error)) (any, error) {
+
+	switch v := container.(type) {
+	case bson.M:
+		value, exists := v[parts[0]]
+		if len(parts) == 1 {
+			result, keep, err := update(value, exists)
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				v[parts[0]] = result
+			} else {
+				delete(v, parts[0])
+			}
+			return v, nil
+		}
+		if !exists || value == nil {
+			if !create {
+				return v, nil
+			}
+			value = bson.M{}
+		}
+		result, err := updateMemoryField(correlationId, value, parts[1:], create, update)
+		if err != nil {
+			return nil, err
+		}
+		v[parts[0]] = result
+		return v, nil
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 {
+			return nil, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Array element "+parts[0]+" must be referenced by index").
+				WithDetails("field", parts[0])
+		}
+		if index >= len(v) {
+			if !create {
+				return v, nil
+			}
+			for len(v) <= index {
+				v = append(v, nil)
+			}
+		}
+		if len(parts) == 1 {
+			result, keep, err := update(v[index], true)
+			if err != nil {
+				return nil, err
+			}
+			// Removed array elements are set to null to keep positions of others
+			if !keep {
+				result = nil
+			}
+			v[index] = result
+			return v, nil
+		}
+		value := v[index]
+		if value == nil {
+			if !create {
+				return v, nil
+			}
+			value = bson.M{}
+		}
+		result, err := updateMemoryField(correlationId, value, parts[1:], create, update)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = result
+		return v, nil
+	}
+	return nil, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+		"Can't update field "+parts[0]+" in a non-document value").
+		WithDetails("field", parts[0])
+}
+
+func memoryEachValues(correlationId string, operand any) (bson.A, error) {
+	doc, ok := operand.(bson.M)
+	if !ok || !isMemoryOperatorDocument(doc) {
+		return bson.A{operand}, nil
+	}
+	for key := range doc {
+		if key != "$each" {
+			return nil, unsupportedMemoryOperator(correlationId, key)
+		}
+	}
+	items, ok := doc["$each"].(bson.A)
+	if !ok {
+		return nil, cerr.NewBadRequestError(correlationId, "INVALID_UPDATE", "$each needs an array")
+	}
+	return items, nil
+}
+
+// addMemoryNumbers adds two numbers keeping integer types when possible.
+func addMemoryNumbers(a any, b any) (any, bool) {
+	switch x := a.(type) {
+	case int32:
+		switch y := b.(type) {
+		case int32:
+			sum := int64(x) + int64(y)
+			if sum == int64(int32(sum)) {
+				return int32(sum), true
+			}
+			return sum, true
+		case int64:
+			return int64(x) + y, true
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x + int64(y), true
+		case int64:
+			return x + y, true
+		}
+	}
+	numberA, okA := toMemoryNumber(a)
+	numberB, okB := toMemoryNumber(b)
+	if !okA || !okB {
+		return nil, false
+	}
+	return numberA + numberB, true
+}
+
+// seedMemoryDocument composes a document to be inserted by upsert from equality conditions of a query.
+func seedMemoryDocument(query bson.M) bson.M {
+	doc := bson.M{}
+	for key, condition := range query {
+		if key == "$and" {
+			if queries, ok := condition.(bson.A); ok {
+				for _, item := range queries {
+					if sub, ok := item.(bson.M); ok {
+						for field, value := range seedMemoryDocument(sub) {
+							doc[field] = value
+						}
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if operators, ok := condition.(bson.M); ok && isMemoryOperatorDocument(operators) {
+			value, ok := operators["$eq"]
+			if !ok {
+				continue
+			}
+			condition = value
+		}
+		if _, ok := condition.(primitive.Regex); ok {
+			continue
+		}
+		value := copyMemoryValue(condition)
+		_, _ = updateMemoryField("", doc, strings.Split(key, "."), true, func(any, bool) (any, bool, error) {
+			return value, true, nil
+		})
+	}
+	return doc
+}
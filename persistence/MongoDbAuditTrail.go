@@ -0,0 +1,468 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Operations recorded in the history of documents.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Modes of recording changes in the history of documents.
+//
+//	Configuration values of options.audit_mode:
+//		- snapshot: keeps full documents before and after each change (default)
+//		- diff:     keeps only changed fields with their previous and new values
+const (
+	AuditSnapshot = "snapshot"
+	AuditDiff     = "diff"
+)
+
+// MongoDbAuditRecord is a record about a change of a document kept in the history collection.
+type MongoDbAuditRecord struct {
+	Id            string               `bson:"_id" json:"id"`
+	DocumentId    any                  `bson:"document_id" json:"document_id"`
+	Operation     string               `bson:"operation" json:"operation"`
+	Time          time.Time            `bson:"time" json:"time"`
+	CorrelationId string               `bson:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+	Actor         string               `bson:"actor,omitempty" json:"actor,omitempty"`
+	TenantId      string               `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	Before        map[string]any       `bson:"before,omitempty" json:"before,omitempty"`
+	After         map[string]any       `bson:"after,omitempty" json:"after,omitempty"`
+	Changes       []MongoDbAuditChange `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+// MongoDbAuditChange is a change of a single field recorded in diff mode.
+// Nested fields are identified by dot-separated paths.
+type MongoDbAuditChange struct {
+	Field   string `bson:"field" json:"field"`
+	Before  any    `bson:"before" json:"before"`
+	After   any    `bson:"after" json:"after"`
+	Removed bool   `bson:"removed,omitempty" json:"removed,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of the context that carries the actor who makes changes.
+// Persistence components with enabled auditing record the actor in the history of changed documents.
+//
+//	Parameters:
+//		- ctx context.Context a parent context.
+//		- actor string an id or name of the actor.
+//	Returns: context.Context the context with the actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// GetActor gets the actor carried by the context.
+//
+//	Parameters:
+//		- ctx context.Context a context.
+//	Returns: string the actor or empty string if the context has no actor.
+func GetActor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// mongoDbAuditTrail keeps settings of auditing enabled for a persistence.
+type mongoDbAuditTrail struct {
+	mode           string
+	collectionName string
+	transactions   bool
+	indexed        sync.Map
+}
+
+// auditCollection gets the history collection that belongs to a data collection.
+// By default the history is kept next to the data, so separated tenants get separate histories.
+// The history collection is indexed when it is used for the first time.
+func (c *MongoDbPersistence[T]) auditCollection(collection *mongodrv.Collection) (*mongodrv.Collection, error) {
+	name := c.audit.collectionName
+	if name == "" {
+		name = collection.Name() + "_history"
+	}
+	history := collection.Database().Collection(name)
+
+	key := history.Database().Name() + "." + name
+	if _, ok := c.audit.indexed.Load(key); !ok {
+		// Indexes can't be created inside transactions, so they are created outside of the call session
+		_, err := history.Indexes().CreateOne(context.Background(), mongodrv.IndexModel{
+			Keys: bson.D{{Key: "document_id", Value: 1}, {Key: "time", Value: -1}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.audit.indexed.Store(key, true)
+	}
+	return history, nil
+}
+
+// auditWrite executes a write with its history records in a transaction when the server supports them.
+func (c *MongoDbPersistence[T]) auditWrite(ctx context.Context, correlationId string,
+	action func(ctx context.Context) error) error {
+
+	if c.audit == nil || !c.audit.transactions {
+		return action(ctx)
+	}
+	return c.ExecuteInTransaction(ctx, correlationId, action)
+}
+
+// auditBatchSize is a number of documents that audited writes of many documents read, change and record at once.
+const auditBatchSize = 100
+
+// auditDocuments reads documents that are going to be changed. Limit 0 reads all matching documents.
+func (c *MongoDbPersistence[T]) auditDocuments(ctx context.Context, collection *mongodrv.Collection,
+	filter any, limit int64) ([]bson.M, error) {
+
+	if c.audit == nil {
+		return nil, nil
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	options := mongoopt.Find()
+	if limit > 0 {
+		options.SetLimit(limit)
+	}
+	cursor, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]bson.M, 0)
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// auditBatches streams documents that are going to be changed and passes them to the action
+// in batches of auditBatchSize. Documents are read in order of their ids, which are immutable,
+// so changes made by the action don't make the cursor skip or revisit documents.
+func (c *MongoDbPersistence[T]) auditBatches(ctx context.Context, collection *mongodrv.Collection,
+	filter any, action func(ctx context.Context, befores []bson.M) error) error {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	options := mongoopt.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetBatchSize(auditBatchSize)
+	cursor, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]bson.M, 0, auditBatchSize)
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) < auditBatchSize {
+			continue
+		}
+		if err := action(ctx, batch); err != nil {
+			return err
+		}
+		batch = make([]bson.M, 0, auditBatchSize)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return action(ctx, batch)
+}
+
+// auditBefore reads a single document that is going to be changed.
+func (c *MongoDbPersistence[T]) auditBefore(ctx context.Context, collection *mongodrv.Collection,
+	filter any) (bson.M, error) {
+
+	docs, err := c.auditDocuments(ctx, collection, filter, 1)
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+	return docs[0], nil
+}
+
+// writeAudit records a change of a single document. Before is nil for created documents
+// and after is nil for deleted ones. Updates that left the document unchanged are not recorded.
+func (c *MongoDbPersistence[T]) writeAudit(ctx context.Context, correlationId string,
+	collection *mongodrv.Collection, before any, after any) error {
+
+	if c.audit == nil {
+		return nil
+	}
+	beforeDoc, afterDoc := toAuditDocument(before), toAuditDocument(after)
+	if beforeDoc != nil && afterDoc != nil && reflect.DeepEqual(beforeDoc, afterDoc) {
+		return nil
+	}
+	record, ok := c.auditRecord(ctx, correlationId, beforeDoc, afterDoc)
+	if !ok {
+		return nil
+	}
+	return c.insertAudit(ctx, correlationId, collection, []any{record})
+}
+
+// writeAuditChanges records changes of documents matched by their ids.
+// Unchanged documents are not recorded.
+func (c *MongoDbPersistence[T]) writeAuditChanges(ctx context.Context, correlationId string,
+	collection *mongodrv.Collection, befores []bson.M, afters []bson.M) error {
+
+	if c.audit == nil {
+		return nil
+	}
+
+	afterById := make(map[string]bson.M, len(afters))
+	for _, after := range afters {
+		afterById[fmt.Sprint(after["_id"])] = after
+	}
+
+	records := make([]any, 0, len(befores)+len(afters))
+	for _, before := range befores {
+		key := fmt.Sprint(before["_id"])
+		after := afterById[key]
+		delete(afterById, key)
+		if after != nil && reflect.DeepEqual(before, after) {
+			continue
+		}
+		if record, ok := c.auditRecord(ctx, correlationId, before, after); ok {
+			records = append(records, record)
+		}
+	}
+	for _, after := range afters {
+		if _, ok := afterById[fmt.Sprint(after["_id"])]; !ok {
+			continue
+		}
+		if record, ok := c.auditRecord(ctx, correlationId, nil, after); ok {
+			records = append(records, record)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return c.insertAudit(ctx, correlationId, collection, records)
+}
+
+func (c *MongoDbPersistence[T]) auditRecord(ctx context.Context, correlationId string,
+	before bson.M, after bson.M) (MongoDbAuditRecord, bool) {
+
+	record := MongoDbAuditRecord{
+		Id:            primitive.NewObjectID().Hex(),
+		Time:          time.Now().UTC(),
+		CorrelationId: correlationId,
+		Actor:         GetActor(ctx),
+		TenantId:      GetTenantId(ctx),
+	}
+	switch {
+	case before == nil && after == nil:
+		return record, false
+	case before == nil:
+		record.Operation = AuditCreate
+		record.DocumentId = after["_id"]
+	case after == nil:
+		record.Operation = AuditDelete
+		record.DocumentId = before["_id"]
+	default:
+		record.Operation = AuditUpdate
+		record.DocumentId = after["_id"]
+	}
+
+	if c.audit.mode == AuditDiff {
+		record.Changes = diffAuditDocuments("", before, after)
+	} else {
+		record.Before = before
+		record.After = after
+	}
+	return record, true
+}
+
+func (c *MongoDbPersistence[T]) insertAudit(ctx context.Context, correlationId string,
+	collection *mongodrv.Collection, records []any) error {
+
+	history, err := c.auditCollection(collection)
+	if err != nil {
+		return cerr.NewConnectionError(correlationId, "AUDIT_FAILED", "Failed to prepare history of "+c.CollectionName).
+			WithCause(err)
+	}
+	if _, err := history.InsertMany(ctx, records); err != nil {
+		return cerr.NewConnectionError(correlationId, "AUDIT_FAILED", "Failed to record history of "+c.CollectionName).
+			WithCause(err)
+	}
+	c.Logger.Trace(ctx, correlationId, "Recorded %d changes of %s in %s", len(records), c.CollectionName, history.Name())
+	return nil
+}
+
+// auditUpdateOne updates a single document and records its change.
+// It returns mongodrv.ErrNoDocuments when no documents were updated.
+func (c *MongoDbPersistence[T]) auditUpdateOne(ctx context.Context, correlationId string,
+	collection *mongodrv.Collection, filter any, update any, options *mongoopt.FindOneAndUpdateOptions,
+	query MongoDbQueryOptions) (raw bson.Raw, err error) {
+
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		before, err := c.auditBefore(ctx, collection, filter)
+		if err != nil {
+			return err
+		}
+		target := filter
+		if before != nil {
+			// The recorded document is the one to be updated
+			target = bson.M{"$and": bson.A{filter, bson.M{"_id": before["_id"]}}}
+		}
+
+		if raw, err = collection.FindOneAndUpdate(ctx, target, update, options, query.findOneAndUpdate()).DecodeBytes(); err != nil {
+			return err
+		}
+		return c.writeAudit(ctx, correlationId, collection, before, raw)
+	})
+	return raw, err
+}
+
+// supportsTransactions checks if the server is a replica set or a sharded cluster.
+// Servers older than 4.4.2 don't know the hello command, so they are asked with legacy isMaster.
+func (c *MongoDbPersistence[T]) supportsTransactions(ctx context.Context) bool {
+	var status struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := c.Db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&status)
+	if err != nil {
+		err = c.Db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&status)
+	}
+	if err != nil {
+		return false
+	}
+	return status.SetName != "" || status.Msg == "isdbgrid"
+}
+
+// auditIds collects ids of documents.
+func auditIds(docs []bson.M) bson.A {
+	ids := make(bson.A, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc["_id"])
+	}
+	return ids
+}
+
+// toAuditDocument converts a raw or a map document into a form kept in history records.
+func toAuditDocument(doc any) bson.M {
+	switch v := doc.(type) {
+	case bson.M:
+		return v
+	case map[string]any:
+		if v == nil {
+			return nil
+		}
+		return bson.M(v)
+	case bson.Raw:
+		if v == nil {
+			return nil
+		}
+		var result bson.M
+		if err := bson.Unmarshal(v, &result); err != nil {
+			return nil
+		}
+		return result
+	}
+	return nil
+}
+
+// toAuditMap gets fields of a nested document. Documents decoded into history records as bson.D are converted to maps.
+func toAuditMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		return v, true
+	case map[string]any:
+		return v, true
+	case bson.D:
+		return v.Map(), true
+	}
+	return nil, false
+}
+
+// diffAuditDocuments compares documents field by field descending into nested documents.
+func diffAuditDocuments(prefix string, before map[string]any, after map[string]any) []MongoDbAuditChange {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]MongoDbAuditChange, 0)
+	for _, key := range keys {
+		path := prefix + key
+		oldValue, hadValue := before[key]
+		newValue, hasValue := after[key]
+
+		if !hasValue {
+			changes = append(changes, MongoDbAuditChange{Field: path, Before: oldValue, Removed: true})
+			continue
+		}
+		oldMap, oldIsMap := toAuditMap(oldValue)
+		newMap, newIsMap := toAuditMap(newValue)
+		if hadValue && oldIsMap && newIsMap {
+			changes = append(changes, diffAuditDocuments(path+".", oldMap, newMap)...)
+			continue
+		}
+		if !hadValue || !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, MongoDbAuditChange{Field: path, Before: oldValue, After: newValue})
+		}
+	}
+	return changes
+}
+
+// applyAuditChanges replays recorded changes over a document.
+func applyAuditChanges(doc map[string]any, changes []MongoDbAuditChange) {
+	for _, change := range changes {
+		parts := strings.Split(change.Field, ".")
+		container := doc
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := toAuditMap(container[part])
+			if !ok {
+				if change.Removed {
+					container = nil
+					break
+				}
+				next = map[string]any{}
+			}
+			container[part] = next
+			container = next
+		}
+		if container == nil {
+			continue
+		}
+
+		field := parts[len(parts)-1]
+		if change.Removed {
+			delete(container, field)
+		} else {
+			container[field] = change.After
+		}
+	}
+}
@@ -0,0 +1,750 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	crun "github.com/pip-services3-gox/pip-services3-commons-gox/run"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlobInfo is a description of a blob stored in GridFS bucket.
+// It maps to the document kept by GridFS in <bucket>.files collection.
+type BlobInfo struct {
+	Id         string       `bson:"_id" json:"id"`
+	Name       string       `bson:"filename" json:"name"`
+	Size       int64        `bson:"length" json:"size"`
+	CreateTime time.Time    `bson:"uploadDate" json:"create_time"`
+	Metadata   BlobMetadata `bson:"metadata" json:"metadata"`
+}
+
+// BlobMetadata is a metadata attached to a blob.
+// Custom fields are stored inline next to the standard ones,
+// so they can be filtered as "metadata.<field>".
+type BlobMetadata struct {
+	ContentType string         `bson:"content_type" json:"content_type"`
+	ExpireTime  time.Time      `bson:"expire_time" json:"expire_time"`
+	Custom      map[string]any `bson:",inline" json:"custom"`
+}
+
+// MongoDbBlobPersistence is a persistence component that stores blobs in MongoDB GridFS bucket.
+//
+// Blob content is uploaded and downloaded as streams. Large blobs can be uploaded in chunks
+// with BeginWrite, WriteChunk and EndWrite methods. Blob descriptions are kept in <bucket>.files
+// collection, so they can be queried with GetPageByFilter and GetListByFilter methods
+// using GridFS field names (filename, length, uploadDate, metadata.*).
+// Blobs with expiration time are removed periodically.
+// Blob descriptions are changed only by uploads, so Create, UpdateByFilter,
+// UpdateOneByFilter and UpsertByFilter are rejected with UNSUPPORTED_OPERATION error.
+// Tenancy is supported only in discriminator mode, the tenant is kept in blob metadata.
+//
+//	Configuration parameters:
+//		- bucket:                      (optional) GridFS bucket name (default: fs)
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- max_page_size:             (optional) maximum page size (default: 100)
+//			- chunk_size:                (optional) size of GridFS chunks in bytes (default: 261120)
+//			- cleanup_interval:          (optional) interval in milliseconds to remove expired blobs (default: 60000)
+//		- tenancy:
+//			- mode:                      (optional) separation of tenants: none or discriminator (default: none)
+//			- field:                     (optional) tenant field in blob metadata (default: metadata.tenant_id)
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	persistence := persistence.NewMongoDbBlobPersistence("attachments")
+//	persistence.Configure(context.Background(), config.NewConfigParamsFromTuples(
+//		"connection.host", "localhost",
+//		"connection.port", 27017,
+//		"connection.database", "test",
+//	))
+//	_ = persistence.Open(context.Background(), "123")
+//
+//	blob, err := persistence.Upload(context.Background(), "123",
+//		persistence.BlobInfo{Name: "file.txt", Metadata: persistence.BlobMetadata{ContentType: "text/plain"}},
+//		strings.NewReader("Hello world"))
+//
+//	var buf bytes.Buffer
+//	_, err = persistence.Download(context.Background(), "123", blob.Id, &buf)
+//	fmt.Println(buf.String()) // Result: Hello world
+type MongoDbBlobPersistence struct {
+	*MongoDbPersistence[BlobInfo]
+
+	chunkSize       int32
+	cleanupInterval int
+	timer           *crun.FixedRateTimer
+	writes          map[string]*gridfs.UploadStream
+	writesLock      sync.Mutex
+
+	// The GridFS bucket name.
+	BucketName string
+	// The GridFS bucket object.
+	Bucket *gridfs.Bucket
+}
+
+// NewMongoDbBlobPersistence creates a new instance of the blob persistence component.
+//
+//	Parameters:
+//		- bucket string (optional) a GridFS bucket name.
+//	Returns: *MongoDbBlobPersistence new created MongoDbBlobPersistence component
+func NewMongoDbBlobPersistence(bucket string) *MongoDbBlobPersistence {
+	c := &MongoDbBlobPersistence{}
+	c.MongoDbPersistence = InheritMongoDbPersistence[BlobInfo](c, "")
+	c.maxPageSize = 100
+	c.tenantField = blobMetadataField + "tenant_id"
+	c.chunkSize = gridfs.DefaultChunkSize
+	c.cleanupInterval = 60000
+	c.writes = make(map[string]*gridfs.UploadStream)
+	c.setBucketName(bucket)
+	return c
+}
+
+// blobMetadataField is the prefix of blob metadata fields in <bucket>.files collection.
+const blobMetadataField = "metadata."
+
+func (c *MongoDbBlobPersistence) setBucketName(bucket string) {
+	if bucket == "" {
+		bucket = mongoopt.DefaultName
+	}
+	c.BucketName = bucket
+	c.CollectionName = bucket + ".files"
+}
+
+// Configure configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbBlobPersistence) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	c.MongoDbPersistence.Configure(ctx, config)
+	c.setBucketName(config.GetAsStringWithDefault("bucket", c.BucketName))
+	c.maxPageSize = (int32)(config.GetAsIntegerWithDefault("options.max_page_size", (int)(c.maxPageSize)))
+	c.chunkSize = (int32)(config.GetAsIntegerWithDefault("options.chunk_size", (int)(c.chunkSize)))
+	c.cleanupInterval = config.GetAsIntegerWithDefault("options.cleanup_interval", c.cleanupInterval)
+}
+
+// DefineSchema defines index on blob expiration time.
+// When overriding it in child types call this method to keep the index.
+func (c *MongoDbBlobPersistence) DefineSchema() {
+	c.EnsureIndex(bson.D{{Key: "metadata.expire_time", Value: 1}}, mongoopt.Index().SetSparse(true))
+}
+
+// Open opens the component, creates GridFS bucket and starts periodic removal of expired blobs.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbBlobPersistence) Open(ctx context.Context, correlationId string) error {
+	if c.IsOpen() {
+		return nil
+	}
+	// GridFS keeps blobs in collections with fixed names and sets only metadata of file documents
+	if c.separatesTenants() {
+		return cerr.NewConfigError(correlationId, "UNSUPPORTED_TENANCY",
+			"Blob bucket "+c.BucketName+" doesn't support tenancy mode "+string(c.tenancyMode)).
+			WithDetails("mode", c.tenancyMode)
+	}
+	if c.tenancyMode == TenancyDiscriminator && !strings.HasPrefix(c.tenantField, blobMetadataField) {
+		return cerr.NewConfigError(correlationId, "INVALID_TENANCY",
+			"Tenant field of blob bucket "+c.BucketName+" must be in "+blobMetadataField).
+			WithDetails("field", c.tenantField)
+	}
+
+	if err := c.MongoDbPersistence.Open(ctx, correlationId); err != nil {
+		return err
+	}
+
+	bucket, err := gridfs.NewBucket(c.Db, mongoopt.GridFSBucket().
+		SetName(c.BucketName).
+		SetChunkSizeBytes(c.chunkSize))
+	if err != nil {
+		_ = c.MongoDbPersistence.Close(ctx, correlationId)
+		return cerr.NewConnectionError(correlationId, "CONNECT_FAILED", "Failed to open GridFS bucket "+c.BucketName).
+			WithCause(err)
+	}
+	c.Bucket = bucket
+
+	if c.cleanupInterval > 0 {
+		c.timer = crun.NewFixedRateTimerFromCallback(func(ctx context.Context) {
+			if err := c.DeleteExpired(ctx, correlationId); err != nil {
+				c.Logger.Error(ctx, correlationId, err, "Failed to remove expired blobs from %s", c.BucketName)
+			}
+		}, c.cleanupInterval, c.cleanupInterval, 1)
+		c.timer.Start(ctx)
+	}
+	return nil
+}
+
+// Close closes component, aborts unfinished chunked uploads and frees used resources.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbBlobPersistence) Close(ctx context.Context, correlationId string) error {
+	if !c.IsOpen() {
+		return nil
+	}
+
+	if c.timer != nil {
+		c.timer.Stop(ctx)
+		c.timer = nil
+	}
+
+	c.writesLock.Lock()
+	for id, stream := range c.writes {
+		_ = stream.Abort()
+		delete(c.writes, id)
+	}
+	c.writesLock.Unlock()
+
+	c.Bucket = nil
+	return c.MongoDbPersistence.Close(ctx, correlationId)
+}
+
+// Clear clears component state by dropping the GridFS bucket.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbBlobPersistence) Clear(ctx context.Context, correlationId string) error {
+	if c.Bucket == nil {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	if err := c.Bucket.DropContext(ctx); err != nil {
+		return cerr.NewConnectionError(correlationId, "CLEAR_FAILED", "Clear bucket failed.").WithCause(err)
+	}
+	return nil
+}
+
+func (c *MongoDbBlobPersistence) composeUploadOptions(ctx context.Context, correlationId string,
+	blob BlobInfo) (*mongoopt.UploadOptions, error) {
+
+	metadata := bson.M{}
+	for k, v := range blob.Metadata.Custom {
+		metadata[k] = v
+	}
+	if blob.Metadata.ContentType != "" {
+		metadata["content_type"] = blob.Metadata.ContentType
+	}
+	if !blob.Metadata.ExpireTime.IsZero() {
+		metadata["expire_time"] = blob.Metadata.ExpireTime.UTC()
+	}
+	if c.tenancyMode == TenancyDiscriminator {
+		tenantId, err := c.resolveTenantId(ctx, correlationId)
+		if err != nil {
+			return nil, err
+		}
+		metadata[strings.TrimPrefix(c.tenantField, blobMetadataField)] = tenantId
+	}
+	return mongoopt.GridFSUpload().SetMetadata(metadata), nil
+}
+
+// OpenUploadStream opens a stream to write blob content.
+// The blob is saved when the stream is closed. Abort the stream to cancel the upload.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- blob BlobInfo a blob description. When Id is empty it is generated.
+//	Returns: *gridfs.UploadStream, string, error upload stream, blob id and error, if they are occurred.
+func (c *MongoDbBlobPersistence) OpenUploadStream(ctx context.Context, correlationId string,
+	blob BlobInfo) (*gridfs.UploadStream, string, error) {
+
+	if c.Bucket == nil {
+		return nil, "", cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+
+	options, err := c.composeUploadOptions(ctx, correlationId, blob)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := blob.Id
+	if id == "" {
+		id = cdata.IdGenerator.NextLong()
+	}
+
+	stream, err := c.Bucket.OpenUploadStreamWithID(id, blob.Name, options)
+	if err != nil {
+		return nil, "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetWriteDeadline(deadline)
+	}
+	return stream, id, nil
+}
+
+// Upload uploads blob content from a stream.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- blob BlobInfo a blob description. When Id is empty it is generated.
+//		- reader io.Reader a stream with blob content.
+//	Returns: BlobInfo, error a description of the uploaded blob and error, if they are occurred.
+func (c *MongoDbBlobPersistence) Upload(ctx context.Context, correlationId string,
+	blob BlobInfo, reader io.Reader) (result BlobInfo, err error) {
+
+	stream, id, err := c.OpenUploadStream(ctx, correlationId, blob)
+	if err != nil {
+		return result, err
+	}
+
+	if _, err = io.Copy(stream, reader); err != nil {
+		_ = stream.Abort()
+		return result, err
+	}
+	if err = stream.Close(); err != nil {
+		return result, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Uploaded to %s with id = %s", c.BucketName, id)
+	return c.GetOneById(ctx, correlationId, id)
+}
+
+// BeginWrite starts chunked upload of a blob.
+// The returned token must be passed to WriteChunk, EndWrite or AbortWrite methods.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- blob BlobInfo a blob description. When Id is empty it is generated.
+//	Returns: token string, err error upload token (blob id) and error, if they are occurred.
+func (c *MongoDbBlobPersistence) BeginWrite(ctx context.Context, correlationId string,
+	blob BlobInfo) (token string, err error) {
+
+	stream, id, err := c.OpenUploadStream(ctx, correlationId, blob)
+	if err != nil {
+		return "", err
+	}
+	// Chunks are written in separate calls, so the stream must not inherit the call deadline
+	_ = stream.SetWriteDeadline(time.Time{})
+
+	c.writesLock.Lock()
+	defer c.writesLock.Unlock()
+
+	if _, ok := c.writes[id]; ok {
+		_ = stream.Abort()
+		return "", cerr.NewConflictError(correlationId, "WRITE_IN_PROGRESS", "Blob "+id+" is already being written").
+			WithDetails("id", id)
+	}
+	c.writes[id] = stream
+	return id, nil
+}
+
+func (c *MongoDbBlobPersistence) getWrite(correlationId string, token string) (*gridfs.UploadStream, error) {
+	c.writesLock.Lock()
+	defer c.writesLock.Unlock()
+
+	stream, ok := c.writes[token]
+	if !ok {
+		return nil, cerr.NewNotFoundError(correlationId, "WRITE_NOT_FOUND", "Chunked upload "+token+" was not found").
+			WithDetails("token", token)
+	}
+	return stream, nil
+}
+
+func (c *MongoDbBlobPersistence) removeWrite(token string) {
+	c.writesLock.Lock()
+	defer c.writesLock.Unlock()
+
+	delete(c.writes, token)
+}
+
+// WriteChunk writes a chunk of blob content to started chunked upload.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- token string an upload token returned by BeginWrite.
+//		- chunk []byte a chunk of blob content.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbBlobPersistence) WriteChunk(ctx context.Context, correlationId string,
+	token string, chunk []byte) error {
+
+	stream, err := c.getWrite(correlationId, token)
+	if err != nil {
+		return err
+	}
+	if _, err = stream.Write(chunk); err != nil {
+		c.removeWrite(token)
+		_ = stream.Abort()
+		return err
+	}
+	return nil
+}
+
+// EndWrite writes the last chunk and completes chunked upload.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- token string an upload token returned by BeginWrite.
+//		- chunk []byte (optional) the last chunk of blob content.
+//	Returns: BlobInfo, error a description of the uploaded blob and error, if they are occurred.
+func (c *MongoDbBlobPersistence) EndWrite(ctx context.Context, correlationId string,
+	token string, chunk []byte) (result BlobInfo, err error) {
+
+	if len(chunk) > 0 {
+		if err = c.WriteChunk(ctx, correlationId, token, chunk); err != nil {
+			return result, err
+		}
+	}
+
+	stream, err := c.getWrite(correlationId, token)
+	if err != nil {
+		return result, err
+	}
+	c.removeWrite(token)
+
+	if err = stream.Close(); err != nil {
+		return result, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Uploaded to %s with id = %s", c.BucketName, token)
+	return c.GetOneById(ctx, correlationId, token)
+}
+
+// AbortWrite cancels chunked upload and removes already written chunks.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- token string an upload token returned by BeginWrite.
+//	Returns: error or nil when no errors occurred.
+func (c *MongoDbBlobPersistence) AbortWrite(ctx context.Context, correlationId string, token string) error {
+	stream, err := c.getWrite(correlationId, token)
+	if err != nil {
+		return err
+	}
+	c.removeWrite(token)
+	return stream.Abort()
+}
+
+// OpenDownloadStream opens a stream to read blob content.
+// The stream must be closed after reading.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- id string an id of the blob.
+//	Returns: *gridfs.DownloadStream, error download stream and error, if they are occurred.
+func (c *MongoDbBlobPersistence) OpenDownloadStream(ctx context.Context, correlationId string,
+	id string) (*gridfs.DownloadStream, error) {
+
+	if c.Bucket == nil {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	if found, err := c.existsInScope(ctx, correlationId, id); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, blobNotFoundError(correlationId, id)
+	}
+
+	stream, err := c.Bucket.OpenDownloadStream(id)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, blobNotFoundError(correlationId, id)
+		}
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetReadDeadline(deadline)
+	}
+	return stream, nil
+}
+
+// Download downloads blob content into a stream.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- id string an id of the blob.
+//		- writer io.Writer a stream to write blob content.
+//	Returns: int64, error number of written bytes and error, if they are occurred.
+func (c *MongoDbBlobPersistence) Download(ctx context.Context, correlationId string,
+	id string, writer io.Writer) (int64, error) {
+
+	stream, err := c.OpenDownloadStream(ctx, correlationId, id)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	size, err := io.Copy(writer, stream)
+	if err != nil {
+		return size, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Downloaded from %s with id = %s", c.BucketName, id)
+	return size, nil
+}
+
+// GetOneById gets a blob description by its unique id.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- id string an id of the blob.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item BlobInfo, err error a blob description and error, if they are occurred.
+func (c *MongoDbBlobPersistence) GetOneById(ctx context.Context, correlationId string,
+	id string, queryOptions ...MongoDbQueryOption) (item BlobInfo, err error) {
+
+	if c.Bucket == nil {
+		return item, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": id})
+	if err != nil {
+		return item, err
+	}
+
+	res := collection.FindOne(ctx, filter, c.resolveQueryOptions(queryOptions).findOne())
+	raw, err := res.DecodeBytes()
+	if err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			return item, nil
+		}
+		return item, err
+	}
+	if item, err = c.decodeDocument(raw); err != nil {
+		return BlobInfo{}, c.handleSingleDecodeError(ctx, correlationId, raw, err)
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved from %s by id = %s", c.CollectionName, id)
+	return item, nil
+}
+
+// GetListByIds gets a list of blob descriptions by their unique ids.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- ids []string ids of the blobs.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: items []BlobInfo, err error a list of blob descriptions and error, if they are occurred.
+func (c *MongoDbBlobPersistence) GetListByIds(ctx context.Context, correlationId string,
+	ids []string, queryOptions ...MongoDbQueryOption) (items []BlobInfo, err error) {
+
+	filter := bson.M{
+		"_id": bson.M{"$in": ids},
+	}
+	return c.GetListByFilter(ctx, correlationId, filter, nil, nil, queryOptions...)
+}
+
+// DeleteById deletes a blob with all its chunks.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- id string an id of the blob.
+//	Returns: error or nil for success.
+func (c *MongoDbBlobPersistence) DeleteById(ctx context.Context, correlationId string, id string) error {
+	if c.Bucket == nil {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	if found, err := c.existsInScope(ctx, correlationId, id); err != nil || !found {
+		return err
+	}
+
+	if err := c.Bucket.DeleteContext(ctx, id); err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Deleted from %s with id = %s", c.BucketName, id)
+	return nil
+}
+
+// DeleteByIds deletes multiple blobs with all their chunks.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- ids []string ids of the blobs.
+//	Returns: error or nil for success.
+func (c *MongoDbBlobPersistence) DeleteByIds(ctx context.Context, correlationId string, ids []string) error {
+	for _, id := range ids {
+		if err := c.DeleteById(ctx, correlationId, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteByFilter deletes blobs that match to a given filter over blob descriptions.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any (optional) a filter BSON object.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: error or nil for success.
+func (c *MongoDbBlobPersistence) DeleteByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) error {
+	if c.Bucket == nil {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	// Ids are collected first, so the cursor doesn't iterate over files that are being deleted
+	cursor, err := collection.Find(ctx, filter, c.resolveQueryOptions(queryOptions).find(),
+		mongoopt.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	ids := make([]bson.RawValue, 0)
+	for cursor.Next(ctx) {
+		if c.IsTerminated() {
+			_ = cursor.Close(ctx)
+			return cerr.
+				NewError("query terminated").
+				WithCorrelationId(correlationId)
+		}
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+	err = cursor.Err()
+	_ = cursor.Close(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := c.Bucket.DeleteContext(ctx, id); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Deleted %d items from %s", len(ids), c.BucketName)
+	return nil
+}
+
+// DeleteExpired deletes blobs which expiration time has passed.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil for success.
+func (c *MongoDbBlobPersistence) DeleteExpired(ctx context.Context, correlationId string) error {
+	if c.Bucket == nil {
+		return cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Blob persistence is not opened")
+	}
+	filter := bson.M{"metadata.expire_time": bson.M{"$lte": time.Now().UTC()}}
+	return c.DeleteByFilter(ctx, correlationId, filter)
+}
+
+// Create is not supported, blobs shall be uploaded with Upload or BeginWrite.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- item BlobInfo a blob description.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, the operation is not supported
+//	Returns: UNSUPPORTED_OPERATION error.
+func (c *MongoDbBlobPersistence) Create(ctx context.Context, correlationId string, item BlobInfo,
+	queryOptions ...MongoDbQueryOption) (result BlobInfo, err error) {
+	return result, c.unsupportedError(correlationId, "Create")
+}
+
+// UpdateByFilter is not supported, GridFS file documents are changed only by uploads.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, the operation is not supported
+//	Returns: UNSUPPORTED_OPERATION error.
+func (c *MongoDbBlobPersistence) UpdateByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (result MongoDbUpdateResult, err error) {
+	return result, c.unsupportedError(correlationId, "UpdateByFilter")
+}
+
+// UpdateOneByFilter is not supported, GridFS file documents are changed only by uploads.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, the operation is not supported
+//	Returns: UNSUPPORTED_OPERATION error.
+func (c *MongoDbBlobPersistence) UpdateOneByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item BlobInfo, err error) {
+	return item, c.unsupportedError(correlationId, "UpdateOneByFilter")
+}
+
+// UpsertByFilter is not supported, blobs shall be uploaded with Upload or BeginWrite.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, the operation is not supported
+//	Returns: UNSUPPORTED_OPERATION error.
+func (c *MongoDbBlobPersistence) UpsertByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item BlobInfo, err error) {
+	return item, c.unsupportedError(correlationId, "UpsertByFilter")
+}
+
+func (c *MongoDbBlobPersistence) unsupportedError(correlationId string, operation string) error {
+	return cerr.NewUnsupportedError(correlationId, "UNSUPPORTED_OPERATION",
+		operation+" is not supported by blob bucket "+c.BucketName+", blobs shall be uploaded").
+		WithDetails("bucket", c.BucketName).
+		WithDetails("operation", operation)
+}
+
+// existsInScope checks that the blob belongs to the tenant carried by the context.
+// Without tenancy all blobs are in scope and the check is skipped.
+func (c *MongoDbBlobPersistence) existsInScope(ctx context.Context, correlationId string, id string) (bool, error) {
+	if c.tenancyMode == TenancyNone {
+		return true, nil
+	}
+	collection, filter, err := c.resolveScope(ctx, correlationId, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	count, err := collection.CountDocuments(ctx, filter, mongoopt.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func blobNotFoundError(correlationId string, id string) error {
+	return cerr.NewNotFoundError(correlationId, "BLOB_NOT_FOUND", "Blob "+id+" was not found").
+		WithDetails("id", id)
+}
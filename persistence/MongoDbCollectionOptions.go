@@ -0,0 +1,242 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cconv "github.com/pip-services3-gox/pip-services3-commons-gox/convert"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureCollection method adds options to create the collection with on opening.
+// The collection is created only when it doesn't exist yet, options of an existing
+// collection are verified and opening fails when they don't match.
+// Options set in the collection_options configuration section take precedence.
+// This method shall be called from DefineSchema.
+//
+//	Parameters:
+//		- options *mongoopt.CreateCollectionOptions collection options: time-series, capped,
+//			clustered index, default collation, change stream pre- and post-images, etc.
+func (c *MongoDbPersistence[T]) EnsureCollection(options *mongoopt.CreateCollectionOptions) {
+	c.collectionOptions = options
+}
+
+// configureCollection reads options to create the collection from the collection_options configuration section.
+func (c *MongoDbPersistence[T]) configureCollection(config *cconf.ConfigParams) {
+	c.configCollectionOptions = nil
+	section := config.GetSection("collection_options")
+	if section.Len() == 0 {
+		return
+	}
+
+	options := mongoopt.CreateCollection()
+	if capped, ok := section.GetAsNullableBoolean("capped"); ok {
+		options.SetCapped(capped)
+	}
+	if size, ok := section.GetAsNullableLong("size"); ok {
+		options.SetSizeInBytes(size)
+	}
+	if max, ok := section.GetAsNullableLong("max"); ok {
+		options.SetMaxDocuments(max)
+	}
+	if timeField := section.GetAsString("time_field"); timeField != "" {
+		timeSeries := mongoopt.TimeSeries().SetTimeField(timeField)
+		if metaField := section.GetAsString("meta_field"); metaField != "" {
+			timeSeries.SetMetaField(metaField)
+		}
+		if granularity := section.GetAsString("granularity"); granularity != "" {
+			timeSeries.SetGranularity(granularity)
+		}
+		options.SetTimeSeriesOptions(timeSeries)
+	}
+	if expire, ok := section.GetAsNullableLong("expire_after_seconds"); ok {
+		options.SetExpireAfterSeconds(expire)
+	}
+	if section.GetAsBoolean("clustered") {
+		options.SetClusteredIndex(bson.D{{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "unique", Value: true}})
+	}
+	if locale := section.GetAsString("collation.locale"); locale != "" {
+		options.SetCollation(&mongoopt.Collation{
+			Locale:   locale,
+			Strength: section.GetAsInteger("collation.strength"),
+		})
+	}
+	if images, ok := section.GetAsNullableBoolean("pre_and_post_images"); ok {
+		options.SetChangeStreamPreAndPostImages(bson.M{"enabled": images})
+	}
+	c.configCollectionOptions = options
+}
+
+// createCollectionOptions merges collection options defined in DefineSchema and in configuration.
+// Returns nil when the collection shall be created implicitly.
+func (c *MongoDbPersistence[T]) createCollectionOptions() *mongoopt.CreateCollectionOptions {
+	if c.collectionOptions == nil && c.configCollectionOptions == nil {
+		return nil
+	}
+	return mongoopt.MergeCreateCollectionOptions(c.collectionOptions, c.configCollectionOptions)
+}
+
+// validateCollectionOptions checks that collection options can be combined.
+func validateCollectionOptions(correlationId string, options *mongoopt.CreateCollectionOptions) error {
+	if options == nil {
+		return nil
+	}
+	capped := options.Capped != nil && *options.Capped
+	if capped && (options.SizeInBytes == nil || *options.SizeInBytes <= 0) {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS", "Capped collection requires size")
+	}
+	if !capped && (options.SizeInBytes != nil || options.MaxDocuments != nil) {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS", "Size and max are allowed only for capped collections")
+	}
+	if options.TimeSeriesOptions != nil && options.TimeSeriesOptions.TimeField == "" {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS", "Time-series collection requires time field")
+	}
+	if options.TimeSeriesOptions != nil && (capped || options.ClusteredIndex != nil) {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS",
+			"Time-series collection can't be capped or clustered")
+	}
+	if capped && options.ClusteredIndex != nil {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS", "Capped collection can't be clustered")
+	}
+	if options.ExpireAfterSeconds != nil && options.TimeSeriesOptions == nil && options.ClusteredIndex == nil {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS",
+			"Expiration is allowed only for time-series and clustered collections")
+	}
+	return nil
+}
+
+// ensureCollection creates the collection with the declared options when it doesn't exist
+// or verifies options of the existing collection.
+func (c *MongoDbPersistence[T]) ensureCollection(ctx context.Context, correlationId string,
+	db *mongodrv.Database, name string) error {
+
+	options := c.createCollectionOptions()
+	if options == nil {
+		return nil
+	}
+
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{"name": name})
+	if err != nil {
+		return cerr.NewConnectionError(correlationId, "CREATE_COLLECTION_FAILED", "Failed to read options of collection "+name).
+			WithCause(err)
+	}
+	if len(specs) == 0 {
+		if err = db.CreateCollection(ctx, name, options); err != nil {
+			return cerr.NewConnectionError(correlationId, "CREATE_COLLECTION_FAILED", "Failed to create collection "+name).
+				WithCause(err)
+		}
+		c.Logger.Debug(ctx, correlationId, "Created collection %s in %s", name, db.Name())
+		return nil
+	}
+
+	if specs[0].Type != "collection" {
+		return collectionMismatchError(correlationId, name, "type", "collection", specs[0].Type)
+	}
+	var actual bson.M
+	if len(specs[0].Options) > 0 {
+		if err = bson.Unmarshal(specs[0].Options, &actual); err != nil {
+			return err
+		}
+	}
+	return verifyCollectionOptions(correlationId, name, options, actual)
+}
+
+// verifyCollectionOptions compares the declared collection options with the options of the existing collection.
+// Options that were not declared are not verified.
+func verifyCollectionOptions(correlationId string, name string,
+	options *mongoopt.CreateCollectionOptions, actual bson.M) error {
+
+	check := func(option string, expected any, value any) error {
+		if fmt.Sprint(expected) != fmt.Sprint(value) {
+			return collectionMismatchError(correlationId, name, option, expected, value)
+		}
+		return nil
+	}
+	sub := func(doc any, key string) any {
+		for _, e := range documentElements(doc) {
+			if e.Key == key {
+				return e.Value
+			}
+		}
+		return nil
+	}
+
+	if options.Capped != nil {
+		capped, _ := actual["capped"].(bool)
+		if err := check("capped", *options.Capped, capped); err != nil {
+			return err
+		}
+	}
+	if options.SizeInBytes != nil {
+		// Size of capped collections is rounded up by the server
+		if size := cconv.LongConverter.ToLong(actual["size"]); size < *options.SizeInBytes {
+			return collectionMismatchError(correlationId, name, "size", *options.SizeInBytes, size)
+		}
+	}
+	if options.MaxDocuments != nil {
+		if err := check("max", *options.MaxDocuments, cconv.LongConverter.ToLong(actual["max"])); err != nil {
+			return err
+		}
+	}
+	if timeSeries := options.TimeSeriesOptions; timeSeries != nil {
+		actualTimeSeries := actual["timeseries"]
+		if actualTimeSeries == nil {
+			return collectionMismatchError(correlationId, name, "timeseries", timeSeries.TimeField, nil)
+		}
+		if err := check("timeseries.timeField", timeSeries.TimeField, sub(actualTimeSeries, "timeField")); err != nil {
+			return err
+		}
+		if timeSeries.MetaField != nil {
+			if err := check("timeseries.metaField", *timeSeries.MetaField, sub(actualTimeSeries, "metaField")); err != nil {
+				return err
+			}
+		}
+		if timeSeries.Granularity != nil {
+			if err := check("timeseries.granularity", *timeSeries.Granularity, sub(actualTimeSeries, "granularity")); err != nil {
+				return err
+			}
+		}
+	}
+	if options.ExpireAfterSeconds != nil {
+		expire := cconv.LongConverter.ToLong(actual["expireAfterSeconds"])
+		if err := check("expireAfterSeconds", *options.ExpireAfterSeconds, expire); err != nil {
+			return err
+		}
+	}
+	if options.ClusteredIndex != nil && actual["clusteredIndex"] == nil {
+		return collectionMismatchError(correlationId, name, "clusteredIndex", options.ClusteredIndex, nil)
+	}
+	if collation := options.Collation; collation != nil {
+		actualCollation := actual["collation"]
+		if err := check("collation.locale", collation.Locale, sub(actualCollation, "locale")); err != nil {
+			return err
+		}
+		if collation.Strength != 0 {
+			strength := cconv.IntegerConverter.ToInteger(sub(actualCollation, "strength"))
+			if err := check("collation.strength", collation.Strength, strength); err != nil {
+				return err
+			}
+		}
+	}
+	if options.ChangeStreamPreAndPostImages != nil {
+		enabled, _ := sub(options.ChangeStreamPreAndPostImages, "enabled").(bool)
+		actualEnabled, _ := sub(actual["changeStreamPreAndPostImages"], "enabled").(bool)
+		if err := check("changeStreamPreAndPostImages", enabled, actualEnabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectionMismatchError(correlationId string, name string, option string, expected any, actual any) error {
+	return cerr.NewConfigError(correlationId, "COLLECTION_MISMATCH",
+		"Collection "+name+" exists with different "+option).
+		WithDetails("collection", name).
+		WithDetails("option", option).
+		WithDetails("expected", expected).
+		WithDetails("actual", actual)
+}
@@ -0,0 +1,676 @@
+package persistence
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	cauth "github.com/pip-services3-gox/pip-services3-components-gox/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+)
+
+// EncryptedFieldSubtype is the user defined BSON binary subtype of values encrypted by MongoDbFieldEncryptor.
+// Values of other types are treated as plain values stored before encryption was enabled.
+const EncryptedFieldSubtype byte = 0x80
+
+// encryptedFieldVersion defines the layout of encrypted values:
+// version | key id length | key id | nonce | sealed value.
+const encryptedFieldVersion byte = 1
+
+// MongoDbFieldEncryptor encrypts selected fields of documents with AES-GCM
+// before they are written to MongoDB and decrypts them after reads.
+//
+// Every encrypted value keeps the id of the key it was encrypted with,
+// so keys can be rotated: new values are encrypted with the active key
+// while values encrypted with older keys remain readable as long as the keys are added.
+//
+// Values of deterministic fields are encrypted with a nonce derived from the value,
+// so equal values produce equal ciphertexts and can be searched with EncryptedFilter.
+// Deterministic encryption reveals which documents have equal values,
+// use it only for fields that must be searchable.
+//
+// Example:
+//
+//	encryptor := persistence.NewMongoDbFieldEncryptor()
+//	_ = encryptor.AddKeyFromString("2024", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+//	encryptor.AddFields(false, "card.number")
+//	encryptor.AddFields(true, "ssn")
+//
+//	doc, err := encryptor.EncryptDocument("123", map[string]any{"ssn": "123-45-6789"})
+//	filter, err := encryptor.EncryptedFilter("123", "ssn", "123-45-6789")
+type MongoDbFieldEncryptor struct {
+	lock          sync.RWMutex
+	keys          map[string]cipher.AEAD
+	nonceKeys     map[string][]byte
+	activeKeyId   string
+	fields        []string
+	deterministic map[string]bool
+}
+
+// NewMongoDbFieldEncryptor creates a new field encryptor without keys and fields.
+//
+//	Returns: *MongoDbFieldEncryptor created encryptor.
+func NewMongoDbFieldEncryptor() *MongoDbFieldEncryptor {
+	return &MongoDbFieldEncryptor{
+		keys:          map[string]cipher.AEAD{},
+		nonceKeys:     map[string][]byte{},
+		fields:        make([]string, 0),
+		deterministic: map[string]bool{},
+	}
+}
+
+// AddKey adds an encryption key to the keyring.
+// The first added key becomes active until another one is set with SetActiveKey.
+//
+//	Parameters:
+//		- keyId string an id of the key stored with encrypted values.
+//		- key []byte AES key of 16, 24 or 32 bytes.
+//	Returns: error if the key or its id is invalid.
+func (c *MongoDbFieldEncryptor) AddKey(keyId string, key []byte) error {
+	if keyId == "" || len(keyId) > 255 {
+		return cerr.NewConfigError("", "BAD_ENCRYPTION_KEY", "Encryption key id must be 1 to 255 bytes long").
+			WithDetails("key_id", keyId)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return cerr.NewConfigError("", "BAD_ENCRYPTION_KEY", "Encryption key must be 16, 24 or 32 bytes long").
+			WithDetails("key_id", keyId).
+			WithCause(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("field-encryption-nonce"))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.keys[keyId] = aead
+	c.nonceKeys[keyId] = mac.Sum(nil)
+	if c.activeKeyId == "" {
+		c.activeKeyId = keyId
+	}
+	return nil
+}
+
+// AddKeyFromString adds a base64 encoded encryption key to the keyring.
+//
+//	Parameters:
+//		- keyId string an id of the key stored with encrypted values.
+//		- key string base64 encoded AES key of 16, 24 or 32 bytes.
+//	Returns: error if the key or its id is invalid.
+func (c *MongoDbFieldEncryptor) AddKeyFromString(keyId string, key string) error {
+	buf, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return cerr.NewConfigError("", "BAD_ENCRYPTION_KEY", "Encryption key must be base64 encoded").
+			WithDetails("key_id", keyId).
+			WithCause(err)
+	}
+	return c.AddKey(keyId, buf)
+}
+
+// keyCount gets the number of keys in the keyring.
+func (c *MongoDbFieldEncryptor) keyCount() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.keys)
+}
+
+// SetActiveKey sets the key to encrypt new values with.
+//
+//	Parameters:
+//		- keyId string an id of a previously added key.
+//	Returns: error if the key is not in the keyring.
+func (c *MongoDbFieldEncryptor) SetActiveKey(keyId string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.keys[keyId]; !ok {
+		return cerr.NewConfigError("", "UNKNOWN_ENCRYPTION_KEY", "Encryption key "+keyId+" is not found").
+			WithDetails("key_id", keyId)
+	}
+	c.activeKeyId = keyId
+	return nil
+}
+
+// ActiveKeyId gets the id of the key to encrypt new values with.
+//
+//	Returns: string the key id or empty string if the keyring is empty.
+func (c *MongoDbFieldEncryptor) ActiveKeyId() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.activeKeyId
+}
+
+// AddFields adds fields to be encrypted. Nested fields are defined with dot notation.
+//
+//	Parameters:
+//		- deterministic bool true to encrypt the fields deterministically to search them by equality.
+//		- fields ...string paths of the fields.
+func (c *MongoDbFieldEncryptor) AddFields(deterministic bool, fields ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		if _, ok := c.deterministic[field]; !ok {
+			c.fields = append(c.fields, field)
+		}
+		c.deterministic[field] = deterministic
+	}
+}
+
+// Fields gets paths of the encrypted fields.
+//
+//	Returns: []string paths of the fields.
+func (c *MongoDbFieldEncryptor) Fields() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string{}, c.fields...)
+}
+
+// IsDeterministic checks if the field is encrypted deterministically.
+//
+//	Parameters:
+//		- field string a path of the field.
+//	Returns: bool true if the field is encrypted and searchable by equality.
+func (c *MongoDbFieldEncryptor) IsDeterministic(field string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.deterministic[field]
+}
+
+// IsEncryptedValue checks if the value was encrypted by MongoDbFieldEncryptor.
+//
+//	Parameters:
+//		- value any a value to check.
+//	Returns: bool true if the value is encrypted.
+func IsEncryptedValue(value any) bool {
+	binary, ok := value.(primitive.Binary)
+	return ok && binary.Subtype == EncryptedFieldSubtype
+}
+
+// EncryptValue encrypts a value of the field with the active key.
+// Nil values are not encrypted.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- field string a path of the field, it is bound to the ciphertext.
+//		- value any a plain value.
+//	Returns: any, error the encrypted value or error.
+func (c *MongoDbFieldEncryptor) EncryptValue(correlationId string, field string, value any) (any, error) {
+	if value == nil || IsEncryptedValue(value) {
+		return value, nil
+	}
+	c.lock.RLock()
+	keyId, deterministic := c.activeKeyId, c.deterministic[field]
+	c.lock.RUnlock()
+	if keyId == "" {
+		return nil, cerr.NewInvalidStateError(correlationId, "NO_ENCRYPTION_KEY", "Encryption key is not set")
+	}
+	return c.encrypt(correlationId, keyId, field, value, deterministic)
+}
+
+func (c *MongoDbFieldEncryptor) encrypt(correlationId string, keyId string, field string,
+	value any, deterministic bool) (any, error) {
+
+	plain, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+	if err != nil {
+		return nil, cerr.NewBadRequestError(correlationId, "ENCRYPTION_FAILED", "Failed to encrypt field "+field).
+			WithDetails("field", field).
+			WithCause(err)
+	}
+
+	c.lock.RLock()
+	aead, nonceKey := c.keys[keyId], c.nonceKeys[keyId]
+	c.lock.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, nonceKey)
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 2+len(keyId)+len(nonce)+len(plain)+aead.Overhead())
+	buf = append(buf, encryptedFieldVersion, byte(len(keyId)))
+	buf = append(buf, keyId...)
+	buf = append(buf, nonce...)
+	buf = aead.Seal(buf, nonce, plain, []byte(field))
+	return primitive.Binary{Subtype: EncryptedFieldSubtype, Data: buf}, nil
+}
+
+// DecryptValue decrypts a value of the field. Values that are not encrypted are returned as is.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- field string a path of the field.
+//		- value any an encrypted value.
+//	Returns: any, error the plain value or error if the key is unknown or the value is corrupted.
+func (c *MongoDbFieldEncryptor) DecryptValue(correlationId string, field string, value any) (any, error) {
+	binary, ok := value.(primitive.Binary)
+	if !ok || binary.Subtype != EncryptedFieldSubtype {
+		return value, nil
+	}
+
+	buf := binary.Data
+	if len(buf) < 2 || buf[0] != encryptedFieldVersion || len(buf) < 2+int(buf[1]) {
+		return nil, c.decryptError(correlationId, field, nil)
+	}
+	keyId := string(buf[2 : 2+buf[1]])
+	buf = buf[2+len(keyId):]
+
+	c.lock.RLock()
+	aead, ok := c.keys[keyId]
+	c.lock.RUnlock()
+	if !ok {
+		return nil, cerr.NewInternalError(correlationId, "UNKNOWN_ENCRYPTION_KEY",
+			"Encryption key "+keyId+" of field "+field+" is not found").
+			WithDetails("field", field).
+			WithDetails("key_id", keyId)
+	}
+	if len(buf) < aead.NonceSize() {
+		return nil, c.decryptError(correlationId, field, nil)
+	}
+	plain, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return nil, c.decryptError(correlationId, field, err)
+	}
+
+	var doc map[string]any
+	if err = bson.Unmarshal(plain, &doc); err != nil {
+		return nil, c.decryptError(correlationId, field, err)
+	}
+	return doc["v"], nil
+}
+
+func (c *MongoDbFieldEncryptor) decryptError(correlationId string, field string, err error) error {
+	return cerr.NewInternalError(correlationId, "DECRYPTION_FAILED", "Failed to decrypt field "+field).
+		WithDetails("field", field).
+		WithCause(err)
+}
+
+// EncryptDocument encrypts the configured fields of a document.
+// The document is not changed, the result shares unchanged values with it.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- doc map[string]any a plain document.
+//	Returns: map[string]any, error the document with encrypted fields or error.
+func (c *MongoDbFieldEncryptor) EncryptDocument(correlationId string, doc map[string]any) (map[string]any, error) {
+	result, err := c.encryptFields(correlationId, "", doc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, _ := result.(map[string]any)
+	return encrypted, nil
+}
+
+// DecryptDocument decrypts the configured fields of a document in place.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- doc map[string]any a document read from MongoDB.
+//	Returns: error if some field can't be decrypted.
+func (c *MongoDbFieldEncryptor) DecryptDocument(correlationId string, doc map[string]any) error {
+	for _, field := range c.Fields() {
+		_, err := transformPath(doc, strings.Split(field, "."), func(value any) (any, error) {
+			return c.DecryptValue(correlationId, field, value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptFields encrypts the configured fields that are nested into the value set to the prefix path.
+func (c *MongoDbFieldEncryptor) encryptFields(correlationId string, prefix string, value any) (any, error) {
+	var err error
+	for _, field := range c.Fields() {
+		path := field
+		if prefix != "" {
+			if !strings.HasPrefix(field, prefix+".") {
+				continue
+			}
+			path = strings.TrimPrefix(field, prefix+".")
+		}
+		value, err = transformPath(copyDocument(value), strings.Split(path, "."), func(value any) (any, error) {
+			return c.EncryptValue(correlationId, field, value)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// EncryptUpdate encrypts values set to the encrypted fields by an update document or pipeline.
+// The update is not changed. Operators that compute values of encrypted fields on the server
+// can't be applied to ciphertexts and are rejected.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- update any an update document with operators or an update pipeline.
+//	Returns: any, error the update with encrypted values or error.
+func (c *MongoDbFieldEncryptor) EncryptUpdate(correlationId string, update any) (any, error) {
+	switch v := update.(type) {
+	case bson.A, []any, mongodrv.Pipeline, []bson.M:
+		// Pipeline stages compute values on the server
+		var stages []any
+		switch v := v.(type) {
+		case bson.A:
+			stages = v
+		case []any:
+			stages = v
+		case mongodrv.Pipeline:
+			for _, stage := range v {
+				stages = append(stages, stage)
+			}
+		case []bson.M:
+			for _, stage := range v {
+				stages = append(stages, stage)
+			}
+		}
+		for _, stage := range stages {
+			for _, operation := range documentElements(stage) {
+				switch operation.Key {
+				case "$unset":
+					continue
+				case "$replaceRoot", "$replaceWith", "$project":
+					return nil, c.operationError(correlationId, operation.Key, "")
+				}
+				for _, field := range documentElements(operation.Value) {
+					if c.encryptedPath(field.Key) {
+						return nil, c.operationError(correlationId, operation.Key, field.Key)
+					}
+				}
+			}
+		}
+		return update, nil
+	}
+
+	operations := documentElements(update)
+	if operations == nil {
+		return update, nil
+	}
+	result := make(bson.D, 0, len(operations))
+	for _, operation := range operations {
+		switch operation.Key {
+		case "$set", "$setOnInsert":
+			fields := documentElements(operation.Value)
+			values := make(bson.D, 0, len(fields))
+			for _, field := range fields {
+				value, err := c.encryptUpdateField(correlationId, operation.Key, field.Key, field.Value)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, bson.E{Key: field.Key, Value: value})
+			}
+			operation = bson.E{Key: operation.Key, Value: values}
+		case "$unset":
+		default:
+			for _, field := range documentElements(operation.Value) {
+				encrypted := c.encryptedPath(field.Key)
+				if target, ok := field.Value.(string); ok && operation.Key == "$rename" {
+					encrypted = encrypted || c.encryptedPath(target)
+				}
+				if encrypted {
+					return nil, c.operationError(correlationId, operation.Key, field.Key)
+				}
+			}
+		}
+		result = append(result, operation)
+	}
+	return result, nil
+}
+
+func (c *MongoDbFieldEncryptor) encryptUpdateField(correlationId string, operator string,
+	key string, value any) (any, error) {
+
+	for _, field := range c.Fields() {
+		switch {
+		case key == field:
+			return c.EncryptValue(correlationId, field, value)
+		case strings.HasPrefix(key, field+"."):
+			// Part of the encrypted value can't be changed without decrypting it
+			return nil, c.operationError(correlationId, operator, key)
+		}
+	}
+	return c.encryptFields(correlationId, key, value)
+}
+
+// encryptedPath checks if the path is an encrypted field, is inside of it or contains it.
+func (c *MongoDbFieldEncryptor) encryptedPath(path string) bool {
+	for _, field := range c.Fields() {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *MongoDbFieldEncryptor) operationError(correlationId string, operator string, field string) error {
+	return cerr.NewBadRequestError(correlationId, "ENCRYPTED_FIELD_OPERATION",
+		"Operator "+operator+" can't be applied to encrypted fields").
+		WithDetails("operator", operator).
+		WithDetails("field", field)
+}
+
+// EncryptedValues encrypts a value of a deterministic field with every key in the keyring,
+// so documents encrypted before key rotation are found as well.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- field string a path of the deterministic field.
+//		- value any a plain value.
+//	Returns: bson.A, error encrypted values or error if the field is not deterministic.
+func (c *MongoDbFieldEncryptor) EncryptedValues(correlationId string, field string, value any) (bson.A, error) {
+	if !c.IsDeterministic(field) {
+		return nil, cerr.NewBadRequestError(correlationId, "NOT_DETERMINISTIC",
+			"Field "+field+" is not encrypted deterministically and can't be searched").
+			WithDetails("field", field)
+	}
+	if value == nil {
+		return bson.A{nil}, nil
+	}
+
+	c.lock.RLock()
+	keyIds := make([]string, 0, len(c.keys))
+	for keyId := range c.keys {
+		keyIds = append(keyIds, keyId)
+	}
+	c.lock.RUnlock()
+	sort.Strings(keyIds)
+
+	values := make(bson.A, 0, len(keyIds))
+	for _, keyId := range keyIds {
+		encrypted, err := c.encrypt(correlationId, keyId, field, value, true)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, encrypted)
+	}
+	return values, nil
+}
+
+// EncryptedFilter composes a filter to search documents where a deterministic field equals to the value.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- field string a path of the deterministic field.
+//		- value any a plain value.
+//	Returns: bson.M, error the filter or error if the field is not deterministic.
+func (c *MongoDbFieldEncryptor) EncryptedFilter(correlationId string, field string, value any) (bson.M, error) {
+	values, err := c.EncryptedValues(correlationId, field, value)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{field: bson.M{"$in": values}}, nil
+}
+
+// transformPath replaces the value at the path of a document with the result of the transform.
+// Documents that don't contain the path are returned as is.
+func transformPath(doc any, path []string, transform func(value any) (any, error)) (any, error) {
+	if len(path) == 0 {
+		return transform(doc)
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		if value, ok := v[path[0]]; ok {
+			value, err := transformPath(copyDocument(value), path[1:], transform)
+			if err != nil {
+				return nil, err
+			}
+			v[path[0]] = value
+		}
+	case bson.M:
+		if value, ok := v[path[0]]; ok {
+			value, err := transformPath(copyDocument(value), path[1:], transform)
+			if err != nil {
+				return nil, err
+			}
+			v[path[0]] = value
+		}
+	case bson.D:
+		for i, element := range v {
+			if element.Key != path[0] {
+				continue
+			}
+			value, err := transformPath(copyDocument(element.Value), path[1:], transform)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = value
+		}
+	}
+	return doc, nil
+}
+
+// copyDocument makes a shallow copy of a document, other values are returned as is.
+func copyDocument(doc any) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, value := range v {
+			result[k] = value
+		}
+		return result
+	case bson.M:
+		result := make(bson.M, len(v))
+		for k, value := range v {
+			result[k] = value
+		}
+		return result
+	case bson.D:
+		return append(bson.D{}, v...)
+	}
+	return doc
+}
+
+// configureEncryption reads encrypted fields and keys from the encryption section of the configuration.
+func (c *MongoDbPersistence[T]) configureEncryption(ctx context.Context, config *cconf.ConfigParams) {
+	c.Encryptor, c.encryptionErr = nil, nil
+	fields := config.GetAsString("encryption.fields")
+	deterministicFields := config.GetAsString("encryption.deterministic_fields")
+	if strings.TrimSpace(fields) == "" && strings.TrimSpace(deterministicFields) == "" {
+		return
+	}
+
+	c.Encryptor = NewMongoDbFieldEncryptor()
+	c.Encryptor.AddFields(false, strings.Split(fields, ",")...)
+	c.Encryptor.AddFields(true, strings.Split(deterministicFields, ",")...)
+	c.encryptionKeyId = config.GetAsString("encryption.key_id")
+
+	// Keys are added in a stable order, the active key must be set explicitly when there are several of them
+	keys := config.GetSection("encryption.keys")
+	keyIds := keys.Keys()
+	sort.Strings(keyIds)
+	for _, keyId := range keyIds {
+		if err := c.Encryptor.AddKeyFromString(keyId, keys.GetAsString(keyId)); err != nil && c.encryptionErr == nil {
+			c.encryptionErr = err
+		}
+	}
+
+	c.encryptionCredentials = cauth.NewEmptyCredentialResolver()
+	c.encryptionCredentials.Configure(ctx, config.GetSection("encryption"))
+}
+
+// openEncryption adds keys resolved from credentials and checks that an active key is set.
+func (c *MongoDbPersistence[T]) openEncryption(ctx context.Context, correlationId string) error {
+	if c.Encryptor == nil {
+		return nil
+	}
+	if c.encryptionErr != nil {
+		return c.encryptionErr
+	}
+
+	if c.encryptionCredentials != nil {
+		for _, credential := range c.encryptionCredentials.GetAll() {
+			resolver := cauth.NewEmptyCredentialResolver()
+			resolver.Add(credential)
+			resolver.SetReferences(ctx, c.references)
+			resolved, err := resolver.Lookup(ctx, correlationId)
+			if err != nil {
+				return err
+			}
+			if resolved == nil {
+				return cerr.NewConfigError(correlationId, "NO_ENCRYPTION_KEY",
+					"Encryption key "+credential.StoreKey()+" is not found in credential stores")
+			}
+			keyId := resolved.AccessId()
+			if keyId == "" {
+				keyId = credential.StoreKey()
+			}
+			if err = c.Encryptor.AddKeyFromString(keyId, resolved.AccessKey()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.encryptionKeyId != "" {
+		return c.Encryptor.SetActiveKey(c.encryptionKeyId)
+	}
+	if count := c.Encryptor.keyCount(); count > 1 {
+		return cerr.NewConfigError(correlationId, "AMBIGUOUS_ENCRYPTION_KEY",
+			"Encryption key_id for "+c.CollectionName+" must be set when there are several encryption keys").
+			WithDetails("keys", count)
+	}
+	if c.Encryptor.ActiveKeyId() == "" {
+		return cerr.NewConfigError(correlationId, "NO_ENCRYPTION_KEY", "Encryption keys for "+c.CollectionName+" are not set")
+	}
+	return nil
+}
+
+// encryptDocument encrypts the configured fields of a document to be stored.
+func (c *MongoDbPersistence[T]) encryptDocument(correlationId string, doc map[string]any) (map[string]any, error) {
+	if c.Encryptor == nil {
+		return doc, nil
+	}
+	return c.Encryptor.EncryptDocument(correlationId, doc)
+}
+
+// encryptUpdate encrypts the values set to the configured fields by an update.
+func (c *MongoDbPersistence[T]) encryptUpdate(correlationId string, update any) (any, error) {
+	if c.Encryptor == nil {
+		return update, nil
+	}
+	return c.Encryptor.EncryptUpdate(correlationId, update)
+}
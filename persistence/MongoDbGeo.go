@@ -0,0 +1,359 @@
+package persistence
+
+import (
+	"context"
+
+	cconv "github.com/pip-services3-gox/pip-services3-commons-gox/convert"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// earthRadius is the equatorial radius of the Earth in meters used to convert distances to radians.
+const earthRadius = 6378100.0
+
+// geoDistanceField is the temporary field to return distances calculated by $geoNear.
+const geoDistanceField = "_distance"
+
+// GeoPoint is a GeoJSON point. It can be used as a field of data items
+// and is stored as is, so the field can be indexed with EnsureGeoIndex.
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPoint creates a new GeoJSON point.
+//
+//	Parameters:
+//		- longitude float64 a longitude in degrees.
+//		- latitude float64 a latitude in degrees.
+//	Returns: GeoPoint the created point.
+func NewGeoPoint(longitude float64, latitude float64) GeoPoint {
+	return GeoPoint{Type: "Point", Coordinates: []float64{longitude, latitude}}
+}
+
+// Longitude gets the longitude of the point in degrees.
+func (p GeoPoint) Longitude() float64 {
+	if len(p.Coordinates) < 1 {
+		return 0
+	}
+	return p.Coordinates[0]
+}
+
+// Latitude gets the latitude of the point in degrees.
+func (p GeoPoint) Latitude() float64 {
+	if len(p.Coordinates) < 2 {
+		return 0
+	}
+	return p.Coordinates[1]
+}
+
+// GeoPolygon is a GeoJSON polygon. The first ring is the exterior boundary,
+// other rings are holes inside of it.
+type GeoPolygon struct {
+	Type        string        `bson:"type" json:"type"`
+	Coordinates [][][]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPolygon creates a new GeoJSON polygon. Rings that are not closed
+// are closed by repeating the first position.
+//
+//	Parameters:
+//		- rings ...[][]float64 rings of [longitude, latitude] positions.
+//	Returns: GeoPolygon the created polygon.
+func NewGeoPolygon(rings ...[][]float64) GeoPolygon {
+	coordinates := make([][][]float64, 0, len(rings))
+	for _, ring := range rings {
+		if len(ring) > 0 {
+			first, last := ring[0], ring[len(ring)-1]
+			if len(first) != len(last) || len(first) < 2 || first[0] != last[0] || first[1] != last[1] {
+				ring = append(append([][]float64{}, ring...), first)
+			}
+		}
+		coordinates = append(coordinates, ring)
+	}
+	return GeoPolygon{Type: "Polygon", Coordinates: coordinates}
+}
+
+// MongoDbGeoItem is a data item found by GetPageNear with its distance from the query point.
+type MongoDbGeoItem[T any] struct {
+	Item T `json:"item"`
+	// The distance from the query point in meters.
+	Distance float64 `json:"distance"`
+}
+
+// GeoNearFilter composes a $near filter that selects documents sorted from the nearest to the farthest.
+// It can't be used in counts, so read pages with the filter without total or use GetPageNear.
+//
+//	Parameters:
+//		- field string a field with GeoJSON points.
+//		- point GeoPoint a point to search near.
+//		- maxDistance float64 (optional) maximum distance in meters, 0 for no limit.
+//		- minDistance float64 (optional) minimum distance in meters, 0 for no limit.
+//	Returns: bson.M the filter.
+func GeoNearFilter(field string, point GeoPoint, maxDistance float64, minDistance float64) bson.M {
+	near := bson.M{"$geometry": point}
+	if maxDistance > 0 {
+		near["$maxDistance"] = maxDistance
+	}
+	if minDistance > 0 {
+		near["$minDistance"] = minDistance
+	}
+	return bson.M{field: bson.M{"$near": near}}
+}
+
+// GeoWithinFilter composes a $geoWithin filter that selects documents inside the geometry.
+//
+//	Parameters:
+//		- field string a field with GeoJSON objects.
+//		- geometry any a GeoJSON polygon or multipolygon, like GeoPolygon.
+//	Returns: bson.M the filter.
+func GeoWithinFilter(field string, geometry any) bson.M {
+	return bson.M{field: bson.M{"$geoWithin": bson.M{"$geometry": geometry}}}
+}
+
+// GeoWithinSphereFilter composes a $geoWithin filter that selects documents inside the circle on the sphere.
+//
+//	Parameters:
+//		- field string a field with GeoJSON objects.
+//		- center GeoPoint a center of the circle.
+//		- radius float64 a radius of the circle in meters.
+//	Returns: bson.M the filter.
+func GeoWithinSphereFilter(field string, center GeoPoint, radius float64) bson.M {
+	sphere := bson.A{bson.A{center.Longitude(), center.Latitude()}, radius / earthRadius}
+	return bson.M{field: bson.M{"$geoWithin": bson.M{"$centerSphere": sphere}}}
+}
+
+// GeoIntersectsFilter composes a $geoIntersects filter that selects documents intersecting the geometry.
+//
+//	Parameters:
+//		- field string a field with GeoJSON objects.
+//		- geometry any a GeoJSON object, like GeoPoint or GeoPolygon.
+//	Returns: bson.M the filter.
+func GeoIntersectsFilter(field string, geometry any) bson.M {
+	return bson.M{field: bson.M{"$geoIntersects": bson.M{"$geometry": geometry}}}
+}
+
+// EnsureGeoIndex method adds 2dsphere index definition to create it on opening.
+// Geospatial queries by the field require the index.
+//
+//	Parameters:
+//		- field string a field with GeoJSON objects.
+//		- options *mongoopt.IndexOptions (optional) index options.
+func (c *MongoDbPersistence[T]) EnsureGeoIndex(field string, options *mongoopt.IndexOptions) {
+	c.EnsureIndex(bson.D{{Key: field, Value: "2dsphere"}}, options)
+}
+
+// GetPageNear gets a page of data items sorted from the nearest to the farthest from the point
+// with $geoNear stage, and returns distances to them.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- field string a field with GeoJSON points, it must have 2dsphere index.
+//		- point GeoPoint a point to search near.
+//		- maxDistance float64 (optional) maximum distance in meters, 0 for no limit.
+//		- minDistance float64 (optional) minimum distance in meters, 0 for no limit.
+//		- filter any (optional) a filter BSON object.
+//		- paging cdata.PagingParams (optional) paging parameters
+//		- sel any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: page cdata.DataPage[MongoDbGeoItem[T]], err error a data page with distances or error, if they are occurred
+func (c *MongoDbPersistence[T]) GetPageNear(ctx context.Context, correlationId string,
+	field string, point GeoPoint, maxDistance float64, minDistance float64,
+	filter any, paging cdata.PagingParams, sel any, queryOptions ...MongoDbQueryOption) (page cdata.DataPage[MongoDbGeoItem[T]], err error) {
+
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	near := bson.D{
+		{Key: "near", Value: point},
+		{Key: "key", Value: field},
+		{Key: "distanceField", Value: geoDistanceField},
+		{Key: "spherical", Value: true},
+		{Key: "query", Value: filter},
+	}
+	if maxDistance > 0 {
+		near = append(near, bson.E{Key: "maxDistance", Value: maxDistance})
+	}
+	if minDistance > 0 {
+		near = append(near, bson.E{Key: "minDistance", Value: minDistance})
+	}
+
+	skip := paging.GetSkip(-1)
+	take := paging.GetTake((int64)(c.maxPageSize))
+	itemsPipeline := bson.A{}
+	if skip > 0 {
+		itemsPipeline = append(itemsPipeline, bson.M{"$skip": skip})
+	}
+	itemsPipeline = append(itemsPipeline, bson.M{"$limit": take})
+	if !isEmptyDocument(sel) {
+		itemsPipeline = append(itemsPipeline, bson.M{"$project": geoProjection(sel)})
+	}
+
+	pipeline := bson.A{bson.M{"$geoNear": near}}
+	if paging.Total {
+		totalPipeline := bson.A{}
+		if c.maxCount > 0 {
+			totalPipeline = append(totalPipeline, bson.M{"$limit": c.maxCount})
+		}
+		totalPipeline = append(totalPipeline, bson.M{"$count": "count"})
+		pipeline = append(pipeline, bson.M{"$facet": bson.M{"items": itemsPipeline, "total": totalPipeline}})
+	} else {
+		pipeline = append(pipeline, itemsPipeline...)
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline, c.resolveQueryOptions(queryOptions).aggregate())
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), err
+	}
+	defer cursor.Close(ctx)
+
+	var raws []bson.Raw
+	total := int64(cdata.EmptyTotalValue)
+	if paging.Total {
+		var result struct {
+			Items []bson.Raw `bson:"items"`
+			Total []struct {
+				Count int64 `bson:"count"`
+			} `bson:"total"`
+		}
+		if cursor.Next(ctx) {
+			if err = cursor.Decode(&result); err != nil {
+				return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), err
+			}
+		}
+		raws, total = result.Items, 0
+		if len(result.Total) > 0 {
+			total = result.Total[0].Count
+		}
+	} else {
+		for cursor.Next(ctx) {
+			if c.IsTerminated() {
+				return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), cerr.
+					NewError("query terminated").
+					WithCorrelationId(correlationId)
+			}
+			raws = append(raws, append(bson.Raw{}, cursor.Current...))
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), err
+	}
+
+	items := make([]MongoDbGeoItem[T], 0, len(raws))
+	decodeErrs := make([]*cerr.ApplicationError, 0)
+	for _, raw := range raws {
+		item, distance, curErr := c.decodeScoredDocument(raw, geoDistanceField)
+		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, raw, curErr, &decodeErrs); err != nil {
+				return *cdata.NewEmptyDataPage[MongoDbGeoItem[T]](), err
+			}
+			continue
+		}
+		items = append(items, MongoDbGeoItem[T]{Item: item, Distance: distance})
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d near %v from %s", len(items), point.Coordinates, c.CollectionName)
+	return *cdata.NewDataPage(items, int(total)), c.composeDecodeErrors(correlationId, decodeErrs)
+}
+
+// GetPageWithin gets a page of data items inside the geometry.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- field string a field with GeoJSON objects.
+//		- geometry any a GeoJSON polygon or multipolygon, like GeoPolygon.
+//		- filter any (optional) a filter BSON object.
+//		- paging cdata.PagingParams (optional) paging parameters
+//		- sort any (optional) sorting BSON object
+//		- sel any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: page cdata.DataPage[T], err error a data page or error, if they are occurred
+func (c *MongoDbPersistence[T]) GetPageWithin(ctx context.Context, correlationId string,
+	field string, geometry any, filter any, paging cdata.PagingParams, sort any, sel any,
+	queryOptions ...MongoDbQueryOption) (page cdata.DataPage[T], err error) {
+
+	return c.GetPageByFilter(ctx, correlationId, combineFilters(filter, GeoWithinFilter(field, geometry)), paging, sort, sel, queryOptions...)
+}
+
+// GetPageIntersects gets a page of data items intersecting the geometry.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- field string a field with GeoJSON objects.
+//		- geometry any a GeoJSON object, like GeoPoint or GeoPolygon.
+//		- filter any (optional) a filter BSON object.
+//		- paging cdata.PagingParams (optional) paging parameters
+//		- sort any (optional) sorting BSON object
+//		- sel any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: page cdata.DataPage[T], err error a data page or error, if they are occurred
+func (c *MongoDbPersistence[T]) GetPageIntersects(ctx context.Context, correlationId string,
+	field string, geometry any, filter any, paging cdata.PagingParams, sort any, sel any,
+	queryOptions ...MongoDbQueryOption) (page cdata.DataPage[T], err error) {
+
+	return c.GetPageByFilter(ctx, correlationId, combineFilters(filter, GeoIntersectsFilter(field, geometry)), paging, sort, sel, queryOptions...)
+}
+
+// decodeScoredDocument decodes a document with a computed field like distance or text score
+// that is not a part of the data item.
+func (c *MongoDbPersistence[T]) decodeScoredDocument(raw bson.Raw, field string) (item T, score float64, err error) {
+	elements, err := raw.Elements()
+	if err != nil {
+		return item, 0, err
+	}
+	doc := make(bson.D, 0, len(elements))
+	for _, element := range elements {
+		if element.Key() == field {
+			score, _ = element.Value().DoubleOK()
+			continue
+		}
+		doc = append(doc, bson.E{Key: element.Key(), Value: element.Value()})
+	}
+	if raw, err = bson.Marshal(doc); err != nil {
+		return item, 0, err
+	}
+	item, err = c.decodeDocument(raw)
+	return item, score, err
+}
+
+// geoProjection keeps the distance in inclusion projections.
+func geoProjection(sel any) any {
+	elements := documentElements(sel)
+	for _, element := range elements {
+		if element.Key == "_id" {
+			continue
+		}
+		switch v := element.Value.(type) {
+		case bool:
+			if !v {
+				return sel
+			}
+		case int, int32, int64, float64:
+			if cconv.IntegerConverter.ToInteger(v) == 0 {
+				return sel
+			}
+		}
+	}
+	if elements == nil {
+		return sel
+	}
+	return append(bson.D{{Key: geoDistanceField, Value: 1}}, elements...)
+}
+
+// combineFilters requires documents to match both filters.
+func combineFilters(filter any, condition bson.M) any {
+	if isEmptyDocument(filter) {
+		return condition
+	}
+	return bson.M{"$and": bson.A{filter, condition}}
+}
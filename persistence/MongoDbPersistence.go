@@ -2,8 +2,10 @@ package persistence
 
 import (
 	"context"
-	"math/rand"
-	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/jinzhu/copier"
 	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
@@ -11,6 +13,7 @@ import (
 	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
 	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
 	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	cauth "github.com/pip-services3-gox/pip-services3-components-gox/auth"
 	clog "github.com/pip-services3-gox/pip-services3-components-gox/log"
 	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,6 +35,10 @@ type IMongoDbPersistenceOverrides[T any] interface {
 // over the data items must be implemented in child classes by
 // accessing c.Db or c.Collection properties.
 //
+// When tenancy is enabled every operation is routed to the tenant carried by the context (see WithTenantId).
+// Child classes shall get the tenant collection and filter with ResolveCollection and ResolveFilter
+// instead of accessing c.Collection directly.
+//
 //	Configuration parameters:
 //		- collection:                  (optional) MongoDB collection name
 //		- connection(s):
@@ -56,10 +63,47 @@ type IMongoDbPersistenceOverrides[T any] interface {
 //			- ssl:                       (optional) enable SSL connection (default: false) (not implements in this release)
 //			- auth_source:               (optional) authentication source
 //			- debug:                     (optional) enable debug output (default: false). (not used)
+//			- decode_error_policy:       (optional) handling of undecodable documents: skip, collect or fail (default: skip)
+//			- facet_count:               (optional) read page items and total in a single $facet aggregation (default: false)
+//			- estimated_count:           (optional) use estimated document count for totals of unfiltered pages (default: false)
+//			- max_count:                 (optional) maximum number of documents to count for totals, 0 for no limit (default: 0)
+//			- max_time_ms:               (optional) maximum time to execute operations in milliseconds, 0 for no limit (default: 0)
+//			- allow_disk_use:            (optional) allow large sorts and aggregations to use temporary files
+//			- comment:                   (optional) comment to identify operations in server logs
+//			- collation_locale:          (optional) locale of collation to compare strings in operations
+//			- collation_strength:        (optional) strength of collation, 1 or 2 for case-insensitive comparison
+//		- tenancy:
+//			- mode:                      (optional) separation of tenants: none, discriminator, collection or database (default: none)
+//			- field:                     (optional) tenant field in discriminator mode (default: tenant_id)
+//			- name_template:             (optional) name of tenant collection or database with {collection}, {database} and {tenant} placeholders
+//			                             (default: {collection}_{tenant} or {database}_{tenant})
+//		- collection_options:          (optional) options to create the collection with when it doesn't exist, see EnsureCollection
+//			- capped:                    (optional) create a capped collection (default: false)
+//			- size:                      (optional) maximum size of a capped collection in bytes
+//			- max:                       (optional) maximum number of documents in a capped collection
+//			- time_field:                (optional) field with time of measurements to create a time-series collection
+//			- meta_field:                (optional) field with metadata of measurements in a time-series collection
+//			- granularity:               (optional) granularity of measurements: seconds, minutes or hours
+//			- expire_after_seconds:      (optional) time to live of documents in time-series or clustered collections
+//			- clustered:                 (optional) create a collection clustered by _id (default: false)
+//			- collation:
+//				- locale:                  (optional) locale of the default collation
+//				- strength:                (optional) comparison strength of the default collation
+//			- pre_and_post_images:       (optional) record pre- and post-images of documents for change streams
+//		- encryption:
+//			- fields:                    (optional) comma-separated fields encrypted with random nonces
+//			- deterministic_fields:      (optional) comma-separated fields encrypted to be searchable by equality, see EncryptedFilter
+//			- key_id:                    (optional) id of the key to encrypt new values, required when several keys are set (default: the only key)
+//			- keys:
+//				- <key_id>:                base64 encoded AES key of 16, 24 or 32 bytes
+//			- credential(s):
+//				- store_key:               (optional) a key to retrieve the encryption key from ICredentialStore
+//				- access_id:               id of the encryption key
+//				- access_key:              base64 encoded AES key of 16, 24 or 32 bytes
 //	References:
 //		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
 //		- *:discovery:*:*:1.0        (optional) IDiscovery services
-//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials and encryption keys
 //
 // Example:
 //	type MyMongoDbPersistence struct {
@@ -135,6 +179,35 @@ type MongoDbPersistence[T any] struct {
 	localConnection bool
 	indexes         []mongodrv.IndexModel
 	maxPageSize     int32
+	facetCount      bool
+	estimatedCount  bool
+	maxCount        int64
+	toPublicId      func(id any) any
+	tenancyMode     TenancyMode
+	tenantField     string
+	tenantTemplate  string
+	tenantLock      sync.Mutex
+	tenants         map[string]*mongodrv.Collection
+	audit           *mongoDbAuditTrail
+
+	collectionOptions       *mongoopt.CreateCollectionOptions
+	configCollectionOptions *mongoopt.CreateCollectionOptions
+
+	encryptionKeyId       string
+	encryptionErr         error
+	encryptionCredentials *cauth.CredentialResolver
+
+	// Defines how read operations handle undecodable documents.
+	//	see DecodeErrorPolicy
+	DecodeErrorPolicy DecodeErrorPolicy
+
+	// Encrypts configured fields before writes and decrypts them after reads.
+	// It is nil when no fields are encrypted.
+	Encryptor *MongoDbFieldEncryptor
+
+	// Default driver options of operations, see MongoDbQueryOptions.
+	// Options passed to a call as MongoDbQueryOption arguments override them.
+	QueryOptions MongoDbQueryOptions
 
 	// The dependency resolver.
 	DependencyResolver *crefer.DependencyResolver
@@ -189,6 +262,9 @@ func InheritMongoDbPersistence[T any](overrides IMongoDbPersistenceOverrides[T],
 	c.DependencyResolver = crefer.NewDependencyResolverWithParams(context.Background(), c.defaultConfig, c.references)
 	c.Logger = *clog.NewCompositeLogger()
 	c.CollectionName = collection
+	c.DecodeErrorPolicy = DecodeErrorSkip
+	c.tenancyMode = TenancyNone
+	c.tenantField = "tenant_id"
 	c.indexes = make([]mongodrv.IndexModel, 0, 10)
 	c.config = cconf.NewEmptyConfigParams()
 	c.JsonConvertor = cconv.NewDefaultCustomTypeJsonConvertor[T]()
@@ -207,6 +283,16 @@ func (c *MongoDbPersistence[T]) Configure(ctx context.Context, config *cconf.Con
 	c.config = config
 	c.DependencyResolver.Configure(ctx, config)
 	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.DecodeErrorPolicy = DecodeErrorPolicy(config.GetAsStringWithDefault("options.decode_error_policy", string(c.DecodeErrorPolicy)))
+	c.facetCount = config.GetAsBooleanWithDefault("options.facet_count", c.facetCount)
+	c.estimatedCount = config.GetAsBooleanWithDefault("options.estimated_count", c.estimatedCount)
+	c.maxCount = config.GetAsLongWithDefault("options.max_count", c.maxCount)
+	c.QueryOptions = NewMongoDbQueryOptionsFromConfig(config)
+	c.tenancyMode = TenancyMode(config.GetAsStringWithDefault("tenancy.mode", string(c.tenancyMode)))
+	c.tenantField = config.GetAsStringWithDefault("tenancy.field", c.tenantField)
+	c.tenantTemplate = config.GetAsStringWithDefault("tenancy.name_template", c.tenantTemplate)
+	c.configureCollection(config)
+	c.configureEncryption(ctx, config)
 }
 
 // SetReferences method are sets references to dependent components.
@@ -217,6 +303,9 @@ func (c *MongoDbPersistence[T]) Configure(ctx context.Context, config *cconf.Con
 func (c *MongoDbPersistence[T]) SetReferences(ctx context.Context, references crefer.IReferences) {
 	c.references = references
 	c.Logger.SetReferences(ctx, references)
+	if c.encryptionCredentials != nil {
+		c.encryptionCredentials.SetReferences(ctx, references)
+	}
 
 	// try to get a connection
 	c.DependencyResolver.SetReferences(ctx, references)
@@ -273,6 +362,11 @@ func (c *MongoDbPersistence[T]) EnsureIndex(keys any, options *mongoopt.IndexOpt
 //	Parameters:
 //		- item *any converted item
 func (c *MongoDbPersistence[T]) ConvertFromPublic(value T) (map[string]any, error) {
+	return convertFromPublic(value)
+}
+
+// convertFromPublic is the default conversion from public view shared by persistence implementations.
+func convertFromPublic[T any](value T) (map[string]any, error) {
 	buf, toBsonErr := bson.Marshal(value)
 	if toBsonErr != nil {
 		return nil, toBsonErr
@@ -309,6 +403,11 @@ func (c *MongoDbPersistence[T]) ConvertFromPublicPartial(item T) (map[string]any
 //	Parameters:
 //		- item *any converted item
 func (c *MongoDbPersistence[T]) ConvertToPublic(value any) (T, error) {
+	return convertToPublic[T](value)
+}
+
+// convertToPublic is the default conversion to public view shared by persistence implementations.
+func convertToPublic[T any](value any) (T, error) {
 	var item T
 
 	_, itemOk := any(item).(map[string]any)
@@ -362,6 +461,26 @@ func (c *MongoDbPersistence[T]) Open(ctx context.Context, correlationId string)
 		return nil
 	}
 
+	switch c.tenancyMode {
+	case TenancyNone, TenancyDiscriminator, TenancyCollection, TenancyDatabase:
+	default:
+		return cerr.NewConfigError(correlationId, "INVALID_TENANCY", "Unknown tenancy mode "+string(c.tenancyMode)).
+			WithDetails("mode", c.tenancyMode)
+	}
+	switch c.DecodeErrorPolicy {
+	case DecodeErrorSkip, DecodeErrorCollect, DecodeErrorFail:
+	default:
+		return cerr.NewConfigError(correlationId, "INVALID_DECODE_ERROR_POLICY",
+			"Unknown decode error policy "+string(c.DecodeErrorPolicy)).
+			WithDetails("policy", c.DecodeErrorPolicy)
+	}
+	if err := validateCollectionOptions(correlationId, c.configCollectionOptions); err != nil {
+		return err
+	}
+	if err := c.openEncryption(ctx, correlationId); err != nil {
+		return err
+	}
+
 	c.isTerminated = make(chan struct{})
 
 	if c.Connection == nil {
@@ -393,8 +512,22 @@ func (c *MongoDbPersistence[T]) Open(ctx context.Context, correlationId string)
 	// Define database schema
 	c.Overrides.DefineSchema()
 
-	// Recreate indexes
-	if len(c.indexes) > 0 {
+	// Create the collection with declared options. Collections of separated tenants are created when they are used for the first time
+	if err := validateCollectionOptions(correlationId, c.createCollectionOptions()); err != nil {
+		c.Db = nil
+		c.Client = nil
+		return err
+	}
+	if !c.separatesTenants() {
+		if err := c.ensureCollection(ctx, correlationId, c.Db, c.CollectionName); err != nil {
+			c.Db = nil
+			c.Client = nil
+			return err
+		}
+	}
+
+	// Recreate indexes. Collections of separated tenants get indexes when they are used for the first time
+	if len(c.indexes) > 0 && !c.separatesTenants() {
 		keys, err := c.Collection.Indexes().CreateMany(ctx, c.indexes, mongoopt.CreateIndexes())
 		if err != nil {
 			c.Db = nil
@@ -405,6 +538,10 @@ func (c *MongoDbPersistence[T]) Open(ctx context.Context, correlationId string)
 			c.Logger.Debug(ctx, correlationId, "Created index %s for collection %s", v, c.CollectionName)
 		}
 	}
+	if c.audit != nil {
+		c.audit.transactions = c.supportsTransactions(ctx)
+	}
+
 	c.opened = true
 	c.Logger.Debug(ctx, correlationId, "Connected to mongodb database %s, collection %s", c.DatabaseName, c.CollectionName)
 	return nil
@@ -439,6 +576,9 @@ func (c *MongoDbPersistence[T]) cleanUpConnection() {
 	c.Client = nil
 	c.Db = nil
 	c.Collection = nil
+	c.tenantLock.Lock()
+	c.tenants = nil
+	c.tenantLock.Unlock()
 	close(c.isTerminated)
 }
 
@@ -454,9 +594,41 @@ func (c *MongoDbPersistence[T]) Clear(ctx context.Context, correlationId string)
 		return cerr.NewError("Collection name is not defined")
 	}
 
-	if err := c.Collection.Drop(ctx); err != nil {
+	collection, filter, err := c.resolveScope(ctx, correlationId, nil)
+	if err != nil {
+		return err
+	}
+
+	// Tenants sharing the collection are cleared by deleting their documents
+	if c.tenancyMode == TenancyDiscriminator {
+		if _, err := collection.DeleteMany(ctx, filter, c.QueryOptions.delete()); err != nil {
+			return cerr.NewConnectionError(correlationId, "CLEAR_FAILED", "Clear collection failed.").WithCause(err)
+		}
+		return nil
+	}
+
+	if err := collection.Drop(ctx); err != nil {
 		return cerr.NewConnectionError(correlationId, "CLEAR_FAILED", "Clear collection failed.").WithCause(err)
 	}
+	if c.separatesTenants() {
+		// Indexes are recreated when the tenant is used again
+		c.tenantLock.Lock()
+		delete(c.tenants, GetTenantId(ctx))
+		c.tenantLock.Unlock()
+		return nil
+	}
+
+	// Collections with declared options are created again, otherwise inserts would create them implicitly without the options
+	if c.createCollectionOptions() != nil {
+		if err := c.ensureCollection(context.Background(), correlationId, c.Db, c.CollectionName); err != nil {
+			return err
+		}
+		if len(c.indexes) > 0 {
+			if _, err := collection.Indexes().CreateMany(context.Background(), c.indexes, mongoopt.CreateIndexes()); err != nil {
+				return cerr.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -471,14 +643,26 @@ func (c *MongoDbPersistence[T]) Clear(ctx context.Context, correlationId string)
 //		- paging cdata.PagingParams (optional) paging parameters
 //		- sort any (optional) sorting BSON object
 //		- select  any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: page cdata.DataPage[T], err error a data page or error, if they are occurred
 func (c *MongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlationId string,
-	filter any, paging cdata.PagingParams, sort any, sel any) (page cdata.DataPage[T], err error) {
+	filter any, paging cdata.PagingParams, sort any, sel any, queryOptions ...MongoDbQueryOption) (page cdata.DataPage[T], err error) {
+	query := c.resolveQueryOptions(queryOptions)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return *cdata.NewEmptyDataPage[T](), err
+	}
+
 	// Adjust max item count based on configuration
 
 	skip := paging.GetSkip(-1)
 	take := paging.GetTake((int64)(c.maxPageSize))
 	pagingEnabled := paging.Total
+
+	if pagingEnabled && c.facetCount && !(c.estimatedCount && isEmptyDocument(filter)) {
+		return c.getPageWithFacet(ctx, correlationId, collection, filter, skip, take, sort, sel, query)
+	}
+
 	// Configure options
 	var options mongoopt.FindOptions
 	if skip >= 0 {
@@ -492,7 +676,7 @@ func (c *MongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlation
 		options.Projection = sel
 	}
 
-	cursor, err := c.Collection.Find(ctx, filter, &options)
+	cursor, err := collection.Find(ctx, filter, &options, query.find())
 	if err != nil {
 		return *cdata.NewEmptyDataPage[T](), err
 	}
@@ -505,17 +689,18 @@ func (c *MongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlation
 	}
 
 	items := make([]T, 0, 1)
+	decodeErrs := make([]*cerr.ApplicationError, 0)
 	for cursor.Next(ctx) {
 		if c.IsTerminated() {
 			return *cdata.NewEmptyDataPage[T](), cerr.
 				NewError("query terminated").
 				WithCorrelationId(correlationId)
 		}
-		var item T
-
-		curErr := cursor.Decode(&item)
-
+		item, curErr := c.decodeDocument(cursor.Current)
 		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, cursor.Current, curErr, &decodeErrs); err != nil {
+				return *cdata.NewEmptyDataPage[T](), err
+			}
 			continue
 		}
 
@@ -524,16 +709,126 @@ func (c *MongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlation
 	if items != nil {
 		c.Logger.Trace(ctx, correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
 	}
+	decodeErr := c.composeDecodeErrors(correlationId, decodeErrs)
 	if pagingEnabled {
 		if c.IsTerminated() {
 			return *cdata.NewEmptyDataPage[T](), cerr.
 				NewError("query terminated").
 				WithCorrelationId(correlationId)
 		}
-		docCount, _ := c.Collection.CountDocuments(ctx, filter)
-		return *cdata.NewDataPage(items, int(docCount)), nil
+		docCount, err := c.countTotal(ctx, collection, filter, query)
+		if err != nil {
+			return *cdata.NewEmptyDataPage[T](), err
+		}
+		return *cdata.NewDataPage(items, int(docCount)), decodeErr
+	}
+	return *cdata.NewDataPage(items, cdata.EmptyTotalValue), decodeErr
+}
+
+// getPageWithFacet reads a page of data items and their total count in a single aggregation.
+// The result of $facet stage is limited by maximum BSON document size, so it must be used with moderate page sizes.
+func (c *MongoDbPersistence[T]) getPageWithFacet(ctx context.Context, correlationId string,
+	collection *mongodrv.Collection, filter any, skip int64, take int64, sort any, sel any,
+	query MongoDbQueryOptions) (page cdata.DataPage[T], err error) {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	itemsPipeline := bson.A{}
+	if skip > 0 {
+		itemsPipeline = append(itemsPipeline, bson.M{"$skip": skip})
+	}
+	if take > 0 {
+		itemsPipeline = append(itemsPipeline, bson.M{"$limit": take})
+	}
+	if !isEmptyDocument(sel) {
+		itemsPipeline = append(itemsPipeline, bson.M{"$project": sel})
+	}
+
+	totalPipeline := bson.A{}
+	if c.maxCount > 0 {
+		totalPipeline = append(totalPipeline, bson.M{"$limit": c.maxCount})
+	}
+	totalPipeline = append(totalPipeline, bson.M{"$count": "count"})
+
+	pipeline := mongodrv.Pipeline{{{Key: "$match", Value: filter}}}
+	if !isEmptyDocument(sort) {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.M{
+		"items": itemsPipeline,
+		"total": totalPipeline,
+	}}})
+
+	cursor, err := collection.Aggregate(ctx, pipeline, query.aggregate())
+	if err != nil {
+		return *cdata.NewEmptyDataPage[T](), err
+	}
+	defer cursor.Close(ctx)
+
+	if c.IsTerminated() {
+		return *cdata.NewEmptyDataPage[T](), cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
+	}
+
+	var result struct {
+		Items []bson.Raw `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return *cdata.NewEmptyDataPage[T](), err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return *cdata.NewEmptyDataPage[T](), err
+	}
+
+	items := make([]T, 0, len(result.Items))
+	decodeErrs := make([]*cerr.ApplicationError, 0)
+	for _, raw := range result.Items {
+		item, curErr := c.decodeDocument(raw)
+		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, raw, curErr, &decodeErrs); err != nil {
+				return *cdata.NewEmptyDataPage[T](), err
+			}
+			continue
+		}
+		items = append(items, item)
+	}
+
+	var total int64
+	if len(result.Total) > 0 {
+		total = result.Total[0].Count
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d of %d from %s", len(items), total, c.CollectionName)
+	return *cdata.NewDataPage(items, int(total)), c.composeDecodeErrors(correlationId, decodeErrs)
+}
+
+// countTotal counts documents for a page total according to configured count options.
+func (c *MongoDbPersistence[T]) countTotal(ctx context.Context,
+	collection *mongodrv.Collection, filter any, query MongoDbQueryOptions) (count int64, err error) {
+	if c.estimatedCount && isEmptyDocument(filter) {
+		count, err = collection.EstimatedDocumentCount(ctx, query.estimatedCount())
+		if err == nil && c.maxCount > 0 && count > c.maxCount {
+			count = c.maxCount
+		}
+		return count, err
 	}
-	return *cdata.NewDataPage(items, cdata.EmptyTotalValue), nil
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	options := mongoopt.Count()
+	if c.maxCount > 0 {
+		options.SetLimit(c.maxCount)
+	}
+	return collection.CountDocuments(ctx, filter, options, query.count())
 }
 
 // GetListByFilter is gets a list of data items retrieved by a given filter and sorted according to sort parameters.
@@ -546,9 +841,16 @@ func (c *MongoDbPersistence[T]) GetPageByFilter(ctx context.Context, correlation
 //		- filter any (optional) a filter BSON object
 //		- sort any (optional) sorting BSON object
 //		- select any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
 //	Returns: items []any, err error data list and error, if they are occurred
 func (c *MongoDbPersistence[T]) GetListByFilter(ctx context.Context, correlationId string,
-	filter any, sort any, sel any) (items []T, err error) {
+	filter any, sort any, sel any, queryOptions ...MongoDbQueryOption) (items []T, err error) {
+
+	query := c.resolveQueryOptions(queryOptions)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return nil, err
+	}
 
 	// Configure options
 	var options mongoopt.FindOptions
@@ -560,7 +862,7 @@ func (c *MongoDbPersistence[T]) GetListByFilter(ctx context.Context, correlation
 		options.Projection = sel
 	}
 
-	cursor, err := c.Collection.Find(ctx, filter, &options)
+	cursor, err := collection.Find(ctx, filter, &options, query.find())
 	if err != nil {
 		return nil, err
 	}
@@ -573,135 +875,1197 @@ func (c *MongoDbPersistence[T]) GetListByFilter(ctx context.Context, correlation
 			WithCorrelationId(correlationId)
 	}
 
+	decodeErrs := make([]*cerr.ApplicationError, 0)
 	for cursor.Next(ctx) {
 		if c.IsTerminated() {
 			return nil, cerr.
 				NewError("query terminated").
 				WithCorrelationId(correlationId)
 		}
-		var docPointer map[string]any
-		curErr := cursor.Decode(&docPointer)
+		item, curErr := c.decodeDocument(cursor.Current)
 		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, cursor.Current, curErr, &decodeErrs); err != nil {
+				return nil, err
+			}
 			continue
 		}
-
-		item, err := c.Overrides.ConvertToPublic(docPointer)
-		if err != nil {
-			return items, nil
-		}
 		items = append(items, item)
 	}
 
 	if items != nil {
 		c.Logger.Trace(ctx, correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
 	}
-	return items, nil
+	return items, c.composeDecodeErrors(correlationId, decodeErrs)
 }
 
-// GetOneRandom is gets a random item from items that match to a given filter.
-// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getOneRandom method from child class that
+// MongoDbStreamOptions defines options for streaming query results.
+type MongoDbStreamOptions struct {
+	// The number of documents to fetch from the server in each batch (0 for server default).
+	BatchSize int32
+	// Prevents the server from closing idle cursors after inactivity period.
+	NoCursorTimeout bool
+	// The size of the result channel buffer (default: 0).
+	BufferSize int
+}
+
+// MongoDbStreamItem is an element of streaming query results.
+// Err is set when the document could not be decoded or the query failed.
+type MongoDbStreamItem[T any] struct {
+	Item T
+	Err  error
+}
+
+// StreamByFilter is gets data items that match to a given filter as a stream
+// without loading the entire result set into memory.
+// The stream is closed after the last item, when ctx is cancelled or when the persistence is closed.
+// Decode errors are sent as items with Err and don't interrupt the stream.
+// The consumer must read the channel until it is closed or cancel ctx to release the cursor.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) streamByFilter method from child type that
 // receives FilterParams and converts them into a filter function.
 //
 //	Parameters:
 //		- ctx context.Context
 //		- correlationId string (optional) transaction id to Trace execution through call chain.
-//		- filter any (optional) a filter BSON object
-//	Returns: item any, err error random item and error, if theq are occured
-func (c *MongoDbPersistence[T]) GetOneRandom(ctx context.Context, correlationId string,
-	filter any) (item T, err error) {
+//		- filter any (optional) a filter JSON object
+//		- sort any (optional) sorting BSON object
+//		- sel any (optional) projection BSON object
+//		- options *MongoDbStreamOptions (optional) streaming options
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: stream <-chan MongoDbStreamItem[T], err error a stream of data items and error, if query failed.
+func (c *MongoDbPersistence[T]) StreamByFilter(ctx context.Context, correlationId string,
+	filter any, sort any, sel any, options *MongoDbStreamOptions,
+	queryOptions ...MongoDbQueryOption) (stream <-chan MongoDbStreamItem[T], err error) {
+
+	if options == nil {
+		options = &MongoDbStreamOptions{}
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	// Configure options
+	findOptions := mongoopt.Find()
+	if sort != nil {
+		findOptions.SetSort(sort)
+	}
+	if sel != nil {
+		findOptions.SetProjection(sel)
+	}
+	if options.BatchSize > 0 {
+		findOptions.SetBatchSize(options.BatchSize)
+	}
+	if options.NoCursorTimeout {
+		findOptions.SetNoCursorTimeout(true)
+	}
+
+	if c.IsTerminated() {
+		return nil, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
+	}
 
-	docCount, err := c.Collection.CountDocuments(ctx, filter)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
 	if err != nil {
-		return item, err
+		return nil, err
 	}
 
-	var options mongoopt.FindOptions
-	rand.Seed(time.Now().UnixNano())
-	var itemNum int64 = rand.Int63n(docCount)
-	var itemLim int64 = 1
+	cursor, err := collection.Find(ctx, filter, findOptions, c.resolveQueryOptions(queryOptions).find())
+	if err != nil {
+		return nil, err
+	}
+
+	terminated := c.isTerminated
+	result := make(chan MongoDbStreamItem[T], options.BufferSize)
+
+	send := func(item MongoDbStreamItem[T]) bool {
+		select {
+		case result <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-terminated:
+			return false
+		}
+	}
+
+	go func() {
+		defer close(result)
+		// The context may be already cancelled, so the cursor is killed with a separate one
+		defer cursor.Close(context.Background())
+
+		count := 0
+		for cursor.Next(ctx) {
+			select {
+			case <-terminated:
+				send(MongoDbStreamItem[T]{
+					Err: cerr.NewError("query terminated").WithCorrelationId(correlationId),
+				})
+				return
+			default:
+			}
+
+			item, err := c.decodeDocument(cursor.Current)
+			if err != nil {
+				appErr := c.decodeError(ctx, correlationId, cursor.Current, err)
+				if c.DecodeErrorPolicy == DecodeErrorSkip {
+					continue
+				}
+				if !send(MongoDbStreamItem[T]{Err: appErr}) || c.DecodeErrorPolicy == DecodeErrorFail {
+					return
+				}
+				continue
+			}
+
+			if !send(MongoDbStreamItem[T]{Item: item}) {
+				return
+			}
+			count++
+		}
+
+		if err := cursor.Err(); err != nil && ctx.Err() == nil {
+			send(MongoDbStreamItem[T]{Err: err})
+			return
+		}
+
+		c.Logger.Trace(ctx, correlationId, "Streamed %d from %s", count, c.CollectionName)
+	}()
+
+	return result, nil
+}
+
+// GetOneByFilter is gets the first data item that matches to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getOneByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- sort any (optional) sorting BSON object to select the first item
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, found bool, err error a data item, true if it was found and error, if they are occurred
+func (c *MongoDbPersistence[T]) GetOneByFilter(ctx context.Context, correlationId string,
+	filter any, sort any, queryOptions ...MongoDbQueryOption) (item T, found bool, err error) {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	options := mongoopt.FindOne()
+	if !isEmptyDocument(sort) {
+		options.SetSort(sort)
+	}
 
-	if itemNum < 0 {
-		itemNum = 0
+	if c.IsTerminated() {
+		return item, false, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
 	}
-	options.Skip = &itemNum
-	options.Limit = &itemLim
 
-	cursor, err := c.Collection.Find(ctx, filter, &options)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
 	if err != nil {
-		return item, err
+		return item, false, err
 	}
-	defer cursor.Close(ctx)
 
-	var docPointer map[string]any
-	cursor.Next(ctx)
-	err = cursor.Decode(&docPointer)
+	res := collection.FindOne(ctx, filter, options, c.resolveQueryOptions(queryOptions).findOne())
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			c.Logger.Trace(ctx, correlationId, "Nothing found from %s", c.CollectionName)
+			return item, false, nil
+		}
+		return item, false, err
+	}
+
+	raw, err := res.DecodeBytes()
 	if err != nil {
-		return item, err
+		return item, false, err
+	}
+	if item, err = c.decodeDocument(raw); err != nil {
+		var defaultValue T
+		return defaultValue, false, c.handleSingleDecodeError(ctx, correlationId, raw, err)
 	}
 
-	return c.Overrides.ConvertToPublic(docPointer)
+	c.Logger.Trace(ctx, correlationId, "Retrieved from %s with id = %s", c.CollectionName, documentId(raw))
+	return item, true, nil
 }
 
-// Create was creates a data item.
+// ExistsByFilter is checks if there are data items that match to a given filter.
+// It reads only id of the first matching item, so it's cheaper than counting.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) existsByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
 //
 //	Parameters:
 //		- ctx context.Context
-//		- correlation_id string (optional) transaction id to Trace execution through call chain.
-//		- item any an item to be created.
-//	Returns: result any, err error created item and error, if they are occurred
-func (c *MongoDbPersistence[T]) Create(ctx context.Context, correlationId string, item T) (result T, err error) {
-	newItem, err := c.Overrides.ConvertFromPublic(item)
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: exists bool, err error true if matching items exist and error, if they are occurred
+func (c *MongoDbPersistence[T]) ExistsByFilter(ctx context.Context, correlationId string,
+	filter any, queryOptions ...MongoDbQueryOption) (exists bool, err error) {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	options := mongoopt.FindOne().SetProjection(bson.M{"_id": 1})
+
+	if c.IsTerminated() {
+		return false, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
+	}
+
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
 	if err != nil {
-		return result, err
+		return false, err
+	}
+
+	res := collection.FindOne(ctx, filter, options, c.resolveQueryOptions(queryOptions).findOne())
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			err = nil
+		}
+		return false, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Found items in %s", c.CollectionName)
+	return true, nil
+}
+
+// GetDistinctValues is gets distinct values of a field in data items that match to a given filter.
+// Values of _id field are converted the same way as ids of data items.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getDistinctValues method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- field string a field path to get values of.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: values []any, err error distinct values and error, if they are occurred
+func (c *MongoDbPersistence[T]) GetDistinctValues(ctx context.Context, correlationId string,
+	field string, filter any, queryOptions ...MongoDbQueryOption) (values []any, err error) {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	if c.IsTerminated() {
+		return nil, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
 	}
-	insRes, err := c.Collection.InsertOne(ctx, newItem)
+
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
-	result, err = c.Overrides.ConvertToPublic(newItem)
+	values, err = collection.Distinct(ctx, field, filter, c.resolveQueryOptions(queryOptions).distinct())
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	c.Logger.Trace(ctx, correlationId, "Created in %s with id = %s", c.Collection, insRes.InsertedID)
-	return result, nil
+
+	if field == "_id" && c.toPublicId != nil {
+		for i, value := range values {
+			values[i] = c.toPublicId(value)
+		}
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d distinct values of %s from %s", len(values), field, c.CollectionName)
+	return values, nil
 }
 
-// DeleteByFilter is deletes data items that match to a given filter.
-// This method shall be called by a func (c *IdentifiableMongoDbPersistence) deleteByFilter method from child class that
+// GetOneRandom is gets a random item from items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getOneRandom method from child class that
 // receives FilterParams and converts them into a filter function.
 //
 //	Parameters:
 //		- ctx context.Context
-//		- correlationId  string (optional) transaction id to Trace execution through call chain.
-//		- filter any (optional) a filter BSON object.
-//	Returns: error or nil for success.
-func (c *MongoDbPersistence[T]) DeleteByFilter(ctx context.Context, correlationId string, filter any) error {
-	res, err := c.Collection.DeleteMany(ctx, filter)
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item any, err error random item or zero value if no items match and error, if theq are occured
+func (c *MongoDbPersistence[T]) GetOneRandom(ctx context.Context, correlationId string,
+	filter any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	cursor, err := c.sampleByFilter(ctx, correlationId, filter, 1, c.resolveQueryOptions(queryOptions))
 	if err != nil {
-		return err
+		return item, err
 	}
-	c.Logger.Trace(ctx, correlationId, "Deleted %d items from %s", res.DeletedCount, c.Collection)
-	return nil
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return item, cursor.Err()
+	}
+	if item, err = c.decodeDocument(cursor.Current); err != nil {
+		var defaultValue T
+		return defaultValue, c.handleSingleDecodeError(ctx, correlationId, cursor.Current, err)
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved random item from %s", c.CollectionName)
+	return item, nil
 }
 
-// GetCountByFilter is gets a count of data items retrieved by a given filter.
-// This method shall be called by a func (c *IdentifiableMongoDbPersistence) GetCountByFilter method from child type that
+// GetRandomList is gets a list of random items from items that match to a given filter.
+// The list contains less items if not enough items match to the filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getRandomList method from child class that
 // receives FilterParams and converts them into a filter function.
 //
 //	Parameters:
 //		- ctx context.Context
-//		- correlationId  string (optional) transaction id to Trace execution through call chain.
-//		- filter any
-//	Returns: count int, err error a data count or error, if they are occurred
-func (c *MongoDbPersistence[T]) GetCountByFilter(ctx context.Context, correlationId string, filter any) (count int64, err error) {
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object
+//		- size int64 maximum number of items to be retrieved.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: items []T, err error random items and error, if they are occured
+func (c *MongoDbPersistence[T]) GetRandomList(ctx context.Context, correlationId string,
+	filter any, size int64, queryOptions ...MongoDbQueryOption) (items []T, err error) {
 
-	// Configure options
-	var options mongoopt.CountOptions
-	count, err = c.Collection.CountDocuments(ctx, filter, &options)
+	items = make([]T, 0)
+	if size <= 0 {
+		return items, nil
+	}
+
+	cursor, err := c.sampleByFilter(ctx, correlationId, filter, size, c.resolveQueryOptions(queryOptions))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	c.Logger.Trace(ctx, correlationId, "Find %d items in %s", count, c.CollectionName)
-	return count, nil
+	defer cursor.Close(ctx)
+
+	decodeErrs := make([]*cerr.ApplicationError, 0)
+	for cursor.Next(ctx) {
+		if c.IsTerminated() {
+			return nil, cerr.
+				NewError("query terminated").
+				WithCorrelationId(correlationId)
+		}
+
+		item, curErr := c.decodeDocument(cursor.Current)
+		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, cursor.Current, curErr, &decodeErrs); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d random items from %s", len(items), c.CollectionName)
+	return items, c.composeDecodeErrors(correlationId, decodeErrs)
+}
+
+// sampleByFilter selects random documents that match to a filter with $sample aggregation stage.
+func (c *MongoDbPersistence[T]) sampleByFilter(ctx context.Context, correlationId string,
+	filter any, size int64, query MongoDbQueryOptions) (*mongodrv.Cursor, error) {
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	if c.IsTerminated() {
+		return nil, cerr.
+			NewError("query terminated").
+			WithCorrelationId(correlationId)
+	}
+
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongodrv.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sample", Value: bson.M{"size": size}}},
+	}
+	return collection.Aggregate(ctx, pipeline, query.aggregate())
+}
+
+// Create was creates a data item.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlation_id string (optional) transaction id to Trace execution through call chain.
+//		- item any an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result any, err error created item and error, if they are occurred
+func (c *MongoDbPersistence[T]) Create(ctx context.Context, correlationId string, item T,
+	queryOptions ...MongoDbQueryOption) (result T, err error) {
+	newItem, err := c.Overrides.ConvertFromPublic(item)
+	if err != nil {
+		return result, err
+	}
+	if err = c.resolveDocument(ctx, correlationId, newItem); err != nil {
+		return result, err
+	}
+	stored, err := c.encryptDocument(correlationId, newItem)
+	if err != nil {
+		return result, err
+	}
+	collection, err := c.ResolveCollection(ctx, correlationId)
+	if err != nil {
+		return result, err
+	}
+	var insRes *mongodrv.InsertOneResult
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		if insRes, err = collection.InsertOne(ctx, stored, c.resolveQueryOptions(queryOptions).insertOne()); err != nil {
+			return err
+		}
+		return c.writeAudit(ctx, correlationId, collection, nil, withDocumentId(stored, insRes.InsertedID))
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result, err = c.Overrides.ConvertToPublic(newItem)
+	if err != nil {
+		return result, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Created in %s with id = %s", c.Collection, insRes.InsertedID)
+	return result, nil
+}
+
+// DeleteByFilter is deletes data items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) deleteByFilter method from child class that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: error or nil for success.
+func (c *MongoDbPersistence[T]) DeleteByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) error {
+	query := c.resolveQueryOptions(queryOptions)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return err
+	}
+	var deleted int64
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		if c.audit == nil {
+			res, err := collection.DeleteMany(ctx, filter, query.delete())
+			if err != nil {
+				return err
+			}
+			deleted = res.DeletedCount
+			return nil
+		}
+
+		// Only documents recorded in the history are deleted
+		deleted = 0
+		return c.auditBatches(ctx, collection, filter, func(ctx context.Context, befores []bson.M) error {
+			res, err := collection.DeleteMany(ctx, bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": auditIds(befores)}}}},
+				query.delete())
+			if err != nil {
+				return err
+			}
+			deleted += res.DeletedCount
+			return c.writeAuditChanges(ctx, correlationId, collection, befores, nil)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	c.Logger.Trace(ctx, correlationId, "Deleted %d items from %s", deleted, c.Collection)
+	return nil
+}
+
+// UpdateByFilter is updates all data items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) updateByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: result MongoDbUpdateResult, err error counts of updated items and error, if they are occurred
+func (c *MongoDbPersistence[T]) UpdateByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (result MongoDbUpdateResult, err error) {
+
+	doc, arrayFilters, err := composeUpdate(correlationId, update)
+	if err != nil {
+		return result, err
+	}
+	if err = c.resolveUpdate(ctx, correlationId, doc); err != nil {
+		return result, err
+	}
+	if doc, err = c.encryptUpdate(correlationId, doc); err != nil {
+		return result, err
+	}
+	query := c.resolveQueryOptions(queryOptions)
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return result, err
+	}
+	options := mongoopt.Update()
+	if arrayFilters != nil {
+		options.SetArrayFilters(*arrayFilters)
+	}
+
+	err = c.auditWrite(ctx, correlationId, func(ctx context.Context) error {
+		if c.audit == nil {
+			res, err := collection.UpdateMany(ctx, filter, doc, options, query.update())
+			if err != nil {
+				return err
+			}
+			result = MongoDbUpdateResult{
+				MatchedCount:  res.MatchedCount,
+				ModifiedCount: res.ModifiedCount,
+			}
+			return nil
+		}
+
+		// Only documents recorded in the history are updated
+		result = MongoDbUpdateResult{}
+		return c.auditBatches(ctx, collection, filter, func(ctx context.Context, befores []bson.M) error {
+			ids := auditIds(befores)
+			res, err := collection.UpdateMany(ctx, bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}},
+				doc, options, query.update())
+			if err != nil {
+				return err
+			}
+			result.MatchedCount += res.MatchedCount
+			result.ModifiedCount += res.ModifiedCount
+
+			afters, err := c.auditDocuments(ctx, collection, bson.M{"_id": bson.M{"$in": ids}}, 0)
+			if err != nil {
+				return err
+			}
+			return c.writeAuditChanges(ctx, correlationId, collection, befores, afters)
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	c.Logger.Trace(ctx, correlationId, "Updated %d items in %s", result.ModifiedCount, c.CollectionName)
+	return result, nil
+}
+
+// UpdateOneByFilter is updates the first data item that matches to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) updateOneByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error updated item and error, if they are occurred
+func (c *MongoDbPersistence[T]) UpdateOneByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	options := mongoopt.FindOneAndUpdate().SetReturnDocument(mongoopt.After)
+	return c.findOneAndUpdate(ctx, correlationId, filter, update, options, c.resolveQueryOptions(queryOptions))
+}
+
+// UpsertByFilter is updates the first data item that matches to a given filter
+// or creates a new one from the filter equality fields and the update if no items match.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) upsertByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any a cdata.AnyValueMap with fields to be set, a *MongoDbUpdateBuilder or an update BSON document with operators.
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: item T, err error updated or created item and error, if they are occurred
+func (c *MongoDbPersistence[T]) UpsertByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+
+	options := mongoopt.FindOneAndUpdate().SetReturnDocument(mongoopt.After).SetUpsert(true)
+	return c.findOneAndUpdate(ctx, correlationId, filter, update, options, c.resolveQueryOptions(queryOptions))
+}
+
+func (c *MongoDbPersistence[T]) findOneAndUpdate(ctx context.Context, correlationId string,
+	filter any, update any, options *mongoopt.FindOneAndUpdateOptions, query MongoDbQueryOptions) (item T, err error) {
+
+	doc, arrayFilters, err := composeUpdate(correlationId, update)
+	if err != nil {
+		return item, err
+	}
+	if err = c.resolveUpdate(ctx, correlationId, doc); err != nil {
+		return item, err
+	}
+	if doc, err = c.encryptUpdate(correlationId, doc); err != nil {
+		return item, err
+	}
+	if arrayFilters != nil {
+		options.SetArrayFilters(*arrayFilters)
+	}
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return item, err
+	}
+
+	raw, err := c.auditUpdateOne(ctx, correlationId, collection, filter, doc, options, query)
+	if err != nil {
+		if errors.Is(err, mongodrv.ErrNoDocuments) {
+			return item, nil
+		}
+		return item, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Updated in %s with id = %s", c.CollectionName, documentId(raw))
+	return c.decodeDocument(raw)
+}
+
+// GetCountByFilter is gets a count of data items retrieved by a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) GetCountByFilter method from child type that
+// receives FilterParams and converts them into a filter function.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to Trace execution through call chain.
+//		- filter any
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: count int, err error a data count or error, if they are occurred
+func (c *MongoDbPersistence[T]) GetCountByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) (count int64, err error) {
+
+	collection, filter, err := c.resolveScope(ctx, correlationId, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// Configure options
+	var options mongoopt.CountOptions
+	count, err = collection.CountDocuments(ctx, filter, &options, c.resolveQueryOptions(queryOptions).count())
+	if err != nil {
+		return 0, err
+	}
+	c.Logger.Trace(ctx, correlationId, "Find %d items in %s", count, c.CollectionName)
+	return count, nil
+}
+
+// ExecuteInTransaction executes an action inside MongoDB transaction.
+// All operations called by the action with the passed context participate in the transaction.
+// If the context already belongs to a session the action joins it without starting a new transaction.
+// Actions registered by the operations to run after commit, like cache invalidations, are executed
+// when the transaction is committed. Transactions require MongoDB replica set or sharded cluster.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- action func(ctx context.Context) error an action to execute.
+//	Returns: error or nil when the transaction was committed.
+func (c *MongoDbPersistence[T]) ExecuteInTransaction(ctx context.Context, correlationId string,
+	action func(ctx context.Context) error) error {
+
+	if mongodrv.SessionFromContext(ctx) != nil {
+		return action(ctx)
+	}
+
+	session, err := c.Client.StartSession()
+	if err != nil {
+		return cerr.NewConnectionError(correlationId, "SESSION_FAILED", "Failed to start MongoDB session").WithCause(err)
+	}
+	defer session.EndSession(ctx)
+
+	commit := &afterCommitActions{}
+	_, err = session.WithTransaction(context.WithValue(ctx, afterCommitKey{}, commit), func(sessCtx mongodrv.SessionContext) (any, error) {
+		// The action is retried on transient errors, so actions of failed attempts are discarded
+		commit.reset()
+		return nil, action(sessCtx)
+	})
+	if err != nil {
+		return err
+	}
+	commit.run()
+	return nil
+}
+
+type afterCommitKey struct{}
+
+// afterCommitActions are actions to run after the transaction started by ExecuteInTransaction is committed.
+type afterCommitActions struct {
+	lock    sync.Mutex
+	actions []func()
+}
+
+func (a *afterCommitActions) add(action func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.actions = append(a.actions, action)
+}
+
+func (a *afterCommitActions) reset() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.actions = nil
+}
+
+func (a *afterCommitActions) run() {
+	a.lock.Lock()
+	actions := a.actions
+	a.actions = nil
+	a.lock.Unlock()
+
+	for _, action := range actions {
+		action()
+	}
+}
+
+// afterCommit runs an action after the transaction carried by the context is committed,
+// or right away when the context has no transaction. The action is also run right away
+// in transactions not started by ExecuteInTransaction, as their commit can't be observed.
+func afterCommit(ctx context.Context, action func()) {
+	if mongodrv.SessionFromContext(ctx) != nil {
+		if commit, ok := ctx.Value(afterCommitKey{}).(*afterCommitActions); ok {
+			commit.add(action)
+			return
+		}
+	}
+	action()
+}
+
+// ResolveCollection gets the collection of the tenant carried by the context.
+// Child types shall use it instead of c.Collection in custom operations to support tenancy.
+// Collections of separated tenants are created lazily with all defined indexes
+// when they are used for the first time.
+//
+//	Parameters:
+//		- ctx context.Context a context with the tenant id, see WithTenantId.
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//	Returns: *mongodrv.Collection, error the collection of the tenant and error, if tenant can't be resolved.
+func (c *MongoDbPersistence[T]) ResolveCollection(ctx context.Context, correlationId string) (*mongodrv.Collection, error) {
+	if c.tenancyMode == TenancyNone {
+		return c.Collection, nil
+	}
+
+	tenantId, err := c.resolveTenantId(ctx, correlationId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.separatesTenants() {
+		return c.Collection, nil
+	}
+
+	c.tenantLock.Lock()
+	collection, ok := c.tenants[tenantId]
+	c.tenantLock.Unlock()
+	if ok {
+		return collection, nil
+	}
+	if !c.opened {
+		return nil, cerr.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+
+	name := c.tenantName(tenantId)
+	if c.tenancyMode == TenancyDatabase {
+		collection = c.Client.Database(name).Collection(c.CollectionName)
+	} else {
+		collection = c.Db.Collection(name)
+	}
+
+	// Collections can't be created inside transactions, so they are created outside of the call session
+	if err = c.ensureCollection(context.Background(), correlationId, collection.Database(), collection.Name()); err != nil {
+		return nil, err
+	}
+
+	if len(c.indexes) > 0 {
+		// Indexes can't be created inside transactions, so they are created outside of the call session
+		keys, err := collection.Indexes().CreateMany(context.Background(), c.indexes, mongoopt.CreateIndexes())
+		if err != nil {
+			return nil, cerr.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Create indexes for tenant "+tenantId+" failed").
+				WithDetails("tenant_id", tenantId).
+				WithCause(err)
+		}
+		for _, v := range keys {
+			c.Logger.Debug(ctx, correlationId, "Created index %s for tenant %s in %s", v, tenantId, name)
+		}
+	}
+
+	c.tenantLock.Lock()
+	if c.tenants == nil {
+		c.tenants = make(map[string]*mongodrv.Collection)
+	}
+	c.tenants[tenantId] = collection
+	c.tenantLock.Unlock()
+	return collection, nil
+}
+
+// ResolveFilter restricts a filter to the tenant carried by the context.
+// In discriminator mode the filter is combined with the tenant field condition,
+// so it can't select documents of other tenants. In other modes the filter is returned as is.
+//
+//	Parameters:
+//		- ctx context.Context a context with the tenant id, see WithTenantId.
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- filter any (optional) a filter BSON object.
+//	Returns: any, error the tenant filter and error, if tenant can't be resolved.
+func (c *MongoDbPersistence[T]) ResolveFilter(ctx context.Context, correlationId string, filter any) (any, error) {
+	if c.tenancyMode != TenancyDiscriminator {
+		return filter, nil
+	}
+
+	tenantId, err := c.resolveTenantId(ctx, correlationId)
+	if err != nil {
+		return nil, err
+	}
+	tenantFilter := bson.M{c.tenantField: tenantId}
+	if isEmptyDocument(filter) {
+		return tenantFilter, nil
+	}
+	return bson.M{"$and": bson.A{filter, tenantFilter}}, nil
+}
+
+// resolveScope resolves the collection and the filter of the tenant carried by the context.
+func (c *MongoDbPersistence[T]) resolveScope(ctx context.Context, correlationId string,
+	filter any) (*mongodrv.Collection, any, error) {
+
+	collection, err := c.ResolveCollection(ctx, correlationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err = c.ResolveFilter(ctx, correlationId, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collection, filter, nil
+}
+
+// resolveDocument marks a stored document with the tenant in discriminator mode.
+// Documents that already belong to another tenant are rejected.
+func (c *MongoDbPersistence[T]) resolveDocument(ctx context.Context, correlationId string, doc map[string]any) error {
+	if c.tenancyMode != TenancyDiscriminator {
+		return nil
+	}
+
+	tenantId, err := c.resolveTenantId(ctx, correlationId)
+	if err != nil {
+		return err
+	}
+	if value, ok := doc[c.tenantField]; ok && value != nil && value != "" && value != tenantId {
+		return cerr.NewUnauthorizedError(correlationId, "TENANT_MISMATCH",
+			"Document belongs to another tenant than "+tenantId).
+			WithDetails("tenant_id", tenantId).
+			WithDetails("document_tenant_id", value)
+	}
+	doc[c.tenantField] = tenantId
+	return nil
+}
+
+// resolveUpdate checks that an update document or pipeline doesn't move documents
+// to another tenant in discriminator mode. The tenant field can only be set to the current tenant.
+func (c *MongoDbPersistence[T]) resolveUpdate(ctx context.Context, correlationId string, update any) error {
+	if c.tenancyMode != TenancyDiscriminator {
+		return nil
+	}
+
+	tenantId, err := c.resolveTenantId(ctx, correlationId)
+	if err != nil {
+		return err
+	}
+
+	var stages []any
+	switch v := update.(type) {
+	case bson.A:
+		stages = v
+	case []any:
+		stages = v
+	case mongodrv.Pipeline:
+		for _, stage := range v {
+			stages = append(stages, stage)
+		}
+	case []bson.M:
+		for _, stage := range v {
+			stages = append(stages, stage)
+		}
+	default:
+		stages = []any{update}
+	}
+
+	for _, stage := range stages {
+		for _, operation := range documentElements(stage) {
+			switch operation.Key {
+			case "$replaceRoot", "$replaceWith", "$project":
+				return c.tenantFieldError(correlationId, operation.Key)
+			case "$unset":
+				// Pipeline $unset stage takes field names instead of a document
+				for _, field := range documentPaths(operation.Value) {
+					if c.isTenantPath(field) {
+						return c.tenantFieldError(correlationId, operation.Key)
+					}
+				}
+			}
+
+			for _, field := range documentElements(operation.Value) {
+				changed := c.isTenantPath(field.Key)
+				if target, ok := field.Value.(string); ok && operation.Key == "$rename" {
+					changed = changed || c.isTenantPath(target)
+				}
+				if !changed {
+					continue
+				}
+				switch operation.Key {
+				case "$set", "$setOnInsert", "$addFields":
+					if field.Key == c.tenantField && field.Value == tenantId {
+						continue
+					}
+				}
+				return c.tenantFieldError(correlationId, operation.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveTenantId gets the tenant id from the context and checks that it can be used by the tenancy mode.
+func (c *MongoDbPersistence[T]) resolveTenantId(ctx context.Context, correlationId string) (string, error) {
+	tenantId := GetTenantId(ctx)
+	if tenantId == "" {
+		return "", cerr.NewBadRequestError(correlationId, "NO_TENANT", "Tenant id is missing in the context").
+			WithDetails("collection", c.CollectionName)
+	}
+	if c.separatesTenants() && !tenantNamePattern.MatchString(tenantId) {
+		return "", cerr.NewBadRequestError(correlationId, "INVALID_TENANT",
+			"Tenant id "+tenantId+" can't be used in collection or database names").
+			WithDetails("tenant_id", tenantId)
+	}
+	return tenantId, nil
+}
+
+// separatesTenants checks if tenants are kept in separate collections or databases.
+func (c *MongoDbPersistence[T]) separatesTenants() bool {
+	return c.tenancyMode == TenancyCollection || c.tenancyMode == TenancyDatabase
+}
+
+// tenantName composes a name of the tenant collection or database from the template.
+func (c *MongoDbPersistence[T]) tenantName(tenantId string) string {
+	template := c.tenantTemplate
+	if template == "" && c.tenancyMode == TenancyDatabase {
+		template = "{database}_{tenant}"
+	} else if template == "" {
+		template = "{collection}_{tenant}"
+	}
+	return strings.NewReplacer(
+		"{collection}", c.CollectionName,
+		"{database}", c.DatabaseName,
+		"{tenant}", tenantId,
+	).Replace(template)
+}
+
+// isTenantPath checks if changing a field path changes the tenant field.
+func (c *MongoDbPersistence[T]) isTenantPath(path string) bool {
+	return path == c.tenantField ||
+		strings.HasPrefix(path, c.tenantField+".") ||
+		strings.HasPrefix(c.tenantField, path+".")
+}
+
+func (c *MongoDbPersistence[T]) tenantFieldError(correlationId string, operator string) error {
+	return cerr.NewBadRequestError(correlationId, "TENANT_FIELD_IMMUTABLE",
+		"Update can't change tenant field "+c.tenantField+" with "+operator).
+		WithDetails("field", c.tenantField).
+		WithDetails("operator", operator)
+}
+
+// decodeDocument decodes a raw document and converts it into a public object
+// with Overrides.ConvertToPublic. All read operations share this pipeline,
+// so custom conversions are applied consistently.
+func (c *MongoDbPersistence[T]) decodeDocument(raw bson.Raw) (item T, err error) {
+	var docPointer map[string]any
+	if err = bson.Unmarshal(raw, &docPointer); err != nil {
+		return item, err
+	}
+	if c.Encryptor != nil {
+		if err = c.Encryptor.DecryptDocument("", docPointer); err != nil {
+			return item, err
+		}
+	}
+	return c.Overrides.ConvertToPublic(c.toPublicDocument(docPointer))
+}
+
+// toPublicDocument converts the stored id of a document into the public one.
+func (c *MongoDbPersistence[T]) toPublicDocument(doc map[string]any) map[string]any {
+	if c.toPublicId != nil {
+		if id, ok := doc["_id"]; ok {
+			doc["_id"] = c.toPublicId(id)
+		}
+	}
+	return doc
+}
+
+// decodeError logs a document decode error and wraps it with the document id and collection name.
+func (c *MongoDbPersistence[T]) decodeError(ctx context.Context, correlationId string,
+	raw bson.Raw, err error) *cerr.ApplicationError {
+
+	id := documentId(raw)
+	c.Logger.Error(ctx, correlationId, err, "Failed to decode document %v from %s", id, c.CollectionName)
+
+	return cerr.NewInternalError(correlationId, "DECODE_FAILED",
+		"Failed to decode document "+cconv.StringConverter.ToString(id)+" from "+c.CollectionName).
+		WithDetails("collection", c.CollectionName).
+		WithDetails("id", id).
+		WithCause(err)
+}
+
+// handleDecodeError applies the decode error policy to a document read by a list operation.
+// Returns an error only when reading shall be stopped.
+func (c *MongoDbPersistence[T]) handleDecodeError(ctx context.Context, correlationId string,
+	raw bson.Raw, err error, collected *[]*cerr.ApplicationError) error {
+
+	appErr := c.decodeError(ctx, correlationId, raw, err)
+	switch c.DecodeErrorPolicy {
+	case DecodeErrorFail:
+		return appErr
+	case DecodeErrorCollect:
+		*collected = append(*collected, appErr)
+	}
+	return nil
+}
+
+// handleSingleDecodeError applies the decode error policy to a document read by a single item operation.
+// Skipped documents are treated as not found.
+func (c *MongoDbPersistence[T]) handleSingleDecodeError(ctx context.Context, correlationId string,
+	raw bson.Raw, err error) error {
+
+	appErr := c.decodeError(ctx, correlationId, raw, err)
+	if c.DecodeErrorPolicy == DecodeErrorSkip {
+		return nil
+	}
+	return appErr
+}
+
+// composeDecodeErrors composes a single error from collected decode errors.
+func (c *MongoDbPersistence[T]) composeDecodeErrors(correlationId string, collected []*cerr.ApplicationError) error {
+	if len(collected) == 0 {
+		return nil
+	}
+
+	ids := make([]any, 0, len(collected))
+	for _, err := range collected {
+		ids = append(ids, err.Details["id"])
+	}
+
+	return cerr.NewInternalError(correlationId, "DECODE_FAILED",
+		"Failed to decode "+cconv.StringConverter.ToString(len(collected))+" documents from "+c.CollectionName).
+		WithDetails("collection", c.CollectionName).
+		WithDetails("ids", ids).
+		WithDetails("errors", collected)
+}
+
+// composeUpdate converts a map with fields into $set update document
+// and validates update builders. Update documents with operators and pipelines are passed as is.
+func composeUpdate(correlationId string, update any) (doc any, arrayFilters *mongoopt.ArrayFilters, err error) {
+	switch v := update.(type) {
+	case cdata.AnyValueMap:
+		return bson.M{"$set": v.Value()}, nil, nil
+	case *cdata.AnyValueMap:
+		return bson.M{"$set": v.Value()}, nil, nil
+	case *MongoDbUpdateBuilder:
+		if err := v.Validate(correlationId); err != nil {
+			return nil, nil, err
+		}
+		if len(v.ArrayFilters()) > 0 {
+			arrayFilters = &mongoopt.ArrayFilters{Filters: v.ArrayFilters()}
+		}
+		return v.Update(), arrayFilters, nil
+	}
+	return update, nil, nil
+}
+
+// tenantNamePattern defines tenant ids that are safe to use in collection and database names.
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// documentElements gets fields of a BSON document in a uniform way.
+func documentElements(doc any) []bson.E {
+	switch v := doc.(type) {
+	case bson.D:
+		return v
+	case bson.M:
+		return mapElements(v)
+	case map[string]any:
+		return mapElements(v)
+	}
+	return nil
+}
+
+func mapElements(doc map[string]any) []bson.E {
+	elements := make([]bson.E, 0, len(doc))
+	for k, v := range doc {
+		elements = append(elements, bson.E{Key: k, Value: v})
+	}
+	return elements
+}
+
+// documentPaths gets field paths listed as a string or an array of strings.
+func documentPaths(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case bson.A:
+		return anyPaths(v)
+	case []any:
+		return anyPaths(v)
+	}
+	return nil
+}
+
+func anyPaths(values []any) []string {
+	paths := make([]string, 0, len(values))
+	for _, value := range values {
+		if path, ok := value.(string); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// withDocumentId sets the id assigned by the server to an inserted document.
+func withDocumentId(doc map[string]any, id any) map[string]any {
+	if _, ok := doc["_id"]; ok || id == nil {
+		return doc
+	}
+	result := make(map[string]any, len(doc)+1)
+	for k, v := range doc {
+		result[k] = v
+	}
+	result["_id"] = id
+	return result
+}
+
+// isEmptyDocument checks if a filter, sort or projection document has no fields.
+func isEmptyDocument(doc any) bool {
+	switch v := doc.(type) {
+	case nil:
+		return true
+	case bson.M:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	case bson.D:
+		return len(v) == 0
+	case bson.Raw:
+		elements, err := v.Elements()
+		return err == nil && len(elements) == 0
+	}
+	return false
+}
+
+// documentId extracts the document id from raw document.
+func documentId(raw bson.Raw) any {
+	if raw == nil {
+		return nil
+	}
+	val, err := raw.LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	if str, ok := val.StringValueOK(); ok {
+		return str
+	}
+	if oid, ok := val.ObjectIDOK(); ok {
+		return oid.Hex()
+	}
+	return val.String()
 }
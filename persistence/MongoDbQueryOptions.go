@@ -0,0 +1,236 @@
+package persistence
+
+import (
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDbQueryOptions defines driver options applied to operations of persistence components.
+// Persistence-wide defaults are set in configuration and apply to all operations.
+// Read and write operations take MongoDbQueryOption arguments that override the defaults for a single call.
+// Options that are not supported by an operation are ignored:
+// maxTimeMS is applied to reads and find-and-modify operations, allowDiskUse to finds and aggregations.
+//
+// Example:
+//
+//	page, err := myPersistence.GetPageByFilter(ctx, "123", filter, paging, nil, nil,
+//		persistence.WithCollation(&options.Collation{Locale: "en", Strength: 2}),
+//		persistence.WithMaxTime(5*time.Second),
+//		persistence.WithComment("search by name"),
+//	)
+type MongoDbQueryOptions struct {
+	// Collation to compare strings, like case-insensitive comparison with strength 2.
+	Collation *mongoopt.Collation
+	// Index to use, either index name or index keys document.
+	Hint any
+	// Maximum time to execute the operation on the server.
+	MaxTime time.Duration
+	// Comment to identify the operation in server logs and profiler.
+	Comment string
+	// Permission to write temporary files for large sorts and aggregations.
+	AllowDiskUse *bool
+}
+
+// MongoDbQueryOption overrides configured query options for a single operation.
+type MongoDbQueryOption func(options *MongoDbQueryOptions)
+
+// WithQueryOptions overrides configured query options with all options that are set.
+//
+//	Parameters:
+//		- options MongoDbQueryOptions options of the operation.
+//	Returns: MongoDbQueryOption the query option.
+func WithQueryOptions(options MongoDbQueryOptions) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		*o = o.merge(options)
+	}
+}
+
+// WithCollation sets collation to compare strings.
+//
+//	Parameters:
+//		- collation *mongoopt.Collation the collation.
+//	Returns: MongoDbQueryOption the query option.
+func WithCollation(collation *mongoopt.Collation) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		o.Collation = collation
+	}
+}
+
+// WithHint sets an index to use.
+//
+//	Parameters:
+//		- hint any an index name or index keys document.
+//	Returns: MongoDbQueryOption the query option.
+func WithHint(hint any) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		o.Hint = hint
+	}
+}
+
+// WithMaxTime sets maximum time to execute the operation on the server. 0 removes the configured limit.
+//
+//	Parameters:
+//		- maxTime time.Duration the maximum execution time.
+//	Returns: MongoDbQueryOption the query option.
+func WithMaxTime(maxTime time.Duration) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		o.MaxTime = maxTime
+	}
+}
+
+// WithComment sets a comment to identify the operation in server logs and profiler.
+//
+//	Parameters:
+//		- comment string the comment.
+//	Returns: MongoDbQueryOption the query option.
+func WithComment(comment string) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		o.Comment = comment
+	}
+}
+
+// WithAllowDiskUse permits or forbids temporary files for large sorts and aggregations.
+//
+//	Parameters:
+//		- allowDiskUse bool true to permit temporary files.
+//	Returns: MongoDbQueryOption the query option.
+func WithAllowDiskUse(allowDiskUse bool) MongoDbQueryOption {
+	return func(o *MongoDbQueryOptions) {
+		o.AllowDiskUse = &allowDiskUse
+	}
+}
+
+// NewMongoDbQueryOptionsFromConfig reads default query options from configuration.
+//
+//	Configuration parameters:
+//		- options:
+//			- max_time_ms:               (optional) maximum time to execute operations in milliseconds, 0 for no limit
+//			- allow_disk_use:            (optional) allow large sorts and aggregations to use temporary files
+//			- comment:                   (optional) comment to identify operations in server logs
+//			- collation_locale:          (optional) locale of collation to compare strings
+//			- collation_strength:        (optional) strength of collation, 1 or 2 for case-insensitive comparison
+//
+//	Parameters:
+//		- config *cconf.ConfigParams configuration parameters.
+//	Returns: MongoDbQueryOptions the default options.
+func NewMongoDbQueryOptionsFromConfig(config *cconf.ConfigParams) MongoDbQueryOptions {
+	options := MongoDbQueryOptions{
+		MaxTime: time.Duration(config.GetAsLong("options.max_time_ms")) * time.Millisecond,
+		Comment: config.GetAsString("options.comment"),
+	}
+	if allowDiskUse, ok := config.GetAsNullableBoolean("options.allow_disk_use"); ok {
+		options.AllowDiskUse = &allowDiskUse
+	}
+	if locale := config.GetAsString("options.collation_locale"); locale != "" {
+		options.Collation = &mongoopt.Collation{
+			Locale:   locale,
+			Strength: config.GetAsInteger("options.collation_strength"),
+		}
+	}
+	return options
+}
+
+// merge overrides the options with the options that are set.
+func (o MongoDbQueryOptions) merge(options MongoDbQueryOptions) MongoDbQueryOptions {
+	if options.Collation != nil {
+		o.Collation = options.Collation
+	}
+	if options.Hint != nil {
+		o.Hint = options.Hint
+	}
+	if options.MaxTime > 0 {
+		o.MaxTime = options.MaxTime
+	}
+	if options.Comment != "" {
+		o.Comment = options.Comment
+	}
+	if options.AllowDiskUse != nil {
+		o.AllowDiskUse = options.AllowDiskUse
+	}
+	return o
+}
+
+func (o MongoDbQueryOptions) maxTime() *time.Duration {
+	if o.MaxTime <= 0 {
+		return nil
+	}
+	return &o.MaxTime
+}
+
+func (o MongoDbQueryOptions) comment() *string {
+	if o.Comment == "" {
+		return nil
+	}
+	return &o.Comment
+}
+
+// commentValue gets the comment for options that take a comment of any type.
+func (o MongoDbQueryOptions) commentValue() any {
+	if o.Comment == "" {
+		return nil
+	}
+	return o.Comment
+}
+
+func (o MongoDbQueryOptions) find() *mongoopt.FindOptions {
+	return &mongoopt.FindOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(),
+		Comment: o.comment(), AllowDiskUse: o.AllowDiskUse}
+}
+
+func (o MongoDbQueryOptions) findOne() *mongoopt.FindOneOptions {
+	return &mongoopt.FindOneOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(), Comment: o.comment()}
+}
+
+func (o MongoDbQueryOptions) count() *mongoopt.CountOptions {
+	return &mongoopt.CountOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(), Comment: o.comment()}
+}
+
+func (o MongoDbQueryOptions) estimatedCount() *mongoopt.EstimatedDocumentCountOptions {
+	return &mongoopt.EstimatedDocumentCountOptions{MaxTime: o.maxTime(), Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) aggregate() *mongoopt.AggregateOptions {
+	return &mongoopt.AggregateOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(),
+		Comment: o.comment(), AllowDiskUse: o.AllowDiskUse}
+}
+
+func (o MongoDbQueryOptions) distinct() *mongoopt.DistinctOptions {
+	return &mongoopt.DistinctOptions{Collation: o.Collation, MaxTime: o.maxTime(), Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) insertOne() *mongoopt.InsertOneOptions {
+	return &mongoopt.InsertOneOptions{Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) update() *mongoopt.UpdateOptions {
+	return &mongoopt.UpdateOptions{Collation: o.Collation, Hint: o.Hint, Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) delete() *mongoopt.DeleteOptions {
+	return &mongoopt.DeleteOptions{Collation: o.Collation, Hint: o.Hint, Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) findOneAndUpdate() *mongoopt.FindOneAndUpdateOptions {
+	return &mongoopt.FindOneAndUpdateOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(), Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) findOneAndReplace() *mongoopt.FindOneAndReplaceOptions {
+	return &mongoopt.FindOneAndReplaceOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(), Comment: o.commentValue()}
+}
+
+func (o MongoDbQueryOptions) findOneAndDelete() *mongoopt.FindOneAndDeleteOptions {
+	return &mongoopt.FindOneAndDeleteOptions{Collation: o.Collation, Hint: o.Hint, MaxTime: o.maxTime(), Comment: o.commentValue()}
+}
+
+// resolveQueryOptions gets the configured query options overridden by the options of a single operation.
+func (c *MongoDbPersistence[T]) resolveQueryOptions(options []MongoDbQueryOption) MongoDbQueryOptions {
+	result := c.QueryOptions
+	for _, option := range options {
+		if option != nil {
+			option(&result)
+		}
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package persistence
+
+import (
+	"context"
+	"sort"
+
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// textScoreField is the temporary field to return relevance scores of $text queries.
+const textScoreField = "_score"
+
+// MongoDbTextItem is a data item found by GetPageByText with its relevance score.
+type MongoDbTextItem[T any] struct {
+	Item T `json:"item"`
+	// The relevance score of the item, higher scores are more relevant.
+	Score float64 `json:"score"`
+}
+
+// EnsureTextIndex method adds text index definition to create it on opening.
+// A collection can have only one text index, so all searchable fields shall be listed in it.
+//
+//	Parameters:
+//		- weights map[string]int32 searchable fields with their weights, fields with higher weights are more relevant.
+//			Use "$**" to search all string fields.
+//		- language string (optional) default language of stemming and stop words, like "english" or "none".
+//		- options *mongoopt.IndexOptions (optional) index options.
+func (c *MongoDbPersistence[T]) EnsureTextIndex(weights map[string]int32, language string, options *mongoopt.IndexOptions) {
+	if len(weights) == 0 {
+		return
+	}
+	fields := make([]string, 0, len(weights))
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	keys := make(bson.D, 0, len(fields))
+	indexWeights := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: "text"})
+		indexWeights = append(indexWeights, bson.E{Key: field, Value: weights[field]})
+	}
+
+	if options == nil {
+		options = mongoopt.Index()
+	}
+	options.SetWeights(indexWeights)
+	if language != "" {
+		options.SetDefaultLanguage(language)
+	}
+	c.EnsureIndex(keys, options)
+}
+
+// TextFilter composes a $text filter that selects documents matching the search.
+//
+//	Parameters:
+//		- search string words and "quoted phrases" to search, words prefixed with "-" are excluded.
+//		- language string (optional) language of the search, empty for the default language of the index.
+//	Returns: bson.M the filter.
+func TextFilter(search string, language string) bson.M {
+	text := bson.M{"$search": search}
+	if language != "" {
+		text["$language"] = language
+	}
+	return bson.M{"$text": text}
+}
+
+// GetPageByText gets a page of data items matching the text search and the filter,
+// sorted from the most to the least relevant, with their relevance scores.
+// The collection must have a text index, see EnsureTextIndex.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to Trace execution through call chain.
+//		- search string words and "quoted phrases" to search, words prefixed with "-" are excluded.
+//		- language string (optional) language of the search, empty for the default language of the index.
+//		- filter any (optional) a filter BSON object.
+//		- paging cdata.PagingParams (optional) paging parameters
+//		- sel any (optional) projection BSON object
+//		- queryOptions ...MongoDbQueryOption (optional) options that override configured query options
+//	Returns: page cdata.DataPage[MongoDbTextItem[T]], err error a data page with scores or error, if they are occurred
+func (c *MongoDbPersistence[T]) GetPageByText(ctx context.Context, correlationId string,
+	search string, language string, filter any, paging cdata.PagingParams, sel any,
+	queryOptions ...MongoDbQueryOption) (page cdata.DataPage[MongoDbTextItem[T]], err error) {
+
+	query := c.resolveQueryOptions(queryOptions)
+	collection, filter, err := c.resolveScope(ctx, correlationId, combineFilters(filter, TextFilter(search, language)))
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), err
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	options := mongoopt.Find().
+		SetLimit(paging.GetTake((int64)(c.maxPageSize))).
+		SetSort(bson.D{{Key: textScoreField, Value: score}}).
+		SetProjection(append(bson.D{{Key: textScoreField, Value: score}}, documentElements(sel)...))
+	if skip := paging.GetSkip(-1); skip >= 0 {
+		options.SetSkip(skip)
+	}
+
+	cursor, err := collection.Find(ctx, filter, options, query.find())
+	if err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]MongoDbTextItem[T], 0)
+	decodeErrs := make([]*cerr.ApplicationError, 0)
+	for cursor.Next(ctx) {
+		if c.IsTerminated() {
+			return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), cerr.
+				NewError("query terminated").
+				WithCorrelationId(correlationId)
+		}
+		item, score, curErr := c.decodeScoredDocument(cursor.Current, textScoreField)
+		if curErr != nil {
+			if err := c.handleDecodeError(ctx, correlationId, cursor.Current, curErr, &decodeErrs); err != nil {
+				return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), err
+			}
+			continue
+		}
+		items = append(items, MongoDbTextItem[T]{Item: item, Score: score})
+	}
+	if err = cursor.Err(); err != nil {
+		return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), err
+	}
+	c.Logger.Trace(ctx, correlationId, "Retrieved %d by text from %s", len(items), c.CollectionName)
+
+	decodeErr := c.composeDecodeErrors(correlationId, decodeErrs)
+	if paging.Total {
+		count, err := c.countTotal(ctx, collection, filter, query)
+		if err != nil {
+			return *cdata.NewEmptyDataPage[MongoDbTextItem[T]](), err
+		}
+		return *cdata.NewDataPage(items, int(count)), decodeErr
+	}
+	return *cdata.NewDataPage(items, cdata.EmptyTotalValue), decodeErr
+}
@@ -0,0 +1,327 @@
+package persistence
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var arrayFilterIdentifier = regexp.MustCompile(`^\$\[([a-z][a-zA-Z0-9]*)?\]$`)
+
+type updateOperation struct {
+	operator string
+	path     string
+	value    any
+}
+
+// MongoDbUpdateBuilder helps to compose atomic update documents with
+// $set, $unset, $inc, $push, $pull and $addToSet operators.
+// Field paths can be dotted and contain positional operators ($, $[] and $[identifier]).
+// Filtered positional operators require array filters with matching identifiers.
+//
+// The builder validates the update before it is sent to the server:
+// a field can be changed by only one operator, and a field path can't be a prefix of another changed path.
+//
+// Example:
+//	update := persist.NewMongoDbUpdateBuilder().
+//		Inc("counters.views", 1).
+//		Push("tags", "new").
+//		Set("grades.$[low].passed", false).
+//		Unset("draft").
+//		ArrayFilter(bson.M{"low.score": bson.M{"$lt": 50}})
+//
+//	item, err := persistence.UpdatePartiallyWithBuilder(context.Background(), "123", "1", update)
+type MongoDbUpdateBuilder struct {
+	operations   []updateOperation
+	arrayFilters []any
+}
+
+// NewMongoDbUpdateBuilder creates a new empty update builder.
+//
+//	Returns: *MongoDbUpdateBuilder
+func NewMongoDbUpdateBuilder() *MongoDbUpdateBuilder {
+	return &MongoDbUpdateBuilder{
+		operations:   make([]updateOperation, 0),
+		arrayFilters: make([]any, 0),
+	}
+}
+
+// NewMongoDbUpdateBuilderFromMap creates a new update builder that sets fields from a map.
+//
+//	Parameters:
+//		- data cdata.AnyValueMap a map with field paths and values to be set.
+//	Returns: *MongoDbUpdateBuilder
+func NewMongoDbUpdateBuilderFromMap(data cdata.AnyValueMap) *MongoDbUpdateBuilder {
+	c := NewMongoDbUpdateBuilder()
+	keys := make([]string, 0, data.Len())
+	for key := range data.Value() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := data.Get(key)
+		c.Set(key, value)
+	}
+	return c
+}
+
+func (c *MongoDbUpdateBuilder) add(operator string, path string, value any) *MongoDbUpdateBuilder {
+	c.operations = append(c.operations, updateOperation{operator: operator, path: path, value: value})
+	return c
+}
+
+// Set sets a field value.
+//
+//	Parameters:
+//		- path string a field path.
+//		- value any a value to be set.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) Set(path string, value any) *MongoDbUpdateBuilder {
+	return c.add("$set", path, value)
+}
+
+// Unset removes a field.
+//
+//	Parameters:
+//		- path string a field path.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) Unset(path string) *MongoDbUpdateBuilder {
+	return c.add("$unset", path, "")
+}
+
+// Inc increments a numeric field by a given value.
+//
+//	Parameters:
+//		- path string a field path.
+//		- value any a numeric increment, negative to decrement.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) Inc(path string, value any) *MongoDbUpdateBuilder {
+	return c.add("$inc", path, value)
+}
+
+// Push appends values to an array field.
+//
+//	Parameters:
+//		- path string a field path.
+//		- values ...any values to be appended.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) Push(path string, values ...any) *MongoDbUpdateBuilder {
+	return c.add("$push", path, eachValue(values))
+}
+
+// Pull removes array elements that are equal to a value or match a condition.
+//
+//	Parameters:
+//		- path string a field path.
+//		- condition any a value or a query condition for elements to be removed.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) Pull(path string, condition any) *MongoDbUpdateBuilder {
+	return c.add("$pull", path, condition)
+}
+
+// AddToSet appends values to an array field unless they are already present.
+//
+//	Parameters:
+//		- path string a field path.
+//		- values ...any values to be added.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) AddToSet(path string, values ...any) *MongoDbUpdateBuilder {
+	return c.add("$addToSet", path, eachValue(values))
+}
+
+// ArrayFilter adds a filter for $[identifier] positional operators.
+//
+//	Parameters:
+//		- filter any a filter document with fields prefixed by the identifier.
+//	Returns: *MongoDbUpdateBuilder
+func (c *MongoDbUpdateBuilder) ArrayFilter(filter any) *MongoDbUpdateBuilder {
+	c.arrayFilters = append(c.arrayFilters, filter)
+	return c
+}
+
+// IsEmpty checks if the builder has no update operations.
+//
+//	Returns: true if the builder is empty.
+func (c *MongoDbUpdateBuilder) IsEmpty() bool {
+	return len(c.operations) == 0
+}
+
+// Update composes the update document.
+//
+//	Returns: bson.M update document with operators.
+func (c *MongoDbUpdateBuilder) Update() bson.M {
+	update := bson.M{}
+	for _, operation := range c.operations {
+		fields, ok := update[operation.operator].(bson.M)
+		if !ok {
+			fields = bson.M{}
+			update[operation.operator] = fields
+		}
+		fields[operation.path] = operation.value
+	}
+	return update
+}
+
+// ArrayFilters gets the array filters for $[identifier] positional operators.
+//
+//	Returns: []any array filters.
+func (c *MongoDbUpdateBuilder) ArrayFilters() []any {
+	return c.arrayFilters
+}
+
+// Validate checks that the update is not empty, field paths are valid,
+// operators don't change conflicting paths and all array filters match used identifiers.
+//
+//	Parameters:
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil if the update is valid.
+func (c *MongoDbUpdateBuilder) Validate(correlationId string) error {
+	if len(c.operations) == 0 {
+		return cerr.NewBadRequestError(correlationId, "EMPTY_UPDATE", "Update has no operations")
+	}
+
+	identifiers := map[string]bool{}
+	for i, operation := range c.operations {
+		if err := validateUpdatePath(correlationId, operation.path, identifiers); err != nil {
+			return err
+		}
+
+		if operation.operator == "$inc" && !isNumber(operation.value) {
+			return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Increment of "+operation.path+" must be a number").
+				WithDetails("path", operation.path)
+		}
+
+		for _, other := range c.operations[:i] {
+			if isConflictingPath(operation.path, other.path) {
+				return cerr.NewBadRequestError(correlationId, "CONFLICTING_UPDATE",
+					"Update of "+operation.path+" with "+operation.operator+
+						" conflicts with update of "+other.path+" with "+other.operator).
+					WithDetails("path", operation.path).
+					WithDetails("conflicting_path", other.path)
+			}
+		}
+	}
+
+	filtered := map[string]bool{}
+	opaque := false
+	for _, filter := range c.arrayFilters {
+		identifier, ok := arrayFilterName(filter)
+		if !ok {
+			return cerr.NewBadRequestError(correlationId, "INVALID_ARRAY_FILTER",
+				"Array filter must have fields of a single identifier")
+		}
+		// Filters with top level logical operators can't be checked
+		if identifier == "" {
+			opaque = true
+			continue
+		}
+		if !identifiers[identifier] {
+			return cerr.NewBadRequestError(correlationId, "INVALID_ARRAY_FILTER",
+				"Array filter identifier "+identifier+" is not used in the update").
+				WithDetails("identifier", identifier)
+		}
+		filtered[identifier] = true
+	}
+	for identifier := range identifiers {
+		if !filtered[identifier] && !opaque {
+			return cerr.NewBadRequestError(correlationId, "INVALID_ARRAY_FILTER",
+				"No array filter for identifier "+identifier).
+				WithDetails("identifier", identifier)
+		}
+	}
+
+	return nil
+}
+
+func eachValue(values []any) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return bson.M{"$each": values}
+}
+
+func validateUpdatePath(correlationId string, path string, identifiers map[string]bool) error {
+	if path == "" {
+		return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE", "Update field path is empty")
+	}
+	for i, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update field path "+path+" has an empty segment").
+				WithDetails("path", path)
+		}
+		if !strings.HasPrefix(segment, "$") {
+			continue
+		}
+		if i == 0 {
+			return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update field path "+path+" can't start with an operator").
+				WithDetails("path", path)
+		}
+		if segment == "$" {
+			continue
+		}
+		match := arrayFilterIdentifier.FindStringSubmatch(segment)
+		if match == nil {
+			return cerr.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update field path "+path+" has invalid positional operator "+segment).
+				WithDetails("path", path)
+		}
+		if match[1] != "" {
+			identifiers[match[1]] = true
+		}
+	}
+	return nil
+}
+
+func isConflictingPath(path1 string, path2 string) bool {
+	return path1 == path2 ||
+		strings.HasPrefix(path1, path2+".") ||
+		strings.HasPrefix(path2, path1+".")
+}
+
+func arrayFilterName(filter any) (string, bool) {
+	keys := make([]string, 0)
+	switch v := filter.(type) {
+	case bson.M:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case map[string]any:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case bson.D:
+		for _, e := range v {
+			keys = append(keys, e.Key)
+		}
+	default:
+		return "", true
+	}
+
+	name := ""
+	for _, key := range keys {
+		if strings.HasPrefix(key, "$") {
+			return "", true
+		}
+		identifier := strings.SplitN(key, ".", 2)[0]
+		if name != "" && identifier != name {
+			return "", false
+		}
+		name = identifier
+	}
+	return name, name != ""
+}
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
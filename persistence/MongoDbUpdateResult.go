@@ -0,0 +1,9 @@
+package persistence
+
+// MongoDbUpdateResult contains counts of documents affected by update operations.
+type MongoDbUpdateResult struct {
+	// The number of documents matched by the filter.
+	MatchedCount int64 `json:"matched_count"`
+	// The number of documents modified by the update.
+	ModifiedCount int64 `json:"modified_count"`
+}
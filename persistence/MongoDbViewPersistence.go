@@ -0,0 +1,292 @@
+package persistence
+
+import (
+	"context"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDbViewPersistence abstract read-only persistence component that reads data from a MongoDB view.
+//
+// The view is a projection of a source collection or view computed by an aggregation pipeline.
+// The pipeline shall be defined in DefineSchema with DefineView. On opening the view is created
+// when it doesn't exist, or its source and pipeline are updated when it does.
+//
+// Read methods like GetPageByFilter, GetListByFilter or GetCountByFilter can be used out of the box.
+// Write methods are rejected with READ_ONLY error, the data shall be changed in the source collection.
+// Tenancy is supported only in discriminator mode, and the pipeline shall keep the tenant field.
+//
+//	Configuration parameters:
+//		- collection:                  (optional) MongoDB view name
+//		- view_on:                     (optional) name of the source collection or view
+//		- connection(s):
+//			- discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+//			- host:                      host name or IP address
+//			- port:                      port number (default: 27017)
+//			- database:                  database name
+//			- uri:                       resource URI or connection string with all parameters in it
+//		- credential(s):
+//			- store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+//			- username:                  (optional) user name
+//			- password:                  (optional) user password
+//		- options:
+//			- max_page_size:             (optional) maximum page size (default: 100)
+//			- decode_error_policy:       (optional) handling of undecodable documents: skip, collect or fail (default: skip)
+//		- tenancy:
+//			- mode:                      (optional) separation of tenants: none or discriminator (default: none)
+//			- field:                     (optional) tenant field in discriminator mode (default: tenant_id)
+//
+//	References:
+//		- *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+//		- *:discovery:*:*:1.0        (optional) IDiscovery services
+//		- *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+//
+// Example:
+//	type MyViewPersistence struct {
+//		*persistence.MongoDbViewPersistence[MyData]
+//	}
+//
+//	func NewMyViewPersistence() *MyViewPersistence {
+//		c := &MyViewPersistence{}
+//		c.MongoDbViewPersistence = persistence.InheritMongoDbViewPersistence[MyData](c, "active_data", "my_data")
+//		return c
+//	}
+//
+//	func (c *MyViewPersistence) DefineSchema() {
+//		c.DefineView(bson.A{
+//			bson.M{"$match": bson.M{"active": true}},
+//			bson.M{"$project": bson.M{"name": 1}},
+//		}, nil)
+//	}
+//
+//	func (c *MyViewPersistence) GetListByName(ctx context.Context, correlationId string, name string) ([]MyData, error) {
+//		return c.MongoDbViewPersistence.GetListByFilter(ctx, correlationId, bson.M{"name": name}, nil, nil)
+//	}
+type MongoDbViewPersistence[T any] struct {
+	*MongoDbPersistence[T]
+
+	pipeline  any
+	collation *mongoopt.Collation
+
+	// The name of the source collection or view.
+	ViewOn string
+}
+
+// InheritMongoDbViewPersistence creates a new instance of the view persistence component.
+//
+//	Parameters:
+//		- overrides IMongoDbPersistenceOverrides overrided mongodb persistence
+//		- view string a view name.
+//		- viewOn string a name of the source collection or view.
+//	Returns: *MongoDbViewPersistence[T] new created MongoDbViewPersistence component
+func InheritMongoDbViewPersistence[T any](overrides IMongoDbPersistenceOverrides[T], view string, viewOn string) *MongoDbViewPersistence[T] {
+	c := MongoDbViewPersistence[T]{
+		MongoDbPersistence: InheritMongoDbPersistence(overrides, view),
+		ViewOn:             viewOn,
+	}
+	return &c
+}
+
+// Configure is configures component by passing configuration parameters.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- config  *cconf.ConfigParams configuration parameters to be set.
+func (c *MongoDbViewPersistence[T]) Configure(ctx context.Context, config *cconf.ConfigParams) {
+	c.MongoDbPersistence.Configure(ctx, config)
+	c.ViewOn = config.GetAsStringWithDefault("view_on", c.ViewOn)
+}
+
+// DefineView sets the aggregation pipeline that computes the view from the source collection.
+// This method shall be called from DefineSchema.
+//
+//	Parameters:
+//		- pipeline any aggregation pipeline: mongo.Pipeline, bson.A or []bson.M.
+//		- collation *mongoopt.Collation (optional) default collation of the view.
+//			It is applied only when the view is created.
+func (c *MongoDbViewPersistence[T]) DefineView(pipeline any, collation *mongoopt.Collation) {
+	c.pipeline = pipeline
+	c.collation = collation
+}
+
+// EnsureIndex is not supported by views, they use indexes of the source collection.
+// The call is ignored with a warning.
+//
+//	Parameters:
+//		- keys any index keys (fields)
+//		- options *mongoopt.IndexOptions index options
+func (c *MongoDbViewPersistence[T]) EnsureIndex(keys any, options *mongoopt.IndexOptions) {
+	c.Logger.Warn(context.Background(), "", "Index on view %s is ignored, define it on %s", c.CollectionName, c.ViewOn)
+}
+
+// EnsureCollection is not supported by views, the view is created with DefineView.
+// The call is ignored with a warning.
+//
+//	Parameters:
+//		- options *mongoopt.CreateCollectionOptions collection options
+func (c *MongoDbViewPersistence[T]) EnsureCollection(options *mongoopt.CreateCollectionOptions) {
+	c.Logger.Warn(context.Background(), "", "Collection options of view %s are ignored", c.CollectionName)
+}
+
+// Open is opens the component and creates or updates the view.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to trace execution through call chain.
+//	Returns: error or nil when no errors occured.
+func (c *MongoDbViewPersistence[T]) Open(ctx context.Context, correlationId string) error {
+	if c.opened {
+		return nil
+	}
+	if c.separatesTenants() {
+		return cerr.NewConfigError(correlationId, "UNSUPPORTED_TENANCY",
+			"View "+c.CollectionName+" doesn't support tenancy mode "+string(c.tenancyMode)).
+			WithDetails("mode", c.tenancyMode)
+	}
+	if c.configCollectionOptions != nil {
+		return cerr.NewConfigError(correlationId, "INVALID_COLLECTION_OPTIONS",
+			"View "+c.CollectionName+" can't be created with collection options")
+	}
+	if c.ViewOn == "" {
+		return cerr.NewConfigError(correlationId, "NO_VIEW_SOURCE", "Source of view "+c.CollectionName+" is not set")
+	}
+
+	if err := c.MongoDbPersistence.Open(ctx, correlationId); err != nil {
+		return err
+	}
+	if err := c.ensureView(ctx, correlationId); err != nil {
+		_ = c.MongoDbPersistence.Close(ctx, correlationId)
+		return err
+	}
+	return nil
+}
+
+// ensureView creates the view when it doesn't exist or updates its source and pipeline.
+func (c *MongoDbViewPersistence[T]) ensureView(ctx context.Context, correlationId string) error {
+	pipeline := c.pipeline
+	if pipeline == nil {
+		pipeline = bson.A{}
+	}
+
+	specs, err := c.Db.ListCollectionSpecifications(ctx, bson.M{"name": c.CollectionName})
+	if err != nil {
+		return cerr.NewConnectionError(correlationId, "CREATE_VIEW_FAILED", "Failed to read options of view "+c.CollectionName).
+			WithCause(err)
+	}
+
+	if len(specs) == 0 {
+		options := mongoopt.CreateView()
+		if c.collation != nil {
+			options.SetCollation(c.collation)
+		}
+		if err = c.Db.CreateView(ctx, c.CollectionName, c.ViewOn, pipeline, options); err != nil {
+			return cerr.NewConnectionError(correlationId, "CREATE_VIEW_FAILED", "Failed to create view "+c.CollectionName).
+				WithCause(err)
+		}
+		c.Logger.Debug(ctx, correlationId, "Created view %s on %s", c.CollectionName, c.ViewOn)
+		return nil
+	}
+
+	if specs[0].Type != "view" {
+		return collectionMismatchError(correlationId, c.CollectionName, "type", "view", specs[0].Type)
+	}
+	command := bson.D{
+		{Key: "collMod", Value: c.CollectionName},
+		{Key: "viewOn", Value: c.ViewOn},
+		{Key: "pipeline", Value: pipeline},
+	}
+	if err = c.Db.RunCommand(ctx, command).Err(); err != nil {
+		return cerr.NewConnectionError(correlationId, "CREATE_VIEW_FAILED", "Failed to update view "+c.CollectionName).
+			WithCause(err)
+	}
+	c.Logger.Debug(ctx, correlationId, "Updated view %s on %s", c.CollectionName, c.ViewOn)
+	return nil
+}
+
+// Clear is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId  string (optional) transaction id to trace execution through call chain.
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) Clear(ctx context.Context, correlationId string) error {
+	return c.readOnlyError(correlationId, "Clear")
+}
+
+// Create is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- item T an item to be created.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, views are read-only
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) Create(ctx context.Context, correlationId string, item T,
+	queryOptions ...MongoDbQueryOption) (result T, err error) {
+	return result, c.readOnlyError(correlationId, "Create")
+}
+
+// DeleteByFilter is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, views are read-only
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) DeleteByFilter(ctx context.Context, correlationId string, filter any,
+	queryOptions ...MongoDbQueryOption) error {
+	return c.readOnlyError(correlationId, "DeleteByFilter")
+}
+
+// UpdateByFilter is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, views are read-only
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) UpdateByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (result MongoDbUpdateResult, err error) {
+	return result, c.readOnlyError(correlationId, "UpdateByFilter")
+}
+
+// UpdateOneByFilter is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, views are read-only
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) UpdateOneByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+	return item, c.readOnlyError(correlationId, "UpdateOneByFilter")
+}
+
+// UpsertByFilter is not supported by views.
+//
+//	Parameters:
+//		- ctx context.Context
+//		- correlationId string (optional) transaction id to trace execution through call chain.
+//		- filter any a filter BSON object.
+//		- update any an update.
+//		- queryOptions ...MongoDbQueryOption (optional) ignored, views are read-only
+//	Returns: READ_ONLY error.
+func (c *MongoDbViewPersistence[T]) UpsertByFilter(ctx context.Context, correlationId string,
+	filter any, update any, queryOptions ...MongoDbQueryOption) (item T, err error) {
+	return item, c.readOnlyError(correlationId, "UpsertByFilter")
+}
+
+func (c *MongoDbViewPersistence[T]) readOnlyError(correlationId string, operation string) error {
+	return cerr.NewUnsupportedError(correlationId, "READ_ONLY",
+		"View "+c.CollectionName+" is read-only, "+operation+" shall be applied to "+c.ViewOn).
+		WithDetails("view", c.CollectionName).
+		WithDetails("operation", operation)
+}
@@ -0,0 +1,53 @@
+package persistence
+
+import "context"
+
+// TenancyMode defines how data of different tenants is separated in MongoDB.
+// The tenant is taken from the context of every call, see WithTenantId.
+//
+//	Configuration values of tenancy.mode:
+//		- none:          all tenants share one collection without any separation (default)
+//		- discriminator: tenants share one collection, documents are marked and filtered by a tenant field
+//		- collection:    each tenant has a separate collection in the same database
+//		- database:      each tenant has a separate database with the collection
+type TenancyMode string
+
+const (
+	// TenancyNone disables tenant separation.
+	TenancyNone TenancyMode = "none"
+	// TenancyDiscriminator keeps tenants in one collection and injects
+	// the tenant field into every filter and stored document.
+	TenancyDiscriminator TenancyMode = "discriminator"
+	// TenancyCollection keeps each tenant in a separate collection
+	// named by the tenancy.name_template.
+	TenancyCollection TenancyMode = "collection"
+	// TenancyDatabase keeps each tenant in a separate database
+	// named by the tenancy.name_template.
+	TenancyDatabase TenancyMode = "database"
+)
+
+type tenantIdKey struct{}
+
+// WithTenantId returns a copy of the context that carries the tenant id.
+// Persistence components with enabled tenancy route all operations called with this context to the tenant.
+//
+//	Parameters:
+//		- ctx context.Context a parent context.
+//		- tenantId string an id of the tenant.
+//	Returns: context.Context the context with the tenant id.
+func WithTenantId(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantIdKey{}, tenantId)
+}
+
+// GetTenantId gets the tenant id carried by the context.
+//
+//	Parameters:
+//		- ctx context.Context a context.
+//	Returns: string the tenant id or empty string if the context has no tenant.
+func GetTenantId(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenantId, _ := ctx.Value(tenantIdKey{}).(string)
+	return tenantId
+}
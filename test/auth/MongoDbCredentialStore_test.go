@@ -0,0 +1,79 @@
+package test_auth
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cauth "github.com/pip-services3-gox/pip-services3-components-gox/auth"
+	mauth "github.com/pip-services3-gox/pip-services3-mongodb-gox/auth"
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoDbCredentialStore(t *testing.T) {
+	var store *mauth.MongoDbCredentialStore
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_credentials",
+		"options.encryption_key", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")),
+	)
+
+	store = mauth.NewMongoDbCredentialStore()
+	store.Configure(context.Background(), dbConfig)
+
+	err := store.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened credential store", err)
+		return
+	}
+	defer store.Close(context.Background(), "")
+
+	err = store.Store(context.Background(), "", "key1",
+		cauth.NewCredentialParamsFromTuples("username", "jdoe", "password", "pass123"))
+	assert.Nil(t, err)
+
+	credential, err := store.Lookup(context.Background(), "", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "jdoe", credential.Username())
+	assert.Equal(t, "pass123", credential.Password())
+
+	// Password is encrypted in the collection
+	var doc bson.M
+	err = store.Collection.FindOne(context.Background(), bson.M{"_id": "key1"}).Decode(&doc)
+	assert.Nil(t, err)
+	params := doc["params"].(bson.M)
+	assert.Equal(t, "jdoe", params["username"])
+	assert.True(t, conn.IsEncryptedSecret(params["password"].(string)))
+
+	// Remove credential
+	err = store.Store(context.Background(), "", "key1", nil)
+	assert.Nil(t, err)
+
+	_, err = store.Lookup(context.Background(), "", "key1")
+	assert.NotNil(t, err)
+}
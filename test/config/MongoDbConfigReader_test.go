@@ -0,0 +1,79 @@
+package test_config
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	mcfg "github.com/pip-services3-gox/pip-services3-mongodb-gox/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoDbConfigReader(t *testing.T) {
+	var reader *mcfg.MongoDbConfigReader
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_configs",
+		"parameters.param2", "XYZ",
+	)
+
+	reader = mcfg.NewMongoDbConfigReader("test_config")
+	reader.Configure(context.Background(), dbConfig)
+
+	err := reader.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened config reader", err)
+		return
+	}
+	defer reader.Close(context.Background(), "")
+
+	_, err = reader.Collection.ReplaceOne(context.Background(),
+		bson.M{"_id": "test_config"},
+		bson.M{
+			"_id":    "test_config",
+			"field1": bson.M{"field11": 123, "field12": "ABC"},
+			"field2": "{{param1}}",
+			"field3": "{{param2}}",
+		},
+		mongoopt.Replace().SetUpsert(true),
+	)
+	assert.Nil(t, err)
+
+	config, err := reader.ReadConfig(context.Background(), "",
+		cconf.NewConfigParamsFromTuples("param1", "Param1 Value"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 123, config.GetAsInteger("field1.field11"))
+	assert.Equal(t, "ABC", config.GetAsString("field1.field12"))
+	assert.Equal(t, "Param1 Value", config.GetAsString("field2"))
+	assert.Equal(t, "XYZ", config.GetAsString("field3"))
+	assert.False(t, config.Contains("_id"))
+
+	reader.Key = "unknown_config"
+	_, err = reader.ReadConfig(context.Background(), "", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,41 @@
+package test_connect
+
+import (
+	"encoding/base64"
+	"testing"
+
+	conn "github.com/pip-services3-gox/pip-services3-mongodb-gox/connect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCipher(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	cipher, err := conn.NewSecretCipherFromString(key)
+	assert.Nil(t, err)
+
+	encrypted, err := cipher.Encrypt("pass123")
+	assert.Nil(t, err)
+	assert.True(t, conn.IsEncryptedSecret(encrypted))
+	assert.NotContains(t, encrypted, "pass123")
+
+	decrypted, err := cipher.Decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, "pass123", decrypted)
+
+	// Plain values are returned as is
+	decrypted, err = cipher.Decrypt("plain")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", decrypted)
+
+	values, err := cipher.EncryptFields(map[string]string{"username": "jdoe", "password": "pass123"}, []string{"password"})
+	assert.Nil(t, err)
+	assert.Equal(t, "jdoe", values["username"])
+	assert.True(t, conn.IsEncryptedSecret(values["password"]))
+
+	values, err = cipher.DecryptFields(values)
+	assert.Nil(t, err)
+	assert.Equal(t, "pass123", values["password"])
+
+	_, err = conn.NewSecretCipherFromString(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,84 @@
+package test_count
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	ccount "github.com/pip-services3-gox/pip-services3-mongodb-gox/count"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMongoDbCounters(t *testing.T) {
+	var counters *ccount.MongoDbCounters
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_counters",
+		"source", "test",
+	)
+
+	counters = ccount.NewMongoDbCounters()
+	counters.Configure(context.Background(), dbConfig)
+
+	err := counters.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened counters", err)
+		return
+	}
+	defer counters.Close(context.Background(), "")
+
+	_, err = counters.Collection.DeleteMany(context.Background(), map[string]any{})
+	assert.Nil(t, err)
+
+	start := time.Now().Add(-time.Minute)
+
+	counters.Increment(context.Background(), "test.calls", 2)
+	counters.Stats(context.Background(), "test.stats", 5)
+	err = counters.Dump(context.Background())
+	assert.Nil(t, err)
+
+	// Other counter is updated, so unchanged test.calls is dumped again
+	counters.Stats(context.Background(), "test.stats", 7)
+	err = counters.Dump(context.Background())
+	assert.Nil(t, err)
+
+	counters.Increment(context.Background(), "test.calls", 3)
+	err = counters.Dump(context.Background())
+	assert.Nil(t, err)
+
+	// Counts after a reset are summed in full, even when they exceed the saved ones
+	counters.ClearAll(context.Background())
+	counters.Increment(context.Background(), "test.calls", 7)
+	err = counters.Dump(context.Background())
+	assert.Nil(t, err)
+
+	values, err := counters.GetAggregatedValues(context.Background(), "",
+		"test.calls", start, time.Now().Add(time.Minute), time.Hour*24)
+	assert.Nil(t, err)
+	assert.Len(t, values, 1)
+	// Dumps store cumulative values, but only increments since previous dumps are summed: 2 + 0 + 3 + 7
+	assert.Equal(t, int64(12), values[0].Count)
+}
@@ -0,0 +1,189 @@
+package test_migration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/migration"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMongoDbMigratorDownCount(t *testing.T) {
+	migrator := migration.NewMongoDbMigrator()
+
+	_, err := migrator.MigrateDown(context.Background(), "", -1)
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_COUNT", err.(*cerr.ApplicationError).Code)
+
+	// Nothing is reverted, so the migrator doesn't have to be opened
+	done, err := migrator.MigrateDown(context.Background(), "", 0)
+	assert.Nil(t, err)
+	assert.Len(t, done, 0)
+}
+
+func TestMongoDbMigrator(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_migrations",
+	)
+
+	applied := make([]int64, 0)
+	step := func(version int64, delta int) migration.MongoDbMigrationFunc {
+		return func(ctx context.Context, db *mongo.Database) error {
+			applied = append(applied, version*int64(delta))
+			_, err := db.Collection("test_migrated").UpdateOne(ctx, bson.M{"_id": "state"},
+				bson.M{"$inc": bson.M{"version": delta}}, nil)
+			return err
+		}
+	}
+
+	migrator := migration.NewMongoDbMigrator()
+	migrator.Configure(context.Background(), dbConfig)
+	migrator.Register(
+		migration.MongoDbMigration{Version: 2, Description: "Second", Up: step(2, 1), Down: step(2, -1)},
+		migration.MongoDbMigration{Version: 1, Description: "First", Up: step(1, 1), Down: step(1, -1)},
+		migration.MongoDbMigration{Version: 3, Description: "Third", Up: step(3, 1)},
+	)
+
+	err := migrator.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened migrator", err)
+		return
+	}
+	defer migrator.Close(context.Background(), "")
+
+	_, err = migrator.Collection.DeleteMany(context.Background(), bson.M{})
+	assert.Nil(t, err)
+
+	// Apply migrations in order
+	done, err := migrator.MigrateTo(context.Background(), "", 2)
+	assert.Nil(t, err)
+	assert.Len(t, done, 2)
+	assert.Equal(t, []int64{1, 2}, applied)
+
+	done, err = migrator.MigrateUp(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, done, 1)
+	assert.Equal(t, []int64{1, 2, 3}, applied)
+
+	status, err := migrator.GetStatus(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, status, 3)
+	for _, s := range status {
+		assert.True(t, s.Applied)
+	}
+
+	// Nothing to apply twice
+	done, err = migrator.MigrateUp(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, done, 0)
+
+	// Irreversible migration can't be reverted
+	_, err = migrator.MigrateDown(context.Background(), "", 1)
+	assert.NotNil(t, err)
+
+	// Revert to the first migration
+	_, err = migrator.Collection.DeleteOne(context.Background(), bson.M{"_id": int64(3)})
+	assert.Nil(t, err)
+	done, err = migrator.MigrateDown(context.Background(), "", 1)
+	assert.Nil(t, err)
+	assert.Len(t, done, 1)
+	assert.Equal(t, int64(-2), applied[len(applied)-1])
+
+	// Failed migration is not recorded
+	migrator.Register(migration.MongoDbMigration{Version: 4, Description: "Broken",
+		Up: func(ctx context.Context, db *mongo.Database) error { return errors.New("broken") }})
+	_, err = migrator.MigrateUp(context.Background(), "")
+	assert.NotNil(t, err)
+
+	status, err = migrator.GetStatus(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, status, 4)
+	assert.False(t, status[3].Applied)
+}
+
+func TestMongoDbMigratorDryRunAndLock(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_migrations_lock",
+		"options.dry_run", true,
+		"options.lock_wait_timeout", 0,
+	)
+
+	runs := 0
+	migrator := migration.NewMongoDbMigrator()
+	migrator.Configure(context.Background(), dbConfig)
+	migrator.Register(migration.MongoDbMigration{Version: 1, Description: "First",
+		Up: func(ctx context.Context, db *mongo.Database) error { runs++; return nil }})
+
+	err := migrator.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened migrator", err)
+		return
+	}
+	defer migrator.Close(context.Background(), "")
+
+	_, err = migrator.Collection.DeleteMany(context.Background(), bson.M{})
+	assert.Nil(t, err)
+
+	// Dry run only plans migrations
+	done, err := migrator.MigrateUp(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, done, 1)
+	assert.Equal(t, 0, runs)
+
+	// Lock held by another instance stops migrating
+	_, err = migrator.Collection.InsertOne(context.Background(), bson.M{
+		"_id": "lock", "owner": "other", "locked_until": time.Now().Add(time.Minute),
+	})
+	assert.Nil(t, err)
+	_, err = migrator.MigrateUp(context.Background(), "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,139 @@
+package test_outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testPublisher struct {
+	lock   sync.Mutex
+	events []outbox.OutboxEvent
+	fail   bool
+}
+
+func (c *testPublisher) Publish(ctx context.Context, correlationId string, event outbox.OutboxEvent) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.fail {
+		return errors.New("publish failed")
+	}
+	c.events = append(c.events, event)
+	return nil
+}
+
+func TestMongoDbOutboxRelay(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "test_outbox",
+		"options.interval", 60000,
+		"options.max_attempts", 2,
+		"options.retry_delay", 0,
+	)
+
+	publisher := &testPublisher{}
+	relay := outbox.NewMongoDbOutboxRelay()
+	relay.Configure(context.Background(), dbConfig)
+	relay.SetPublisher(publisher)
+
+	err := relay.Open(context.Background(), "")
+	if err != nil {
+		t.Error("Error opened outbox relay", err)
+		return
+	}
+	defer relay.Close(context.Background(), "")
+
+	_, err = relay.Collection.DeleteMany(context.Background(), bson.M{})
+	assert.Nil(t, err)
+
+	writer := outbox.NewMongoDbOutbox(relay.Collection, "dummies")
+
+	// Dispatch enqueued events
+	err = writer.Enqueue(context.Background(), "123",
+		outbox.NewOutboxEvent("created", "1", map[string]any{"key": "Key 1"}),
+		outbox.NewOutboxEvent("updated", "1", map[string]any{"key": "Key 2"}),
+	)
+	assert.Nil(t, err)
+
+	count, err := relay.Dispatch(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Len(t, publisher.events, 2)
+	assert.Equal(t, "dummies", publisher.events[0].Source)
+	assert.Equal(t, "123", publisher.events[0].CorrelationId)
+
+	dispatched, err := relay.Collection.CountDocuments(context.Background(), bson.M{"status": outbox.OutboxEventDispatched})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), dispatched)
+
+	// Failed events are retried and marked as failed after max attempts
+	publisher.fail = true
+	err = writer.Enqueue(context.Background(), "123", outbox.NewOutboxEvent("deleted", "1", nil))
+	assert.Nil(t, err)
+
+	count, err = relay.Dispatch(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = relay.Dispatch(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	failed, err := relay.Collection.CountDocuments(context.Background(), bson.M{"status": outbox.OutboxEventFailed})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), failed)
+
+	// Events with expired claims are counted as attempted and fail after max attempts
+	publisher.fail = false
+	_, err = relay.Collection.DeleteMany(context.Background(), bson.M{})
+	assert.Nil(t, err)
+
+	expired := outbox.NewOutboxEvent("expired", "2", nil)
+	expired.Id = "expired"
+	expired.Source = "dummies"
+	expired.Status = outbox.OutboxEventProcessing
+	expired.Attempts = 2
+	expired.CreateTime = time.Now().UTC()
+	expired.LockTime = time.Now().UTC().Add(-time.Minute)
+	_, err = relay.Collection.InsertOne(context.Background(), expired)
+	assert.Nil(t, err)
+
+	count, err = relay.Dispatch(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	var stored outbox.OutboxEvent
+	err = relay.Collection.FindOne(context.Background(), bson.M{"_id": "expired"}).Decode(&stored)
+	assert.Nil(t, err)
+	assert.Equal(t, outbox.OutboxEventFailed, stored.Status)
+	assert.Equal(t, 2, stored.Attempts)
+}
@@ -0,0 +1,167 @@
+package test_persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAuditTrailActor(t *testing.T) {
+	assert.Equal(t, "", persist.GetActor(context.Background()))
+
+	ctx := persist.WithActor(context.Background(), "admin")
+	assert.Equal(t, "admin", persist.GetActor(ctx))
+}
+
+func TestAuditTrailDisabled(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewEmptyConfigParams())
+
+	_, err := persistence.GetHistoryById(context.Background(), "", "1", *cdata.NewEmptyPagingParams())
+	assert.NotNil(t, err)
+	assert.Equal(t, "AUDIT_DISABLED", err.(*cerr.ApplicationError).Code)
+
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples("options.audit", true))
+	_, _, err = persistence.GetOneByIdAsOf(context.Background(), "", "1", time.Now())
+	assert.NotNil(t, err)
+	assert.Equal(t, "NOT_OPENED", err.(*cerr.ApplicationError).Code)
+}
+
+func TestAuditModeConfig(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"options.audit", true,
+		"options.audit_mode", "unknown",
+	))
+
+	err := persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_AUDIT_MODE", err.(*cerr.ApplicationError).Code)
+}
+
+func TestAuditTrail(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	for _, mode := range []string{"snapshot", "diff"} {
+		t.Run(mode, func(t *testing.T) {
+			dbConfig := cconf.NewConfigParamsFromTuples(
+				"connection.uri", mongoUri,
+				"connection.host", mongoHost,
+				"connection.port", mongoPort,
+				"connection.database", mongoDatabase,
+				"collection", "dummies_audit_"+mode,
+				"options.audit", true,
+				"options.audit_mode", mode,
+			)
+
+			persistence := NewDummyMongoDbPersistence()
+			persistence.Configure(context.Background(), dbConfig)
+
+			opnErr := persistence.Open(context.Background(), "")
+			if opnErr != nil {
+				t.Error("Error opened persistence", opnErr)
+				return
+			}
+			defer persistence.Close(context.Background(), "")
+
+			opnErr = persistence.Clear(context.Background(), "")
+			if opnErr != nil {
+				t.Error("Error cleaned persistence", opnErr.Error())
+				return
+			}
+			_, err := persistence.Db.Collection("dummies_audit_" + mode + "_history").DeleteMany(context.Background(), bson.M{})
+			assert.Nil(t, err)
+
+			ctx := persist.WithActor(context.Background(), "admin")
+			_, err = persistence.Create(ctx, "123", Dummy{Id: "1", Key: "Key 1", Content: "Content 1"})
+			assert.Nil(t, err)
+			time.Sleep(10 * time.Millisecond)
+			created := time.Now()
+			time.Sleep(10 * time.Millisecond)
+
+			_, err = persistence.UpdatePartially(ctx, "123", "1", *cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+			assert.Nil(t, err)
+			_, err = persistence.UpdateByFilter(ctx, "123", bson.M{"key": "Key 1"}, bson.M{"$set": bson.M{"key": "Key 2"}})
+			assert.Nil(t, err)
+			// Updates that change nothing are not recorded
+			_, err = persistence.UpdatePartially(ctx, "123", "1", *cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+			assert.Nil(t, err)
+			time.Sleep(10 * time.Millisecond)
+			updated := time.Now()
+			time.Sleep(10 * time.Millisecond)
+
+			_, err = persistence.DeleteById(ctx, "123", "1")
+			assert.Nil(t, err)
+
+			// History is read from the latest change
+			page, err := persistence.GetHistoryById(context.Background(), "", "1", *cdata.NewPagingParams(0, 10, true))
+			assert.Nil(t, err)
+			assert.Equal(t, 4, page.Total)
+			if assert.Len(t, page.Data, 4) {
+				assert.Equal(t, persist.AuditDelete, page.Data[0].Operation)
+				assert.Equal(t, persist.AuditUpdate, page.Data[1].Operation)
+				assert.Equal(t, persist.AuditCreate, page.Data[3].Operation)
+				assert.Equal(t, "admin", page.Data[3].Actor)
+				assert.Equal(t, "123", page.Data[3].CorrelationId)
+			}
+
+			// Items are reconstructed as of a point in time
+			item, found, err := persistence.GetOneByIdAsOf(context.Background(), "", "1", created)
+			assert.Nil(t, err)
+			assert.True(t, found)
+			assert.Equal(t, Dummy{Id: "1", Key: "Key 1", Content: "Content 1"}, item)
+
+			item, found, err = persistence.GetOneByIdAsOf(context.Background(), "", "1", updated)
+			assert.Nil(t, err)
+			assert.True(t, found)
+			assert.Equal(t, Dummy{Id: "1", Key: "Key 2", Content: "Content 2"}, item)
+
+			_, found, err = persistence.GetOneByIdAsOf(context.Background(), "", "1", time.Now())
+			assert.Nil(t, err)
+			assert.False(t, found)
+
+			// Changes of many items are recorded batch by batch
+			history := persistence.Db.Collection("dummies_audit_" + mode + "_history")
+			for i := 0; i < 150; i++ {
+				_, err = persistence.Create(ctx, "123", Dummy{Id: fmt.Sprintf("batch-%d", i), Key: "Batch", Content: "Content"})
+				assert.Nil(t, err)
+			}
+			result, err := persistence.UpdateByFilter(ctx, "123", bson.M{"key": "Batch"}, bson.M{"$set": bson.M{"content": "Changed"}})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(150), result.ModifiedCount)
+			count, err := history.CountDocuments(context.Background(), bson.M{"operation": persist.AuditUpdate, "document_id": bson.M{"$regex": "^batch-"}})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(150), count)
+
+			err = persistence.DeleteByFilter(ctx, "123", bson.M{"key": "Batch"})
+			assert.Nil(t, err)
+			count, err = history.CountDocuments(context.Background(), bson.M{"operation": persist.AuditDelete, "document_id": bson.M{"$regex": "^batch-"}})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(150), count)
+		})
+	}
+}
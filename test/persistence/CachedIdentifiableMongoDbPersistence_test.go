@@ -0,0 +1,169 @@
+package test_persistence
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	crefer "github.com/pip-services3-gox/pip-services3-commons-gox/refer"
+	ccache "github.com/pip-services3-gox/pip-services3-components-gox/cache"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedPersistenceReadsFromCache(t *testing.T) {
+	cache := ccache.NewMemoryCache[Dummy]()
+	persistence := NewDummyCachedMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewEmptyConfigParams())
+	persistence.SetReferences(context.Background(), crefer.NewReferencesFromTuples(context.Background(),
+		crefer.NewDescriptor("pip-services", "cache", "memory", "default", "1.0"), cache,
+	))
+
+	dummy := Dummy{Id: "1", Key: "Key 1", Content: "Cached"}
+	_, err := cache.Store(context.Background(), "", "dummies_cached:1", dummy, 60000)
+	assert.Nil(t, err)
+
+	// Cached items are read without the database
+	item, err := persistence.GetOneById(context.Background(), "", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, dummy, item)
+
+	items, err := persistence.GetListByIds(context.Background(), "", []string{"1", "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Dummy{dummy}, items)
+
+	err = persistence.Invalidate(context.Background(), "", "1")
+	assert.Nil(t, err)
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:1"))
+}
+
+func TestCachedPersistenceTenantKeys(t *testing.T) {
+	cache := ccache.NewMemoryCache[Dummy]()
+	persistence := NewDummyCachedMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"tenancy.mode", "discriminator",
+		"cache.key_prefix", "dummies",
+	))
+	persistence.SetCache(cache)
+
+	dummy := Dummy{Id: "1", Key: "Key 1", Content: "Tenant 1"}
+	_, err := cache.Store(context.Background(), "", "dummies:tenant1:1", dummy, 60000)
+	assert.Nil(t, err)
+
+	item, err := persistence.GetOneById(persist.WithTenantId(context.Background(), "tenant1"), "", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, dummy, item)
+
+	// Watching changes is not supported for tenants
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples("cache.watch", true))
+	err = persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+}
+
+func TestCachedIdentifiableMongoDbPersistence(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+	)
+
+	cache := ccache.NewMemoryCache[Dummy]()
+	persistence := NewDummyCachedMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+	persistence.SetCache(cache)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	// Created items are written to the cache
+	_, err := persistence.Create(context.Background(), "", Dummy{Id: "1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	assert.True(t, cache.Contains(context.Background(), "", "dummies_cached:1"))
+
+	_, err = persistence.Create(context.Background(), "", Dummy{Id: "2", Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+	err = persistence.Invalidate(context.Background(), "", "2")
+	assert.Nil(t, err)
+
+	// Missing items are read from the database and cached
+	items, err := persistence.GetListByIds(context.Background(), "", []string{"1", "2", "3"})
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.True(t, cache.Contains(context.Background(), "", "dummies_cached:2"))
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:3"))
+
+	// Updated items are removed from the cache
+	_, err = persistence.UpdatePartially(context.Background(), "", "1", *cdata.NewAnyValueMapFromTuples("content", "Updated"))
+	assert.Nil(t, err)
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:1"))
+
+	item, err := persistence.GetOneById(context.Background(), "", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Updated", item.Content)
+	assert.True(t, cache.Contains(context.Background(), "", "dummies_cached:1"))
+
+	// Deleted items are removed from the cache
+	err = persistence.DeleteByIds(context.Background(), "", []string{"1", "2"})
+	assert.Nil(t, err)
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:1"))
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:2"))
+
+	item, err = persistence.GetOneById(context.Background(), "", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, Dummy{}, item)
+
+	// Items created in aborted transactions are not cached
+	failure := errors.New("failure")
+	err = persistence.ExecuteInTransaction(context.Background(), "", func(ctx context.Context) error {
+		if _, err := persistence.Create(ctx, "", Dummy{Id: "3", Key: "Key 3", Content: "Content 3"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:3"))
+
+	// Items cached by other readers before commit are removed after it
+	_, err = persistence.Create(context.Background(), "", Dummy{Id: "4", Key: "Key 4", Content: "Content 4"})
+	assert.Nil(t, err)
+	err = persistence.ExecuteInTransaction(context.Background(), "", func(ctx context.Context) error {
+		if _, err := persistence.UpdatePartially(ctx, "", "4", *cdata.NewAnyValueMapFromTuples("content", "Updated")); err != nil {
+			return err
+		}
+		_, err := persistence.GetOneById(context.Background(), "", "4")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.False(t, cache.Contains(context.Background(), "", "dummies_cached:4"))
+}
@@ -0,0 +1,109 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCollectionOptionsConfig(t *testing.T) {
+	for _, config := range []*cconf.ConfigParams{
+		cconf.NewConfigParamsFromTuples("collection_options.capped", true),
+		cconf.NewConfigParamsFromTuples("collection_options.max", 100),
+		cconf.NewConfigParamsFromTuples("collection_options.expire_after_seconds", 3600),
+		cconf.NewConfigParamsFromTuples(
+			"collection_options.time_field", "time",
+			"collection_options.clustered", true,
+		),
+	} {
+		persistence := NewDummyMongoDbPersistence()
+		persistence.Configure(context.Background(), config)
+
+		err := persistence.Open(context.Background(), "")
+		assert.NotNil(t, err)
+		assert.Equal(t, "INVALID_COLLECTION_OPTIONS", err.(*cerr.ApplicationError).Code)
+	}
+}
+
+func TestCollectionOptions(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_capped",
+		"collection_options.capped", true,
+		"collection_options.size", 4096,
+		"collection_options.max", 2,
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+	defer persistence.Collection.Drop(context.Background())
+
+	specs, err := persistence.Db.ListCollectionSpecifications(context.Background(), bson.M{"name": "dummies_capped"})
+	assert.Nil(t, err)
+	assert.Len(t, specs, 1)
+	capped, err := specs[0].Options.LookupErr("capped")
+	assert.Nil(t, err)
+	assert.True(t, capped.Boolean())
+
+	// Capped collection keeps only the last documents
+	for _, dummy := range []Dummy{{Id: "1", Key: "Key 1"}, {Id: "2", Key: "Key 2"}, {Id: "3", Key: "Key 3"}} {
+		_, err = persistence.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+	count, err := persistence.Collection.CountDocuments(context.Background(), bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// Cleared collection keeps its options, so it can be opened again
+	err = persistence.Clear(context.Background(), "")
+	assert.Nil(t, err)
+	_, err = persistence.Create(context.Background(), "", Dummy{Id: "4", Key: "Key 4"})
+	assert.Nil(t, err)
+	reopened := NewDummyMongoDbPersistence()
+	reopened.Configure(context.Background(), dbConfig)
+	err = reopened.Open(context.Background(), "")
+	assert.Nil(t, err)
+	reopened.Close(context.Background(), "")
+
+	// Options of the existing collection are verified
+	other := NewDummyMongoDbPersistence()
+	other.Configure(context.Background(), dbConfig.Override(cconf.NewConfigParamsFromTuples(
+		"collection_options.max", 5,
+	)))
+	err = other.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "COLLECTION_MISMATCH", err.(*cerr.ApplicationError).Code)
+	other.Close(context.Background(), "")
+}
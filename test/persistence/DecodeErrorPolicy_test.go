@@ -0,0 +1,108 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecodeErrorPolicyConfig(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"options.decode_error_policy", "colect",
+	))
+
+	err := persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_DECODE_ERROR_POLICY", err.(*cerr.ApplicationError).Code)
+}
+
+func TestDecodeErrorPolicy(t *testing.T) {
+	var persistence *DummyMongoDbPersistence
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_decode",
+		"options.decode_error_policy", "fail",
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+	assert.Equal(t, persist.DecodeErrorFail, persistence.DecodeErrorPolicy)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	_, err := persistence.Create(context.Background(), "", Dummy{Id: "1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	_, err = persistence.Collection.InsertOne(context.Background(), bson.M{"_id": "2", "key": "Key 2", "content": 123})
+	assert.Nil(t, err)
+
+	// Fail fast
+	_, err = persistence.GetListByFilter(context.Background(), "", bson.M{}, nil, nil)
+	assert.NotNil(t, err)
+	appErr, ok := err.(*cerr.ApplicationError)
+	assert.True(t, ok)
+	assert.Equal(t, "DECODE_FAILED", appErr.Code)
+	assert.Equal(t, "2", appErr.Details["id"])
+	assert.Equal(t, "dummies_decode", appErr.Details["collection"])
+
+	_, err = persistence.GetOneById(context.Background(), "", "2")
+	assert.NotNil(t, err)
+
+	// Collect errors
+	persistence.DecodeErrorPolicy = persist.DecodeErrorCollect
+	page, err := persistence.GetPageByFilter(context.Background(), "", *cdata.NewEmptyFilterParams(), *cdata.NewEmptyPagingParams())
+	assert.NotNil(t, err)
+	assert.Len(t, page.Data, 1)
+	appErr, ok = err.(*cerr.ApplicationError)
+	assert.True(t, ok)
+	assert.Equal(t, []any{"2"}, appErr.Details["ids"])
+
+	// Skip and log
+	persistence.DecodeErrorPolicy = persist.DecodeErrorSkip
+	items, err := persistence.GetListByFilter(context.Background(), "", bson.M{}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+
+	item, err := persistence.GetOneById(context.Background(), "", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, Dummy{}, item)
+}
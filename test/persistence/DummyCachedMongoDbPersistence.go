@@ -0,0 +1,15 @@
+package test_persistence
+
+import (
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+)
+
+type DummyCachedMongoDbPersistence struct {
+	*persist.CachedIdentifiableMongoDbPersistence[Dummy, string]
+}
+
+func NewDummyCachedMongoDbPersistence() *DummyCachedMongoDbPersistence {
+	c := &DummyCachedMongoDbPersistence{}
+	c.CachedIdentifiableMongoDbPersistence = persist.InheritCachedIdentifiableMongoDbPersistence[Dummy, string](c, "dummies_cached")
+	return c
+}
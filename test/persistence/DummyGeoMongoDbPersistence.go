@@ -0,0 +1,25 @@
+package test_persistence
+
+import (
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+)
+
+type DummyPlace struct {
+	Id       string           `bson:"_id" json:"id"`
+	Name     string           `bson:"name" json:"name"`
+	Location persist.GeoPoint `bson:"location" json:"location"`
+}
+
+type DummyGeoMongoDbPersistence struct {
+	*persist.IdentifiableMongoDbPersistence[DummyPlace, string]
+}
+
+func NewDummyGeoMongoDbPersistence() *DummyGeoMongoDbPersistence {
+	c := &DummyGeoMongoDbPersistence{}
+	c.IdentifiableMongoDbPersistence = persist.InheritIdentifiableMongoDbPersistence[DummyPlace, string](c, "dummies_geo")
+	return c
+}
+
+func (c *DummyGeoMongoDbPersistence) DefineSchema() {
+	c.EnsureGeoIndex("location", nil)
+}
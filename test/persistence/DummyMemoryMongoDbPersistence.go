@@ -0,0 +1,60 @@
+package test_persistence
+
+import (
+	"context"
+
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type DummyMemoryMongoDbPersistence struct {
+	*persist.IdentifiableMemoryMongoDbPersistence[Dummy, string]
+}
+
+func NewDummyMemoryMongoDbPersistence() *DummyMemoryMongoDbPersistence {
+	c := &DummyMemoryMongoDbPersistence{}
+	c.IdentifiableMemoryMongoDbPersistence = persist.InheritIdentifiableMemoryMongoDbPersistence[Dummy, string](c, "dummies")
+	return c
+}
+
+func (c *DummyMemoryMongoDbPersistence) GetPageByFilter(ctx context.Context, correlationId string,
+	filter cdata.FilterParams, paging cdata.PagingParams) (page cdata.DataPage[Dummy], err error) {
+
+	filterObj := bson.M{}
+
+	if key, ok := filter.GetAsNullableString("Key"); ok {
+		filterObj = bson.M{"key": key}
+	}
+
+	sorting := bson.M{"key": -1}
+
+	return c.IdentifiableMemoryMongoDbPersistence.GetPageByFilter(ctx, correlationId,
+		filterObj, paging,
+		sorting, nil)
+}
+
+func (c *DummyMemoryMongoDbPersistence) GetCountByFilter(ctx context.Context, correlationId string, filter cdata.FilterParams) (count int64, err error) {
+
+	filterObj := bson.M{}
+
+	if key, ok := filter.GetAsNullableString("Key"); ok {
+		filterObj = bson.M{"key": key}
+	}
+
+	return c.IdentifiableMemoryMongoDbPersistence.GetCountByFilter(ctx, correlationId, filterObj)
+}
+
+func (c *DummyMemoryMongoDbPersistence) StreamByFilter(ctx context.Context, correlationId string,
+	filter cdata.FilterParams) (stream <-chan persist.MongoDbStreamItem[Dummy], err error) {
+
+	filterObj := bson.M{}
+
+	if key, ok := filter.GetAsNullableString("Key"); ok {
+		filterObj = bson.M{"key": key}
+	}
+
+	return c.IdentifiableMemoryMongoDbPersistence.StreamByFilter(ctx, correlationId,
+		filterObj, bson.M{"content": 1}, nil,
+		&persist.MongoDbStreamOptions{BatchSize: 2})
+}
@@ -0,0 +1,34 @@
+package test_persistence
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDummyMemoryMongoDbPersistence(t *testing.T) {
+
+	var persistence *DummyMemoryMongoDbPersistence
+	var fixture DummyPersistenceFixture
+
+	persistence = NewDummyMemoryMongoDbPersistence()
+	fixture = *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	t.Run("DummyMemoryMongoDbPersistence:CRUD", fixture.TestCrudOperations)
+	t.Run("DummyMemoryMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	t.Run("DummyMemoryMongoDbPersistence:Stream", fixture.TestStreamOperations)
+	t.Run("DummyMemoryMongoDbPersistence:Paging", fixture.TestPagingOperations)
+
+}
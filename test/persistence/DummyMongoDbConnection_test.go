@@ -72,5 +72,7 @@ func TestDummyMongoDbConnection(t *testing.T) {
 
 	t.Run("DummyMongoDbConnection:CRUD", fixture.TestCrudOperations)
 	t.Run("DummyMongoDbConnection:Batch", fixture.TestBatchOperations)
+	t.Run("DummyMongoDbConnection:Stream", fixture.TestStreamOperations)
+	t.Run("DummyMongoDbConnection:Paging", fixture.TestPagingOperations)
 
 }
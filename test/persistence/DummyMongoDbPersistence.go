@@ -44,3 +44,17 @@ func (c *DummyMongoDbPersistence) GetCountByFilter(ctx context.Context, correlat
 
 	return c.IdentifiableMongoDbPersistence.GetCountByFilter(ctx, correlationId, filterObj)
 }
+
+func (c *DummyMongoDbPersistence) StreamByFilter(ctx context.Context, correlationId string,
+	filter cdata.FilterParams) (stream <-chan persist.MongoDbStreamItem[Dummy], err error) {
+
+	filterObj := bson.M{}
+
+	if key, ok := filter.GetAsNullableString("Key"); ok {
+		filterObj = bson.M{"key": key}
+	}
+
+	return c.IdentifiableMongoDbPersistence.StreamByFilter(ctx, correlationId,
+		filterObj, bson.M{"content": 1}, nil,
+		&persist.MongoDbStreamOptions{BatchSize: 2})
+}
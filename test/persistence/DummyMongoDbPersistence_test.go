@@ -57,5 +57,62 @@ func TestDummyMongoDbPersistence(t *testing.T) {
 
 	t.Run("DummyMongoDbPersistence:CRUD", fixture.TestCrudOperations)
 	t.Run("DummyMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	t.Run("DummyMongoDbPersistence:Stream", fixture.TestStreamOperations)
+	t.Run("DummyMongoDbPersistence:Paging", fixture.TestPagingOperations)
+
+}
+
+func TestDummyMongoDbPersistenceWithFacetCount(t *testing.T) {
+
+	var persistence *DummyMongoDbPersistence
+	var fixture DummyPersistenceFixture
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"options.facet_count", true,
+		"options.estimated_count", true,
+		"options.max_count", 1000,
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	fixture = *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	t.Run("DummyMongoDbPersistenceWithFacetCount:CRUD", fixture.TestCrudOperations)
+	t.Run("DummyMongoDbPersistenceWithFacetCount:Paging", fixture.TestPagingOperations)
 
 }
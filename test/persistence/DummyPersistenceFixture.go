@@ -161,3 +161,78 @@ func (c *DummyPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 0)
 
 }
+
+func (c *DummyPersistenceFixture) TestStreamOperations(t *testing.T) {
+	ids := make([]string, 0)
+	for _, content := range []string{"Content 1", "Content 2", "Content 3"} {
+		result, err := c.persistence.Create(context.Background(), "", Dummy{Key: "Stream", Content: content})
+		assert.Nil(t, err)
+		ids = append(ids, result.Id)
+	}
+
+	// Stream all items
+	stream, err := c.persistence.StreamByFilter(context.Background(), "", *cdata.NewFilterParamsFromTuples("Key", "Stream"))
+	assert.Nil(t, err)
+
+	items := make([]Dummy, 0)
+	for item := range stream {
+		assert.Nil(t, item.Err)
+		items = append(items, item.Item)
+	}
+	assert.Len(t, items, 3)
+	assert.Equal(t, "Content 1", items[0].Content)
+	assert.Equal(t, "Content 3", items[2].Content)
+
+	// Stop streaming by cancelling context
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err = c.persistence.StreamByFilter(ctx, "", *cdata.NewFilterParamsFromTuples("Key", "Stream"))
+	assert.Nil(t, err)
+
+	item, ok := <-stream
+	assert.True(t, ok)
+	assert.Nil(t, item.Err)
+	cancel()
+
+	count := 0
+	for range stream {
+		count++
+	}
+	assert.LessOrEqual(t, count, 1)
+
+	err = c.persistence.DeleteByIds(context.Background(), "", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestPagingOperations(t *testing.T) {
+	ids := make([]string, 0)
+	for _, content := range []string{"Content 1", "Content 2", "Content 3"} {
+		result, err := c.persistence.Create(context.Background(), "", Dummy{Key: "Paging", Content: content})
+		assert.Nil(t, err)
+		ids = append(ids, result.Id)
+	}
+
+	// Get page with total
+	page, err := c.persistence.GetPageByFilter(context.Background(), "",
+		*cdata.NewFilterParamsFromTuples("Key", "Paging"), *cdata.NewPagingParams(0, 2, true))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.True(t, page.HasTotal())
+	assert.Equal(t, 3, page.Total)
+
+	// Get the last page
+	page, err = c.persistence.GetPageByFilter(context.Background(), "",
+		*cdata.NewFilterParamsFromTuples("Key", "Paging"), *cdata.NewPagingParams(2, 2, true))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, 3, page.Total)
+
+	// Get empty page
+	page, err = c.persistence.GetPageByFilter(context.Background(), "",
+		*cdata.NewFilterParamsFromTuples("Key", "Unknown"), *cdata.NewPagingParams(0, 2, true))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 0)
+	assert.Equal(t, 0, page.Total)
+
+	err = c.persistence.DeleteByIds(context.Background(), "", ids)
+	assert.Nil(t, err)
+}
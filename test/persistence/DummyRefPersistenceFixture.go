@@ -60,6 +60,12 @@ func (c *DummyRefPersistenceFixture) TestCrudOperations(t *testing.T) {
 	item2 := page.Data[1]
 	assert.Equal(t, item2.Key, dummy1.Key)
 
+	// Paged reads must be converted the same way as other reads
+	assert.NotNil(t, item1)
+	assert.Equal(t, dummy2.Id, item1.Id)
+	assert.Equal(t, dummy1.Id, item2.Id)
+	assert.Equal(t, dummy1.Content, item2.Content)
+
 	// Update the dummy
 	dummy1.Content = "Updated Content 1"
 	result, err = c.persistence.Update(context.Background(), "", &dummy1)
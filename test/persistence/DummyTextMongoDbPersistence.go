@@ -0,0 +1,19 @@
+package test_persistence
+
+import (
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+)
+
+type DummyTextMongoDbPersistence struct {
+	*persist.IdentifiableMongoDbPersistence[Dummy, string]
+}
+
+func NewDummyTextMongoDbPersistence() *DummyTextMongoDbPersistence {
+	c := &DummyTextMongoDbPersistence{}
+	c.IdentifiableMongoDbPersistence = persist.InheritIdentifiableMongoDbPersistence[Dummy, string](c, "dummies_text")
+	return c
+}
+
+func (c *DummyTextMongoDbPersistence) DefineSchema() {
+	c.EnsureTextIndex(map[string]int32{"key": 10, "content": 1}, "english", nil)
+}
@@ -0,0 +1,23 @@
+package test_persistence
+
+import (
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type DummyViewMongoDbPersistence struct {
+	*persist.MongoDbViewPersistence[Dummy]
+}
+
+func NewDummyViewMongoDbPersistence() *DummyViewMongoDbPersistence {
+	c := &DummyViewMongoDbPersistence{}
+	c.MongoDbViewPersistence = persist.InheritMongoDbViewPersistence[Dummy](c, "dummies_view", "dummies_view_source")
+	return c
+}
+
+func (c *DummyViewMongoDbPersistence) DefineSchema() {
+	c.DefineView(bson.A{
+		bson.M{"$match": bson.M{"content": bson.M{"$ne": ""}}},
+		bson.M{"$project": bson.M{"key": 1, "content": bson.M{"$toUpper": "$content"}}},
+	}, nil)
+}
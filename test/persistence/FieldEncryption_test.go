@@ -0,0 +1,265 @@
+package test_persistence
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	encryptionKey1 = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	encryptionKey2 = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func TestFieldEncryptorDocuments(t *testing.T) {
+	encryptor := persist.NewMongoDbFieldEncryptor()
+	assert.Nil(t, encryptor.AddKeyFromString("k1", encryptionKey1))
+	encryptor.AddFields(false, "content", "card.number")
+	encryptor.AddFields(true, "key")
+
+	doc := map[string]any{
+		"_id":     "1",
+		"key":     "Key 1",
+		"content": "Content 1",
+		"card":    map[string]any{"number": "4111", "holder": "John"},
+	}
+	encrypted, err := encryptor.EncryptDocument("", doc)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", encrypted["_id"])
+	assert.True(t, persist.IsEncryptedValue(encrypted["key"]))
+	assert.True(t, persist.IsEncryptedValue(encrypted["content"]))
+	assert.True(t, persist.IsEncryptedValue(encrypted["card"].(map[string]any)["number"]))
+	assert.Equal(t, "John", encrypted["card"].(map[string]any)["holder"])
+
+	// The source document is not changed
+	assert.Equal(t, "Content 1", doc["content"])
+	assert.Equal(t, "4111", doc["card"].(map[string]any)["number"])
+
+	assert.Nil(t, encryptor.DecryptDocument("", encrypted))
+	assert.Equal(t, doc, encrypted)
+
+	// Plain values are read as is
+	plain := map[string]any{"content": "Plain"}
+	assert.Nil(t, encryptor.DecryptDocument("", plain))
+	assert.Equal(t, "Plain", plain["content"])
+}
+
+func TestFieldEncryptorDeterministic(t *testing.T) {
+	encryptor := persist.NewMongoDbFieldEncryptor()
+	assert.Nil(t, encryptor.AddKeyFromString("k1", encryptionKey1))
+	encryptor.AddFields(false, "content")
+	encryptor.AddFields(true, "key")
+
+	value1, err := encryptor.EncryptValue("", "key", "Key 1")
+	assert.Nil(t, err)
+	value2, err := encryptor.EncryptValue("", "key", "Key 1")
+	assert.Nil(t, err)
+	assert.Equal(t, value1, value2)
+
+	// Ciphertexts are bound to the field
+	value3, err := encryptor.EncryptValue("", "other", "Key 1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, value1, value3)
+
+	value1, err = encryptor.EncryptValue("", "content", "Content 1")
+	assert.Nil(t, err)
+	value2, err = encryptor.EncryptValue("", "content", "Content 1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, value1, value2)
+
+	filter, err := encryptor.EncryptedFilter("", "key", "Key 1")
+	assert.Nil(t, err)
+	value, _ := encryptor.EncryptValue("", "key", "Key 1")
+	assert.Equal(t, bson.M{"key": bson.M{"$in": bson.A{value}}}, filter)
+
+	_, err = encryptor.EncryptedFilter("", "content", "Content 1")
+	assert.NotNil(t, err)
+	assert.Equal(t, "NOT_DETERMINISTIC", err.(*cerr.ApplicationError).Code)
+}
+
+func TestFieldEncryptorKeyRotation(t *testing.T) {
+	encryptor := persist.NewMongoDbFieldEncryptor()
+	assert.Nil(t, encryptor.AddKeyFromString("k1", encryptionKey1))
+	encryptor.AddFields(true, "key")
+
+	old, err := encryptor.EncryptValue("", "key", "Key 1")
+	assert.Nil(t, err)
+
+	assert.Nil(t, encryptor.AddKeyFromString("k2", encryptionKey2))
+	assert.Nil(t, encryptor.SetActiveKey("k2"))
+	assert.Equal(t, "k2", encryptor.ActiveKeyId())
+
+	value, err := encryptor.EncryptValue("", "key", "Key 1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, old, value)
+
+	// Values encrypted with the old key are still readable and searchable
+	decrypted, err := encryptor.DecryptValue("", "key", old)
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 1", decrypted)
+
+	values, err := encryptor.EncryptedValues("", "key", "Key 1")
+	assert.Nil(t, err)
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, old)
+	assert.Contains(t, values, value)
+
+	// Values can't be read without their key
+	other := persist.NewMongoDbFieldEncryptor()
+	assert.Nil(t, other.AddKeyFromString("k2", encryptionKey2))
+	_, err = other.DecryptValue("", "key", old)
+	assert.NotNil(t, err)
+	assert.Equal(t, "UNKNOWN_ENCRYPTION_KEY", err.(*cerr.ApplicationError).Code)
+
+	assert.NotNil(t, encryptor.SetActiveKey("k3"))
+	assert.NotNil(t, encryptor.AddKey("k3", []byte("short")))
+}
+
+func TestFieldEncryptorUpdates(t *testing.T) {
+	encryptor := persist.NewMongoDbFieldEncryptor()
+	assert.Nil(t, encryptor.AddKeyFromString("k1", encryptionKey1))
+	encryptor.AddFields(false, "content", "card.number")
+
+	source := bson.M{
+		"$set":   bson.M{"content": "Content 1", "card": bson.M{"number": "4111"}, "key": "Key 1"},
+		"$unset": bson.M{"old": ""},
+	}
+	update, err := encryptor.EncryptUpdate("", source)
+	assert.Nil(t, err)
+	set := update.(bson.D).Map()["$set"].(bson.D).Map()
+	assert.True(t, persist.IsEncryptedValue(set["content"]))
+	assert.True(t, persist.IsEncryptedValue(set["card"].(bson.M)["number"]))
+	assert.Equal(t, "Key 1", set["key"])
+	assert.Equal(t, "4111", source["$set"].(bson.M)["card"].(bson.M)["number"])
+
+	for _, update := range []any{
+		bson.M{"$inc": bson.M{"content": 1}},
+		bson.M{"$rename": bson.M{"name": "content"}},
+		bson.M{"$set": bson.M{"card.number.part": "41"}},
+		bson.A{bson.M{"$set": bson.M{"content": "$name"}}},
+	} {
+		_, err = encryptor.EncryptUpdate("", update)
+		assert.NotNil(t, err)
+		assert.Equal(t, "ENCRYPTED_FIELD_OPERATION", err.(*cerr.ApplicationError).Code)
+	}
+}
+
+func TestFieldEncryptionConfig(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewEmptyConfigParams())
+	assert.Nil(t, persistence.Encryptor)
+
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"encryption.fields", "content",
+	))
+	assert.NotNil(t, persistence.Encryptor)
+	err := persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "NO_ENCRYPTION_KEY", err.(*cerr.ApplicationError).Code)
+
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"encryption.fields", "content",
+		"encryption.keys.k1", "bad key",
+	))
+	err = persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "BAD_ENCRYPTION_KEY", err.(*cerr.ApplicationError).Code)
+
+	// The active key is not guessed among several keys
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"encryption.fields", "content",
+		"encryption.keys.k1", "MDEyMzQ1Njc4OWFiY2RlZg==",
+		"encryption.keys.k2", "ZmVkY2JhOTg3NjU0MzIxMA==",
+	))
+	err = persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "AMBIGUOUS_ENCRYPTION_KEY", err.(*cerr.ApplicationError).Code)
+}
+
+func TestFieldEncryption(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_encrypted",
+		"encryption.fields", "content",
+		"encryption.deterministic_fields", "key",
+		"encryption.keys.k1", encryptionKey1,
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	dummy, err := persistence.Create(context.Background(), "", Dummy{Id: "1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 1", dummy.Content)
+
+	var stored bson.M
+	err = persistence.Collection.FindOne(context.Background(), bson.M{"_id": "1"}).Decode(&stored)
+	assert.Nil(t, err)
+	assert.True(t, persist.IsEncryptedValue(stored["key"]))
+	assert.True(t, persist.IsEncryptedValue(stored["content"]))
+
+	dummy, err = persistence.GetOneById(context.Background(), "", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 1", dummy.Key)
+	assert.Equal(t, "Content 1", dummy.Content)
+
+	dummy, err = persistence.UpdatePartially(context.Background(), "", "1",
+		*cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 2", dummy.Content)
+
+	// Rotate the key, documents encrypted with the old key remain searchable
+	assert.Nil(t, persistence.Encryptor.AddKeyFromString("k2", encryptionKey2))
+	assert.Nil(t, persistence.Encryptor.SetActiveKey("k2"))
+	_, err = persistence.Create(context.Background(), "", Dummy{Id: "2", Key: "Key 1", Content: "Content 3"})
+	assert.Nil(t, err)
+
+	filter, err := persistence.Encryptor.EncryptedFilter("", "key", "Key 1")
+	assert.Nil(t, err)
+	items, err := persistence.GetListByFilter(context.Background(), "", filter, bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Content 2", items[0].Content)
+	assert.Equal(t, "Content 3", items[1].Content)
+}
@@ -0,0 +1,96 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetOneByFilter(t *testing.T) {
+	var persistence *DummyMongoDbPersistence
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_query",
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	for _, dummy := range []Dummy{
+		{Id: "1", Key: "Key 1", Content: "Content 1"},
+		{Id: "2", Key: "Key 1", Content: "Content 2"},
+		{Id: "3", Key: "Key 2", Content: "Content 3"},
+	} {
+		_, err := persistence.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+
+	// Get the first item by sort
+	item, found, err := persistence.GetOneByFilter(context.Background(), "", bson.M{"key": "Key 1"}, bson.M{"content": -1})
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "2", item.Id)
+	assert.Equal(t, "Content 2", item.Content)
+
+	// Get missing item
+	item, found, err = persistence.GetOneByFilter(context.Background(), "", bson.M{"key": "Key 3"}, nil)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Equal(t, Dummy{}, item)
+
+	// Check existence
+	exists, err := persistence.ExistsByFilter(context.Background(), "", bson.M{"key": "Key 2"})
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	exists, err = persistence.ExistsByFilter(context.Background(), "", bson.M{"key": "Key 3"})
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// Get distinct values
+	values, err := persistence.GetDistinctValues(context.Background(), "", "key", nil)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []any{"Key 1", "Key 2"}, values)
+
+	values, err = persistence.GetDistinctValues(context.Background(), "", "content", bson.M{"key": "Key 1"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []any{"Content 1", "Content 2"}, values)
+}
@@ -0,0 +1,87 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetRandom(t *testing.T) {
+	var persistence *DummyMongoDbPersistence
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_random",
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	// Empty collection returns zero values
+	item, err := persistence.GetOneRandom(context.Background(), "", bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, Dummy{}, item)
+
+	items, err := persistence.GetRandomList(context.Background(), "", nil, 2)
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+
+	for _, dummy := range []Dummy{
+		{Id: "1", Key: "Key 1", Content: "Content 1"},
+		{Id: "2", Key: "Key 1", Content: "Content 2"},
+		{Id: "3", Key: "Key 2", Content: "Content 3"},
+	} {
+		_, err := persistence.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+
+	item, err = persistence.GetOneRandom(context.Background(), "", bson.M{"key": "Key 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 1", item.Key)
+	assert.Contains(t, []string{"1", "2"}, item.Id)
+
+	items, err = persistence.GetRandomList(context.Background(), "", bson.M{"key": "Key 1"}, 5)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+
+	items, err = persistence.GetRandomList(context.Background(), "", nil, 2)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+}
@@ -0,0 +1,125 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIdStrategies(t *testing.T) {
+	uuidV4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	uuidV7 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	assert.Len(t, persist.LongIdStrategy.NextId(), 32)
+	assert.Len(t, persist.ShortIdStrategy.NextId(), 9)
+	assert.IsType(t, primitive.ObjectID{}, persist.ObjectIdStrategy.NextId())
+	assert.Regexp(t, uuidV4, persist.UuidV4IdStrategy.NextId())
+	assert.Regexp(t, uuidV7, persist.UuidV7IdStrategy.NextId())
+	assert.Regexp(t, ulid, persist.UlidIdStrategy.NextId())
+
+	// Time ordered ids are sortable by generation time
+	id1 := persist.UlidIdStrategy.NextId().(string)
+	id2 := persist.UlidIdStrategy.NextId().(string)
+	assert.LessOrEqual(t, id1[:10], id2[:10])
+
+	strategy, ok := persist.NewIdStrategy("uuid7")
+	assert.True(t, ok)
+	assert.Regexp(t, uuidV7, strategy.NextId())
+
+	_, ok = persist.NewIdStrategy("unknown")
+	assert.False(t, ok)
+
+	custom := persist.IdStrategyFunc(func() any { return "custom" })
+	assert.Equal(t, "custom", custom.NextId())
+}
+
+func TestIdStrategyConfig(t *testing.T) {
+	config := cconf.NewConfigParamsFromTuples("options.id_strategy", "unknown")
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), config)
+	err := persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_ID_STRATEGY", err.(*cerr.ApplicationError).Code)
+
+	memory := NewDummyMemoryMongoDbPersistence()
+	memory.Configure(context.Background(), config)
+	err = memory.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_ID_STRATEGY", err.(*cerr.ApplicationError).Code)
+}
+
+func TestObjectIdStrategy(t *testing.T) {
+	var persistence *DummyMongoDbPersistence
+	var fixture DummyPersistenceFixture
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_oid",
+		"options.id_strategy", "objectid",
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	fixture = *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	t.Run("ObjectIdStrategy:CRUD", fixture.TestCrudOperations)
+	t.Run("ObjectIdStrategy:Batch", fixture.TestBatchOperations)
+
+	// Ids are stored as ObjectIDs and exposed as hex strings
+	item, err := persistence.Create(context.Background(), "", Dummy{Key: "Key 3", Content: "Content 3"})
+	assert.Nil(t, err)
+	oid, err := primitive.ObjectIDFromHex(item.Id)
+	assert.Nil(t, err)
+
+	count, err := persistence.Collection.CountDocuments(context.Background(), bson.M{"_id": oid})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	item, err = persistence.GetOneById(context.Background(), "", item.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, oid.Hex(), item.Id)
+}
@@ -0,0 +1,189 @@
+package test_persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryDocsPersistence struct {
+	*persist.IdentifiableMemoryMongoDbPersistence[map[string]any, string]
+}
+
+func newMemoryDocsPersistence() *memoryDocsPersistence {
+	c := &memoryDocsPersistence{}
+	c.IdentifiableMemoryMongoDbPersistence = persist.InheritIdentifiableMemoryMongoDbPersistence[map[string]any, string](c, "docs")
+	return c
+}
+
+func memoryDocIds(items []map[string]any) []any {
+	result := make([]any, 0, len(items))
+	for _, item := range items {
+		result = append(result, item["Id"])
+	}
+	return result
+}
+
+func TestMemoryMongoDbPersistence(t *testing.T) {
+	persistence := newMemoryDocsPersistence()
+	err := persistence.Open(context.Background(), "")
+	assert.Nil(t, err)
+	defer persistence.Close(context.Background(), "")
+
+	for _, doc := range []map[string]any{
+		{"Id": "1", "name": "Alpha", "age": 30, "tags": []string{"a", "b"}, "address": map[string]any{"city": "Paris"}},
+		{"Id": "2", "name": "beta", "age": 25, "tags": []string{"b"}, "address": map[string]any{"city": "Rome"}},
+		{"Id": "3", "name": "Gamma", "age": 40.5, "tags": []string{}},
+	} {
+		_, err := persistence.Create(context.Background(), "", doc)
+		assert.Nil(t, err)
+	}
+
+	// Ids are unique
+	_, err = persistence.Create(context.Background(), "", map[string]any{"Id": "1"})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+
+	t.Run("Filters", func(t *testing.T) {
+		for _, test := range []struct {
+			filter bson.M
+			ids    []any
+		}{
+			{bson.M{"age": bson.M{"$gt": 28}}, []any{"1", "3"}},
+			{bson.M{"age": bson.M{"$gte": 25, "$lt": 40}}, []any{"1", "2"}},
+			{bson.M{"tags": "b"}, []any{"1", "2"}},
+			{bson.M{"tags": bson.M{"$in": bson.A{"a", "c"}}}, []any{"1"}},
+			{bson.M{"tags": bson.M{"$all": bson.A{"a", "b"}}}, []any{"1"}},
+			{bson.M{"tags": bson.M{"$size": 0}}, []any{"3"}},
+			{bson.M{"address.city": "Rome"}, []any{"2"}},
+			{bson.M{"address": bson.M{"$exists": false}}, []any{"3"}},
+			{bson.M{"address.city": nil}, []any{"3"}},
+			{bson.M{"name": bson.M{"$regex": "^al", "$options": "i"}}, []any{"1"}},
+			{bson.M{"name": primitive.Regex{Pattern: "a$"}}, []any{"1", "2", "3"}},
+			{bson.M{"age": bson.M{"$not": bson.M{"$gt": 28}}}, []any{"2"}},
+			{bson.M{"$or": bson.A{bson.M{"_id": "1"}, bson.M{"age": 25}}}, []any{"1", "2"}},
+			{bson.M{"$nor": bson.A{bson.M{"_id": "1"}, bson.M{"age": 25}}}, []any{"3"}},
+			{bson.M{"_id": bson.M{"$nin": bson.A{"1", "2"}}}, []any{"3"}},
+			{bson.M{"tags": bson.M{"$elemMatch": bson.M{"$eq": "a"}}}, []any{"1"}},
+		} {
+			items, err := persistence.GetListByFilter(context.Background(), "", test.filter, bson.M{"_id": 1}, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, test.ids, memoryDocIds(items), "filter %v", test.filter)
+		}
+
+		_, err := persistence.GetListByFilter(context.Background(), "", bson.M{"$where": "true"}, nil, nil)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("SortAndProjection", func(t *testing.T) {
+		items, err := persistence.GetListByFilter(context.Background(), "", nil, bson.D{{Key: "age", Value: -1}}, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []any{"3", "1", "2"}, memoryDocIds(items))
+
+		items, err = persistence.GetListByFilter(context.Background(), "", bson.M{"_id": "1"}, nil, bson.M{"name": 1})
+		assert.Nil(t, err)
+		assert.Len(t, items, 1)
+		assert.Equal(t, "1", items[0]["Id"])
+		assert.Equal(t, "Alpha", items[0]["name"])
+		assert.NotContains(t, items[0], "age")
+
+		items, err = persistence.GetListByFilter(context.Background(), "", bson.M{"_id": "1"}, nil, bson.M{"tags": 0, "address": 0})
+		assert.Nil(t, err)
+		assert.Len(t, items, 1)
+		assert.NotContains(t, items[0], "tags")
+		assert.Equal(t, "Alpha", items[0]["name"])
+
+		values, err := persistence.GetDistinctValues(context.Background(), "", "tags", nil)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []any{"a", "b"}, values)
+	})
+
+	t.Run("Updates", func(t *testing.T) {
+		item, err := persistence.UpdateOneByFilter(context.Background(), "", bson.M{"_id": "2"}, bson.M{
+			"$inc":      bson.M{"age": 1},
+			"$push":     bson.M{"tags": bson.M{"$each": bson.A{"c", "d"}}},
+			"$addToSet": bson.M{"labels": "x"},
+			"$set":      bson.M{"address.zip": "00100"},
+			"$unset":    bson.M{"name": ""},
+		})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 26, item["age"])
+		assert.Equal(t, bson.A{"b", "c", "d"}, item["tags"])
+		assert.Equal(t, bson.A{"x"}, item["labels"])
+		assert.NotContains(t, item, "name")
+
+		item, err = persistence.UpdatePartiallyWithBuilder(context.Background(), "", "2",
+			persist.NewMongoDbUpdateBuilder().Pull("tags", "c").AddToSet("labels", "x", "y"))
+		assert.Nil(t, err)
+		assert.Equal(t, bson.A{"b", "d"}, item["tags"])
+		assert.Equal(t, bson.A{"x", "y"}, item["labels"])
+
+		result, err := persistence.UpdateByFilter(context.Background(), "", bson.M{"tags": "b"}, bson.M{"$set": bson.M{"flag": true}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), result.MatchedCount)
+		assert.Equal(t, int64(2), result.ModifiedCount)
+
+		item, err = persistence.UpsertByFilter(context.Background(), "", bson.M{"_id": "4", "name": "Delta"}, bson.M{
+			"$set":         bson.M{"age": 20},
+			"$setOnInsert": bson.M{"created": true},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "4", item["Id"])
+		assert.Equal(t, "Delta", item["name"])
+		assert.Equal(t, true, item["created"])
+
+		// Positional updates and array filters are not supported
+		_, err = persistence.UpdateOneByFilter(context.Background(), "", bson.M{"_id": "1"},
+			persist.NewMongoDbUpdateBuilder().Set("tags.$[tag]", "z").ArrayFilter(bson.M{"tag": "a"}))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		count, err := persistence.GetCountByFilter(context.Background(), "", nil)
+		assert.Nil(t, err)
+
+		failure := errors.New("failure")
+		err = persistence.ExecuteInTransaction(context.Background(), "", func(ctx context.Context) error {
+			if _, err := persistence.Create(ctx, "", map[string]any{"Id": "5"}); err != nil {
+				return err
+			}
+			if _, err := persistence.DeleteById(ctx, "", "1"); err != nil {
+				return err
+			}
+			return failure
+		})
+		assert.Equal(t, failure, err)
+
+		after, err := persistence.GetCountByFilter(context.Background(), "", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, count, after)
+
+		item, err := persistence.GetOneById(context.Background(), "", "1")
+		assert.Nil(t, err)
+		assert.Equal(t, "Alpha", item["name"])
+
+		// Changes made outside of the failed transaction are kept
+		err = persistence.ExecuteInTransaction(context.Background(), "", func(ctx context.Context) error {
+			if _, err := persistence.Create(ctx, "", map[string]any{"Id": "6"}); err != nil {
+				return err
+			}
+			if _, err := persistence.Create(context.Background(), "", map[string]any{"Id": "7"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		assert.Equal(t, failure, err)
+
+		item, err = persistence.GetOneById(context.Background(), "", "6")
+		assert.Nil(t, err)
+		assert.Nil(t, item)
+		item, err = persistence.GetOneById(context.Background(), "", "7")
+		assert.Nil(t, err)
+		assert.Equal(t, "7", item["Id"])
+	})
+}
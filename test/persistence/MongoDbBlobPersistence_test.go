@@ -0,0 +1,176 @@
+package test_persistence
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoDbBlobPersistenceNotOpened(t *testing.T) {
+	persistence := persist.NewMongoDbBlobPersistence("test_blobs")
+
+	_, err := persistence.GetOneById(context.Background(), "", "1")
+	assert.NotNil(t, err)
+	assert.Equal(t, "NOT_OPENED", err.(*cerr.ApplicationError).Code)
+
+	err = persistence.DeleteByFilter(context.Background(), "", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "NOT_OPENED", err.(*cerr.ApplicationError).Code)
+}
+
+func TestMongoDbBlobPersistenceUnsupported(t *testing.T) {
+	persistence := persist.NewMongoDbBlobPersistence("test_blobs")
+
+	_, err := persistence.Create(context.Background(), "", persist.BlobInfo{Id: "1"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "UNSUPPORTED_OPERATION", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpdateByFilter(context.Background(), "", bson.M{}, bson.M{"$set": bson.M{"length": 0}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "UNSUPPORTED_OPERATION", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpsertByFilter(context.Background(), "", bson.M{}, bson.M{"$set": bson.M{"length": 0}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "UNSUPPORTED_OPERATION", err.(*cerr.ApplicationError).Code)
+
+	for _, config := range []*cconf.ConfigParams{
+		cconf.NewConfigParamsFromTuples("tenancy.mode", "collection"),
+		cconf.NewConfigParamsFromTuples("tenancy.mode", "discriminator", "tenancy.field", "tenant_id"),
+	} {
+		persistence = persist.NewMongoDbBlobPersistence("test_blobs")
+		persistence.Configure(context.Background(), config)
+		err = persistence.Open(context.Background(), "")
+		assert.NotNil(t, err)
+		assert.Equal(t, cerr.Misconfiguration, err.(*cerr.ApplicationError).Category)
+	}
+}
+
+func TestMongoDbBlobPersistence(t *testing.T) {
+
+	var persistence *persist.MongoDbBlobPersistence
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"options.cleanup_interval", 0,
+	)
+
+	persistence = persist.NewMongoDbBlobPersistence("test_blobs")
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr)
+		return
+	}
+
+	// Upload from stream
+	blob1, err := persistence.Upload(context.Background(), "",
+		persist.BlobInfo{
+			Name: "file1.txt",
+			Metadata: persist.BlobMetadata{
+				ContentType: "text/plain",
+				Custom:      map[string]any{"group": "A"},
+			},
+		},
+		strings.NewReader("Hello world"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", blob1.Id)
+	assert.Equal(t, "file1.txt", blob1.Name)
+	assert.Equal(t, int64(11), blob1.Size)
+	assert.Equal(t, "text/plain", blob1.Metadata.ContentType)
+	assert.Equal(t, "A", blob1.Metadata.Custom["group"])
+
+	// Chunked upload
+	token, err := persistence.BeginWrite(context.Background(), "",
+		persist.BlobInfo{Id: "blob2", Name: "file2.txt"})
+	assert.Nil(t, err)
+	err = persistence.WriteChunk(context.Background(), "", token, []byte("ABC"))
+	assert.Nil(t, err)
+	blob2, err := persistence.EndWrite(context.Background(), "", token, []byte("DEF"))
+	assert.Nil(t, err)
+	assert.Equal(t, "blob2", blob2.Id)
+	assert.Equal(t, int64(6), blob2.Size)
+
+	// Download
+	var buf bytes.Buffer
+	size, err := persistence.Download(context.Background(), "", blob2.Id, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), size)
+	assert.Equal(t, "ABCDEF", buf.String())
+
+	// Filter by metadata
+	page, err := persistence.GetPageByFilter(context.Background(), "",
+		bson.M{"metadata.group": "A"}, *cdata.NewEmptyPagingParams(), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, blob1.Id, page.Data[0].Id)
+
+	items, err := persistence.GetListByIds(context.Background(), "", []string{blob1.Id, blob2.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+
+	// Expiration
+	_, err = persistence.Upload(context.Background(), "",
+		persist.BlobInfo{
+			Id:       "blob3",
+			Name:     "file3.txt",
+			Metadata: persist.BlobMetadata{ExpireTime: time.Now().Add(-time.Minute)},
+		},
+		strings.NewReader("Expired"))
+	assert.Nil(t, err)
+
+	err = persistence.DeleteExpired(context.Background(), "")
+	assert.Nil(t, err)
+
+	blob3, err := persistence.GetOneById(context.Background(), "", "blob3")
+	assert.Nil(t, err)
+	assert.Equal(t, "", blob3.Id)
+
+	// Delete
+	err = persistence.DeleteById(context.Background(), "", blob1.Id)
+	assert.Nil(t, err)
+
+	_, err = persistence.Download(context.Background(), "", blob1.Id, &buf)
+	assert.NotNil(t, err)
+
+	count, err := persistence.GetCountByFilter(context.Background(), "", bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,129 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGeoJsonConversion(t *testing.T) {
+	persistence := NewDummyGeoMongoDbPersistence()
+	place := DummyPlace{Id: "1", Name: "Office", Location: persist.NewGeoPoint(-73.97, 40.77)}
+
+	doc, err := persistence.ConvertFromPublic(place)
+	assert.Nil(t, err)
+	location := doc["location"].(map[string]any)
+	assert.Equal(t, "Point", location["type"])
+
+	result, err := persistence.ConvertToPublic(doc)
+	assert.Nil(t, err)
+	assert.Equal(t, place, result)
+	assert.Equal(t, -73.97, result.Location.Longitude())
+	assert.Equal(t, 40.77, result.Location.Latitude())
+
+	polygon := persist.NewGeoPolygon([][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}})
+	assert.Equal(t, "Polygon", polygon.Type)
+	assert.Len(t, polygon.Coordinates[0], 5)
+	assert.Equal(t, []float64{0, 0}, polygon.Coordinates[0][4])
+
+	polygon = persist.NewGeoPolygon([][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 0}})
+	assert.Len(t, polygon.Coordinates[0], 4)
+
+	filter := persist.GeoNearFilter("location", place.Location, 1000, 0)
+	assert.Equal(t, bson.M{"location": bson.M{"$near": bson.M{
+		"$geometry":    place.Location,
+		"$maxDistance": 1000.0,
+	}}}, filter)
+}
+
+func TestGeoQueries(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+	)
+
+	persistence := NewDummyGeoMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	for _, place := range []DummyPlace{
+		{Id: "1", Name: "Near", Location: persist.NewGeoPoint(0.001, 0)},
+		{Id: "2", Name: "Middle", Location: persist.NewGeoPoint(0.01, 0)},
+		{Id: "3", Name: "Far", Location: persist.NewGeoPoint(1, 0)},
+	} {
+		_, err := persistence.Create(context.Background(), "", place)
+		assert.Nil(t, err)
+	}
+
+	center := persist.NewGeoPoint(0, 0)
+	page, err := persistence.GetPageNear(context.Background(), "", "location", center, 0, 0,
+		nil, *cdata.NewPagingParams(0, 2, true), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, "Near", page.Data[0].Item.Name)
+	assert.Equal(t, "Middle", page.Data[1].Item.Name)
+	assert.InDelta(t, 111, page.Data[0].Distance, 1)
+	assert.InDelta(t, 1113, page.Data[1].Distance, 5)
+
+	page, err = persistence.GetPageNear(context.Background(), "", "location", center, 5000, 500,
+		nil, *cdata.NewEmptyPagingParams(), bson.M{"name": 1})
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, "Middle", page.Data[0].Item.Name)
+	assert.True(t, page.Data[0].Distance > 0)
+
+	zone := persist.NewGeoPolygon([][]float64{{-0.1, -0.1}, {0.1, -0.1}, {0.1, 0.1}, {-0.1, 0.1}})
+	within, err := persistence.GetPageWithin(context.Background(), "", "location", zone,
+		bson.M{"name": bson.M{"$ne": "Middle"}}, *cdata.NewPagingParams(0, 10, true), bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, within.Total)
+	assert.Equal(t, "Near", within.Data[0].Name)
+
+	intersects, err := persistence.GetPageIntersects(context.Background(), "", "location", zone,
+		nil, *cdata.NewEmptyPagingParams(), bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, intersects.Data, 2)
+
+	items, err := persistence.GetListByFilter(context.Background(), "",
+		persist.GeoWithinSphereFilter("location", center, 2000), bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+}
@@ -0,0 +1,147 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestQueryOptionFunctions(t *testing.T) {
+	queryOptions := persist.MongoDbQueryOptions{MaxTime: time.Second, Comment: "default"}
+	collation := &options.Collation{Locale: "en", Strength: 2}
+	for _, option := range []persist.MongoDbQueryOption{
+		persist.WithCollation(collation),
+		persist.WithHint("key_1"),
+		persist.WithComment("test"),
+		persist.WithAllowDiskUse(true),
+	} {
+		option(&queryOptions)
+	}
+	assert.Equal(t, collation, queryOptions.Collation)
+	assert.Equal(t, "key_1", queryOptions.Hint)
+	assert.Equal(t, time.Second, queryOptions.MaxTime)
+	assert.Equal(t, "test", queryOptions.Comment)
+	assert.True(t, *queryOptions.AllowDiskUse)
+
+	// Only options that are set override previous ones
+	persist.WithQueryOptions(persist.MongoDbQueryOptions{MaxTime: 2 * time.Second})(&queryOptions)
+	assert.Equal(t, 2*time.Second, queryOptions.MaxTime)
+	assert.Equal(t, "test", queryOptions.Comment)
+
+	// Configured limit can be removed for a single operation
+	persist.WithMaxTime(0)(&queryOptions)
+	assert.Equal(t, time.Duration(0), queryOptions.MaxTime)
+}
+
+func TestQueryOptionsConfig(t *testing.T) {
+	queryOptions := persist.NewMongoDbQueryOptionsFromConfig(cconf.NewEmptyConfigParams())
+	assert.Equal(t, persist.MongoDbQueryOptions{}, queryOptions)
+
+	queryOptions = persist.NewMongoDbQueryOptionsFromConfig(cconf.NewConfigParamsFromTuples(
+		"options.max_time_ms", 5000,
+		"options.allow_disk_use", true,
+		"options.comment", "dummies",
+		"options.collation_locale", "en",
+		"options.collation_strength", 2,
+	))
+	assert.Equal(t, 5*time.Second, queryOptions.MaxTime)
+	assert.True(t, *queryOptions.AllowDiskUse)
+	assert.Equal(t, "dummies", queryOptions.Comment)
+	assert.Equal(t, &options.Collation{Locale: "en", Strength: 2}, queryOptions.Collation)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples("options.max_time_ms", 100))
+	assert.Equal(t, 100*time.Millisecond, persistence.QueryOptions.MaxTime)
+}
+
+func TestQueryOptions(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"options.max_time_ms", 10000,
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	for _, dummy := range []Dummy{{Id: "1", Key: "Key 1"}, {Id: "2", Key: "key 2"}, {Id: "3", Key: "KEY 3"}} {
+		_, err := persistence.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+
+	// Case-insensitive comparison with collation
+	caseInsensitive := []persist.MongoDbQueryOption{
+		persist.WithCollation(&options.Collation{Locale: "en", Strength: 2}),
+		persist.WithComment("case-insensitive"),
+	}
+	items, err := persistence.GetListByFilter(context.Background(), "", bson.M{"key": "KEY 1"}, nil, nil, caseInsensitive...)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+
+	count, err := persistence.IdentifiableMongoDbPersistence.GetCountByFilter(context.Background(), "",
+		bson.M{"key": bson.M{"$in": bson.A{"key 1", "key 3"}}}, caseInsensitive...)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	items, err = persistence.GetListByFilter(context.Background(), "", bson.M{"key": "KEY 1"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+
+	// Hint of a missing index is rejected by the server
+	_, err = persistence.IdentifiableMongoDbPersistence.GetPageByFilter(context.Background(), "", nil, *cdata.NewEmptyPagingParams(), nil, nil,
+		persist.WithHint("missing_index"))
+	assert.NotNil(t, err)
+
+	// Writes and reads by id take options too
+	result, err := persistence.IdentifiableMongoDbPersistence.UpdateByFilter(context.Background(), "",
+		bson.M{"key": "KEY 2"}, bson.M{"$set": bson.M{"content": "Updated"}}, caseInsensitive...)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	_, err = persistence.DeleteById(context.Background(), "", "1", persist.WithHint("missing_index"))
+	assert.NotNil(t, err)
+
+	item, err := persistence.GetOneById(context.Background(), "", "2", persist.WithComment("by id"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Updated", item.Content)
+}
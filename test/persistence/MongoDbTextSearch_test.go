@@ -0,0 +1,90 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTextFilter(t *testing.T) {
+	assert.Equal(t, bson.M{"$text": bson.M{"$search": "coffee"}}, persist.TextFilter("coffee", ""))
+	assert.Equal(t, bson.M{"$text": bson.M{"$search": "café", "$language": "french"}},
+		persist.TextFilter("café", "french"))
+}
+
+func TestTextSearch(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+	)
+
+	persistence := NewDummyTextMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	for _, dummy := range []Dummy{
+		{Id: "1", Key: "Coffee", Content: "Fresh roasted beans"},
+		{Id: "2", Key: "Tea", Content: "Goes well with coffee"},
+		{Id: "3", Key: "Juice", Content: "Orange"},
+	} {
+		_, err := persistence.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+
+	page, err := persistence.GetPageByText(context.Background(), "", "coffee", "",
+		nil, *cdata.NewPagingParams(0, 10, true), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Len(t, page.Data, 2)
+
+	// Matches in the key are weighted higher
+	assert.Equal(t, "1", page.Data[0].Item.Id)
+	assert.Equal(t, "Fresh roasted beans", page.Data[0].Item.Content)
+	assert.Equal(t, "2", page.Data[1].Item.Id)
+	assert.True(t, page.Data[0].Score > page.Data[1].Score)
+
+	page, err = persistence.GetPageByText(context.Background(), "", "coffee", "",
+		bson.M{"key": "Tea"}, *cdata.NewEmptyPagingParams(), bson.M{"key": 1})
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, "Tea", page.Data[0].Item.Key)
+	assert.Equal(t, "", page.Data[0].Item.Content)
+	assert.True(t, page.Data[0].Score > 0)
+}
@@ -0,0 +1,83 @@
+package test_persistence
+
+import (
+	"testing"
+
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoDbUpdateBuilder(t *testing.T) {
+	update := persist.NewMongoDbUpdateBuilder().
+		Set("content", "Content").
+		Unset("draft").
+		Inc("counters.views", 1).
+		Push("tags", "a", "b").
+		Pull("labels", bson.M{"$in": bson.A{"x"}}).
+		AddToSet("groups", "admin").
+		Set("grades.$[low].passed", false).
+		ArrayFilter(bson.M{"low.score": bson.M{"$lt": 50}})
+
+	assert.Nil(t, update.Validate(""))
+	assert.Equal(t, bson.M{
+		"$set":      bson.M{"content": "Content", "grades.$[low].passed": false},
+		"$unset":    bson.M{"draft": ""},
+		"$inc":      bson.M{"counters.views": 1},
+		"$push":     bson.M{"tags": bson.M{"$each": []any{"a", "b"}}},
+		"$pull":     bson.M{"labels": bson.M{"$in": bson.A{"x"}}},
+		"$addToSet": bson.M{"groups": "admin"},
+	}, update.Update())
+	assert.Len(t, update.ArrayFilters(), 1)
+
+	update = persist.NewMongoDbUpdateBuilderFromMap(*cdata.NewAnyValueMapFromTuples("key", "Key 1", "content", "Content 1"))
+	assert.Nil(t, update.Validate(""))
+	assert.Equal(t, bson.M{"$set": bson.M{"key": "Key 1", "content": "Content 1"}}, update.Update())
+}
+
+func TestMongoDbUpdateBuilderValidation(t *testing.T) {
+	codeOf := func(err error) string {
+		if appErr, ok := err.(*cerr.ApplicationError); ok {
+			return appErr.Code
+		}
+		return ""
+	}
+
+	err := persist.NewMongoDbUpdateBuilder().Validate("")
+	assert.Equal(t, "EMPTY_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a", 1).Unset("a").Validate("")
+	assert.Equal(t, "CONFLICTING_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.b", 1).Inc("a", 1).Validate("")
+	assert.Equal(t, "CONFLICTING_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("ab", 1).Inc("a", 1).Validate("")
+	assert.Nil(t, err)
+
+	err = persist.NewMongoDbUpdateBuilder().Inc("a", "1").Validate("")
+	assert.Equal(t, "INVALID_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a..b", 1).Validate("")
+	assert.Equal(t, "INVALID_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("$a", 1).Validate("")
+	assert.Equal(t, "INVALID_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.$[Bad].b", 1).Validate("")
+	assert.Equal(t, "INVALID_UPDATE", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.$.b", 1).Pull("c.$[]", 1).Validate("")
+	assert.Nil(t, err)
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.$[x].b", 1).Validate("")
+	assert.Equal(t, "INVALID_ARRAY_FILTER", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.b", 1).ArrayFilter(bson.M{"x.b": 1}).Validate("")
+	assert.Equal(t, "INVALID_ARRAY_FILTER", codeOf(err))
+
+	err = persist.NewMongoDbUpdateBuilder().Set("a.$[x].b", 1).ArrayFilter(bson.M{"x.b": 1, "y.c": 2}).Validate("")
+	assert.Equal(t, "INVALID_ARRAY_FILTER", codeOf(err))
+}
@@ -0,0 +1,121 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestViewPersistenceReadOnly(t *testing.T) {
+	persistence := NewDummyViewMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewEmptyConfigParams())
+
+	_, err := persistence.Create(context.Background(), "", Dummy{Id: "1", Key: "Key 1"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "READ_ONLY", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpdateByFilter(context.Background(), "", bson.M{}, *cdata.NewAnyValueMapFromTuples("key", "Key 2"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "READ_ONLY", err.(*cerr.ApplicationError).Code)
+
+	err = persistence.DeleteByFilter(context.Background(), "", bson.M{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "READ_ONLY", err.(*cerr.ApplicationError).Code)
+
+	err = persistence.Clear(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "READ_ONLY", err.(*cerr.ApplicationError).Code)
+
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples("tenancy.mode", "collection"))
+	err = persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "UNSUPPORTED_TENANCY", err.(*cerr.ApplicationError).Code)
+}
+
+func TestViewPersistence(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+	)
+
+	source := NewDummyMongoDbPersistence()
+	source.Configure(context.Background(), dbConfig.Override(cconf.NewConfigParamsFromTuples(
+		"collection", "dummies_view_source",
+	)))
+	opnErr := source.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer source.Close(context.Background(), "")
+	assert.Nil(t, source.Clear(context.Background(), ""))
+
+	for _, dummy := range []Dummy{
+		{Id: "1", Key: "Key 1", Content: "Content 1"},
+		{Id: "2", Key: "Key 2", Content: "Content 2"},
+		{Id: "3", Key: "Key 3", Content: ""},
+	} {
+		_, err := source.Create(context.Background(), "", dummy)
+		assert.Nil(t, err)
+	}
+
+	persistence := NewDummyViewMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+	opnErr = persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	items, err := persistence.GetListByFilter(context.Background(), "", nil, bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "CONTENT 1", items[0].Content)
+
+	count, err := persistence.GetCountByFilter(context.Background(), "", bson.M{"key": "Key 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	page, err := persistence.GetPageByFilter(context.Background(), "", nil,
+		*cdata.NewPagingParams(0, 1, true), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, 2, page.Total)
+
+	// The view follows changes of the source
+	_, err = source.Create(context.Background(), "", Dummy{Id: "4", Key: "Key 4", Content: "Content 4"})
+	assert.Nil(t, err)
+	count, err = persistence.GetCountByFilter(context.Background(), "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// Reopening updates the existing view
+	assert.Nil(t, persistence.Close(context.Background(), ""))
+	assert.Nil(t, persistence.Open(context.Background(), ""))
+}
@@ -0,0 +1,107 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	"github.com/pip-services3-gox/pip-services3-mongodb-gox/outbox"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemoryOutboxEventsOfMissingItems(t *testing.T) {
+	persistence := NewDummyMemoryMongoDbPersistence()
+	err := persistence.Open(context.Background(), "")
+	assert.Nil(t, err)
+	defer persistence.Close(context.Background(), "")
+
+	events := func(result Dummy) []outbox.OutboxEvent {
+		return []outbox.OutboxEvent{outbox.NewOutboxEvent("changed", result.Id, result)}
+	}
+
+	result, err := persistence.UpdateWithEvents(context.Background(), "",
+		Dummy{Id: "missing", Key: "Key 1", Content: "Content 1"}, events)
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	result, err = persistence.DeleteByIdWithEvents(context.Background(), "", "missing", events)
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	assert.Len(t, persistence.GetEnqueuedEvents(), 0)
+
+	// Events of existing items are enqueued
+	_, err = persistence.Create(context.Background(), "", Dummy{Id: "1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	result, err = persistence.DeleteByIdWithEvents(context.Background(), "", "1", events)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", result.Id)
+	assert.Len(t, persistence.GetEnqueuedEvents(), 1)
+}
+
+func TestOutboxEventsOfMissingItems(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"options.outbox_collection", "dummies_outbox",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+	outboxCollection := persistence.Db.Collection("dummies_outbox")
+	_, err := outboxCollection.DeleteMany(context.Background(), bson.M{})
+	assert.Nil(t, err)
+
+	events := func(result Dummy) []outbox.OutboxEvent {
+		return []outbox.OutboxEvent{outbox.NewOutboxEvent("changed", result.Id, result)}
+	}
+
+	// Update of a missing item enqueues nothing
+	result, err := persistence.UpdateWithEvents(context.Background(), "",
+		Dummy{Id: "missing", Key: "Key 1", Content: "Content 1"}, events)
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	// Delete of a missing item enqueues nothing
+	result, err = persistence.DeleteByIdWithEvents(context.Background(), "", "missing", events)
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	count, err := outboxCollection.CountDocuments(context.Background(), bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
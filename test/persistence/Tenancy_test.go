@@ -0,0 +1,184 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	cerr "github.com/pip-services3-gox/pip-services3-commons-gox/errors"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTenancyContext(t *testing.T) {
+	assert.Equal(t, "", persist.GetTenantId(context.Background()))
+
+	ctx := persist.WithTenantId(context.Background(), "tenant1")
+	assert.Equal(t, "tenant1", persist.GetTenantId(ctx))
+}
+
+func TestTenancyDiscriminatorGuards(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"tenancy.mode", "discriminator",
+	))
+	ctx := persist.WithTenantId(context.Background(), "tenant1")
+
+	// Filters are restricted to the tenant
+	filter, err := persistence.ResolveFilter(ctx, "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"tenant_id": "tenant1"}, filter)
+
+	filter, err = persistence.ResolveFilter(ctx, "", bson.M{"key": "Key 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$and": bson.A{bson.M{"key": "Key 1"}, bson.M{"tenant_id": "tenant1"}}}, filter)
+
+	// Calls without tenant are rejected
+	_, err = persistence.ResolveFilter(context.Background(), "", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "NO_TENANT", err.(*cerr.ApplicationError).Code)
+
+	// Updates can't move documents to other tenants
+	_, err = persistence.UpdateByFilter(ctx, "", nil, bson.M{"$set": bson.M{"tenant_id": "tenant2"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "TENANT_FIELD_IMMUTABLE", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpdateByFilter(ctx, "", nil, bson.M{"$rename": bson.M{"key": "tenant_id"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "TENANT_FIELD_IMMUTABLE", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpdateByFilter(ctx, "", nil, bson.A{bson.M{"$unset": "tenant_id"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "TENANT_FIELD_IMMUTABLE", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.UpdatePartially(ctx, "", "1", *cdata.NewAnyValueMapFromTuples("tenant_id", "tenant2"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "TENANT_FIELD_IMMUTABLE", err.(*cerr.ApplicationError).Code)
+
+	// Documents of other tenants can't be stored
+	persistenceMap := NewDummyMapMongoDbPersistence()
+	persistenceMap.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"tenancy.mode", "discriminator",
+	))
+	_, err = persistenceMap.Create(ctx, "", map[string]any{"Id": "1", "tenant_id": "tenant2"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "TENANT_MISMATCH", err.(*cerr.ApplicationError).Code)
+}
+
+func TestTenancyCollectionGuards(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"tenancy.mode", "collection",
+	))
+
+	// Tenant ids must be safe for collection names
+	_, err := persistence.ResolveCollection(persist.WithTenantId(context.Background(), "tenant.1"), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_TENANT", err.(*cerr.ApplicationError).Code)
+
+	_, err = persistence.ResolveCollection(persist.WithTenantId(context.Background(), "tenant1"), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "NOT_OPENED", err.(*cerr.ApplicationError).Code)
+
+	// Filters are not changed for separated tenants
+	filter, err := persistence.ResolveFilter(context.Background(), "", bson.M{"key": "Key 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"key": "Key 1"}, filter)
+
+	persistence.Configure(context.Background(), cconf.NewConfigParamsFromTuples(
+		"tenancy.mode", "schema",
+	))
+	err = persistence.Open(context.Background(), "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "INVALID_TENANCY", err.(*cerr.ApplicationError).Code)
+}
+
+func TestTenancy(t *testing.T) {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	for _, mode := range []string{"discriminator", "collection", "database"} {
+		t.Run(mode, func(t *testing.T) {
+			dbConfig := cconf.NewConfigParamsFromTuples(
+				"connection.uri", mongoUri,
+				"connection.host", mongoHost,
+				"connection.port", mongoPort,
+				"connection.database", mongoDatabase,
+				"collection", "dummies_tenancy",
+				"tenancy.mode", mode,
+			)
+
+			persistence := NewDummyMongoDbPersistence()
+			persistence.Configure(context.Background(), dbConfig)
+
+			opnErr := persistence.Open(context.Background(), "")
+			if opnErr != nil {
+				t.Error("Error opened persistence", opnErr)
+				return
+			}
+			defer persistence.Close(context.Background(), "")
+
+			tenant1 := persist.WithTenantId(context.Background(), "tenant1")
+			tenant2 := persist.WithTenantId(context.Background(), "tenant2")
+			for _, ctx := range []context.Context{tenant1, tenant2} {
+				err := persistence.Clear(ctx, "")
+				assert.Nil(t, err)
+			}
+
+			// The same ids can be used by different tenants
+			_, err := persistence.Create(tenant1, "", Dummy{Id: "1", Key: "Key 1", Content: "Tenant 1"})
+			assert.Nil(t, err)
+			_, err = persistence.Create(tenant2, "", Dummy{Id: "1", Key: "Key 1", Content: "Tenant 2"})
+			assert.Nil(t, err)
+			_, err = persistence.Create(tenant2, "", Dummy{Id: "2", Key: "Key 2", Content: "Tenant 2"})
+			assert.Nil(t, err)
+
+			item, err := persistence.GetOneById(tenant1, "", "1")
+			assert.Nil(t, err)
+			assert.Equal(t, "Tenant 1", item.Content)
+
+			page, err := persistence.GetPageByFilter(tenant2, "", *cdata.NewEmptyFilterParams(), *cdata.NewPagingParams(0, 10, true))
+			assert.Nil(t, err)
+			assert.Len(t, page.Data, 2)
+			assert.Equal(t, 2, page.Total)
+
+			// Tenants can't change data of each other
+			item, err = persistence.DeleteById(tenant1, "", "2")
+			assert.Nil(t, err)
+			assert.Equal(t, Dummy{}, item)
+
+			result, err := persistence.UpdateByFilter(tenant1, "", bson.M{}, bson.M{"$set": bson.M{"content": "Updated"}})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), result.ModifiedCount)
+
+			item, err = persistence.GetOneById(tenant2, "", "1")
+			assert.Nil(t, err)
+			assert.Equal(t, "Tenant 2", item.Content)
+
+			count, err := persistence.GetCountByFilter(tenant2, "", *cdata.NewEmptyFilterParams())
+			assert.Nil(t, err)
+			assert.Equal(t, int64(2), count)
+
+			// Calls without tenant are rejected
+			_, err = persistence.GetOneById(context.Background(), "", "1")
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package test_persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-gox/pip-services3-commons-gox/config"
+	cdata "github.com/pip-services3-gox/pip-services3-commons-gox/data"
+	persist "github.com/pip-services3-gox/pip-services3-mongodb-gox/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdateByFilter(t *testing.T) {
+	var persistence *DummyMongoDbPersistence
+
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoHost == "" {
+		mongoHost = "localhost"
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+	if mongoUri == "" && mongoHost == "" {
+		return
+	}
+
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+		"collection", "dummies_update",
+	)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(context.Background(), dbConfig)
+
+	opnErr := persistence.Open(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close(context.Background(), "")
+
+	opnErr = persistence.Clear(context.Background(), "")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	for _, key := range []string{"Key 1", "Key 1", "Key 2"} {
+		_, err := persistence.Create(context.Background(), "", Dummy{Key: key, Content: "Content"})
+		assert.Nil(t, err)
+	}
+
+	// Update many with partial map
+	result, err := persistence.UpdateByFilter(context.Background(), "",
+		bson.M{"key": "Key 1"}, *cdata.NewAnyValueMapFromTuples("content", "Updated Content"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.MatchedCount)
+	assert.Equal(t, int64(2), result.ModifiedCount)
+
+	// Update one with raw update document
+	item, err := persistence.UpdateOneByFilter(context.Background(), "",
+		bson.M{"key": "Key 2"}, bson.M{"$set": bson.M{"content": "Content 2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 2", item.Key)
+	assert.Equal(t, "Content 2", item.Content)
+
+	// Update missing item
+	item, err = persistence.UpdateOneByFilter(context.Background(), "",
+		bson.M{"key": "Key 3"}, bson.M{"$set": bson.M{"content": "Content 3"}})
+	assert.Nil(t, err)
+	assert.Equal(t, Dummy{}, item)
+
+	// Upsert missing item
+	item, err = persistence.UpsertByFilter(context.Background(), "",
+		bson.M{"_id": "3", "key": "Key 3"}, cdata.NewAnyValueMapFromTuples("content", "Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", item.Id)
+	assert.Equal(t, "Key 3", item.Key)
+	assert.Equal(t, "Content 3", item.Content)
+
+	// Upsert existing item
+	item, err = persistence.UpsertByFilter(context.Background(), "",
+		bson.M{"_id": "3", "key": "Key 3"}, cdata.NewAnyValueMapFromTuples("content", "Upserted Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Upserted Content 3", item.Content)
+
+	// Update with builder
+	_, err = persistence.UpdatePartiallyWithBuilder(context.Background(), "", "3",
+		persist.NewMongoDbUpdateBuilder().
+			Inc("counter", 2).
+			Push("tags", "a", "b", "c").
+			Unset("content"))
+	assert.Nil(t, err)
+	_, err = persistence.UpdatePartiallyWithBuilder(context.Background(), "", "3",
+		persist.NewMongoDbUpdateBuilder().
+			Inc("counter", -1).
+			Pull("tags", "b"))
+	assert.Nil(t, err)
+	item, err = persistence.UpdatePartiallyWithBuilder(context.Background(), "", "3",
+		persist.NewMongoDbUpdateBuilder().
+			Set("tags.$[tag]", "z").
+			ArrayFilter(bson.M{"tag": "c"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "", item.Content)
+
+	var doc bson.M
+	err = persistence.Collection.FindOne(context.Background(), bson.M{"_id": "3"}).Decode(&doc)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, doc["counter"])
+	assert.Equal(t, bson.A{"a", "z"}, doc["tags"])
+	assert.NotContains(t, doc, "content")
+
+	// Invalid update is not sent
+	_, err = persistence.UpdatePartiallyWithBuilder(context.Background(), "", "3",
+		persist.NewMongoDbUpdateBuilder().Set("tags", bson.A{}).Push("tags", "a"))
+	assert.NotNil(t, err)
+
+	count, err := persistence.IdentifiableMongoDbPersistence.GetCountByFilter(context.Background(), "", bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+}